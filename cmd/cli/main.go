@@ -51,7 +51,7 @@ func run(ctx context.Context, args []string, env []string, input io.Reader) erro
 	)
 
 	set.StringVar(&channel, "channel", "", "channel to publish msgs to")
-	set.Var(&handler, "handler", "task handler, must be one of: print, kobold, error")
+	set.Var(&handler, "handler", "task handler, one of: print, kobold, error, or a registered handler")
 	set.IntVar(&maxprocs, "maxprocs", 10, "max number of concurrent runs")
 
 	set.VisitAll(config.UseEnv(env, "KOBOLD_"))
@@ -67,6 +67,16 @@ func run(ctx context.Context, args []string, env []string, input io.Reader) erro
 
 	pool := task.NewPool(ctx, maxprocs, query)
 	pool.SetHandler(handler)
+	pool.SetScriptLimits(opts.ScriptLimits)
+
+	cache := pool.Cache()
+	cache.SetDir(opts.GitCacheDir)
+	cache.SetMaxSize(opts.GitCacheMaxSize)
+	cache.SetTTL(opts.GitFetchTTL)
+
+	if err := cache.Load(ctx); err != nil {
+		return fmt.Errorf("load cache: %w", err)
+	}
 
 	if input != nil {
 		if err := pool.QueueReader(ctx, channel, input); err != nil {
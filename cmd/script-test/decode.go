@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bluebrown/kobold/config"
+	"github.com/bluebrown/kobold/plugin"
+	"github.com/bluebrown/kobold/store"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// run a decoder against each payload file, and print the decoded events. Each
+// ref is validated, the same way kobold parses it, when running a task. The
+// command fails, if any payload could not be decoded, or any ref is invalid.
+func runDecode(ctx context.Context, args []string, env []string, stdin io.Reader, stdout io.Writer) error {
+	var (
+		set        = flag.NewFlagSet("script-test decode", flag.ExitOnError)
+		opts       = config.NewOptions().Bind(set)
+		decoder    string
+		channel    string
+		decodeArgs listFlag
+		headers    listFlag
+		query      listFlag
+		remoteAddr string
+		mocks      listFlag
+	)
+
+	set.StringVar(&decoder, "decoder", "", "name of the builtin, configured or registered native decoder")
+	set.StringVar(&channel, "channel", "", "name of a configured channel, whose decoder and decoder args are used")
+	set.Var(&decodeArgs, "arg", "decoder arg as key=value, the value is parsed as json, if possible. May be repeated")
+	set.Var(&headers, "header", "request header as 'name: value', passed in the source. May be repeated")
+	set.Var(&query, "query", "query parameter as key=value, passed in the source. May be repeated")
+	set.StringVar(&remoteAddr, "remote-addr", "", "remote address, passed in the source")
+	set.Var(&mocks, "mock", "mocked http response as 'METHOD URL STATUS [BODY|@FILE]'. May be repeated")
+	set.Usage = func() {
+		fmt.Fprintf(set.Output(), "usage: script-test decode [flags] [file...]\n\nfiles default to stdin, - reads stdin.\n\n")
+		set.PrintDefaults()
+	}
+
+	q, err := configure(ctx, set, opts, args, env)
+	if err != nil {
+		return err
+	}
+
+	if (decoder == "") == (channel == "") {
+		return errors.New("exactly one of -decoder or -channel is required")
+	}
+
+	var (
+		decoderName = decoder
+		script      []byte
+		host        plugin.HostEnv
+		kwargs      map[string]any
+	)
+
+	if channel != "" {
+		c, err := q.ChannelDecoderGet(ctx, channel)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("channel %q not found", channel)
+		}
+		if err != nil {
+			return fmt.Errorf("get channel decoder: %w", err)
+		}
+		if !c.DecoderName.Valid {
+			return fmt.Errorf("channel %q has no decoder", channel)
+		}
+		decoderName, script, host, kwargs = c.DecoderName.String, c.Script, plugin.HostEnv{Env: c.Env, Secrets: c.Secrets, Hosts: c.Hosts}, c.DecoderArgs
+	}
+
+	// Native decoders have no script, they are looked up in the registry of
+	// this binary, the same way kobold does.
+	native, isNative := plugin.LookupDecoder(decoderName)
+	switch {
+	case isNative:
+	case plugin.IsNative(decoderName):
+		return fmt.Errorf("decoder %q is not registered in this binary", decoderName)
+	case channel != "" && script == nil:
+		return fmt.Errorf("decoder %q of channel %q not found", decoderName, channel)
+	case channel == "":
+		d, err := q.DecoderGet(ctx, decoderName)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("decoder %q not found", decoderName)
+		}
+		if err != nil {
+			return fmt.Errorf("get decoder: %w", err)
+		}
+		script, host = d.Script, plugin.HostEnv{Env: d.Env, Secrets: d.Secrets, Hosts: d.Hosts}
+	}
+
+	if kwargs, err = parseArgs(decodeArgs, kwargs); err != nil {
+		return err
+	}
+
+	src, err := source(headers, query, remoteAddr)
+	if err != nil {
+		return err
+	}
+
+	mock, err := newMockTransport(mocks, stdout)
+	if err != nil {
+		return err
+	}
+
+	ctx = plugin.WithTransport(plugin.WithLimits(ctx, opts.ScriptLimits), mock)
+	ctx = plugin.WithLibraries(ctx, q.LibraryGet)
+
+	files := set.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	var (
+		runner          = plugin.NewDecoderRunner()
+		failed, invalid int
+	)
+
+	for _, file := range files {
+		data, err := readPayload(file, stdin)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(stdout, "# %s\n", file)
+
+		var events []store.Event
+		if isNative {
+			events, err = native(ctx, data, src, kwargs)
+		} else {
+			events, err = runner.Decode(ctx, firstNonEmpty(channel, decoder), script, data, src, kwargs, host)
+		}
+		if err != nil {
+			fmt.Fprintf(stdout, "error: %v\n", err)
+			failed++
+			continue
+		}
+
+		invalid += printEvents(stdout, events)
+	}
+
+	if failed > 0 || invalid > 0 {
+		return fmt.Errorf("failed: %d of %d payloads not decoded, %d invalid refs", failed, len(files), invalid)
+	}
+
+	return nil
+}
+
+// print the events as table, and return the number of invalid refs.
+func printEvents(w io.Writer, events []store.Event) int {
+	if len(events) == 0 {
+		fmt.Fprintln(w, "no events")
+		return 0
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	defer tw.Flush()
+
+	invalid := 0
+	for _, e := range events {
+		status := "ok"
+		if _, err := name.ParseReference(e.Ref); err != nil {
+			status = "invalid: " + err.Error()
+			invalid++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Action, e.Ref, labels(e.Labels), status)
+	}
+
+	return invalid
+}
+
+func labels(m map[string]string) string {
+	if len(m) == 0 {
+		return "-"
+	}
+	s := make([]string, 0, len(m))
+	for k, v := range m {
+		s = append(s, k+"="+v)
+	}
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+// build the source of the payload, the same way the webhook does.
+func source(headers, query []string, remoteAddr string) (plugin.Source, error) {
+	src := plugin.Source{
+		Headers:    make(map[string]string, len(headers)),
+		Query:      make(map[string]string, len(query)),
+		RemoteAddr: remoteAddr,
+	}
+	for _, h := range headers {
+		k, v, ok := strings.Cut(h, ":")
+		if !ok {
+			return plugin.Source{}, fmt.Errorf("header %q: expected 'name: value'", h)
+		}
+		k = strings.ToLower(strings.TrimSpace(k))
+		if plugin.IsCredentialHeader(k) {
+			continue
+		}
+		if prev, ok := src.Headers[k]; ok {
+			v = prev + ", " + strings.TrimSpace(v)
+		}
+		src.Headers[k] = strings.TrimSpace(v)
+	}
+	for _, p := range query {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok {
+			return plugin.Source{}, fmt.Errorf("query %q: expected key=value", p)
+		}
+		if _, ok := src.Query[k]; !ok {
+			src.Query[k] = v
+		}
+	}
+	return src, nil
+}
+
+func readPayload(file string, stdin io.Reader) ([]byte, error) {
+	if file == "-" {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("read stdin: %w", err)
+		}
+		return data, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read payload: %w", err)
+	}
+	return data, nil
+}
+
+func firstNonEmpty(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
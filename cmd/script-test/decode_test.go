@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bluebrown/kobold/plugin"
+	"github.com/bluebrown/kobold/store"
+)
+
+func init() {
+	plugin.RegisterDecoder("go.script-test-csv@v1", func(_ context.Context, data []byte, _ plugin.Source, args map[string]any) ([]store.Event, error) {
+		var events []store.Event
+		for _, ref := range strings.Split(strings.TrimSpace(string(data)), ",") {
+			events = append(events, store.Event{Ref: ref, Action: store.ActionPush, Labels: map[string]string{"team": fmt.Sprint(args["team"])}})
+		}
+		return events, nil
+	})
+}
+
+func TestSource(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		headers    []string
+		query      []string
+		remoteAddr string
+		want       plugin.Source
+		wantErr    bool
+	}{
+		{
+			name:       "headers and query",
+			headers:    []string{"X-GitHub-Event: package", "Accept: text/plain", "accept:application/json", "Authorization: Bearer test"},
+			query:      []string{"token=secret", "token=other", "empty="},
+			remoteAddr: "127.0.0.1:1234",
+			want: plugin.Source{
+				Headers:    map[string]string{"x-github-event": "package", "accept": "text/plain, application/json"},
+				Query:      map[string]string{"token": "secret", "empty": ""},
+				RemoteAddr: "127.0.0.1:1234",
+			},
+		},
+		{
+			name: "empty",
+			want: plugin.Source{Headers: map[string]string{}, Query: map[string]string{}},
+		},
+		{
+			name:    "invalid header",
+			headers: []string{"X-GitHub-Event"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid query",
+			query:   []string{"token"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := source(tt.headers, tt.query, tt.remoteAddr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("source() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("source() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunDecode(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		args    []string
+		stdin   string
+		wantOut []string
+		wantErr bool
+	}{
+		{
+			name:    "builtin",
+			args:    []string{"-decoder", "builtin.lines@v1"},
+			stdin:   "busybox:1.0\nnginx:1.1\n",
+			wantOut: []string{"# -", "push  busybox:1.0  -  ok", "push  nginx:1.1    -  ok"},
+		},
+		{
+			name:    "invalid ref",
+			args:    []string{"-decoder", "builtin.lines@v1"},
+			stdin:   "busybox:1.0\nBusybox::\n",
+			wantOut: []string{"invalid: "},
+			wantErr: true,
+		},
+		{
+			name:    "no events",
+			args:    []string{"-decoder", "builtin.lines@v1"},
+			wantOut: []string{"no events"},
+		},
+		{
+			name:    "native",
+			args:    []string{"-decoder", "go.script-test-csv@v1", "-arg", "team=platform"},
+			stdin:   "busybox:1.0,nginx:1.1",
+			wantOut: []string{"push  busybox:1.0  team=platform  ok", "push  nginx:1.1    team=platform  ok"},
+		},
+		{
+			name:    "native not registered",
+			args:    []string{"-decoder", "go.script-test-missing@v1"},
+			wantErr: true,
+		},
+		{
+			name:    "decoder not found",
+			args:    []string{"-decoder", "acme.missing@v1"},
+			wantErr: true,
+		},
+		{
+			name:    "decoder and channel",
+			args:    []string{"-decoder", "builtin.lines@v1", "-channel", "foo"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var out bytes.Buffer
+			err := run(context.Background(), append([]string{"decode", "-loglvl", "8"}, tt.args...), nil, strings.NewReader(tt.stdin), &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("run() error = %v, wantErr %v\n%s", err, tt.wantErr, out.String())
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("expected %q in output, got:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/bluebrown/kobold/config"
+	"github.com/bluebrown/kobold/git"
+	"github.com/bluebrown/kobold/krm"
+	"github.com/bluebrown/kobold/plugin"
+	"github.com/bluebrown/kobold/store"
+	"github.com/bluebrown/kobold/store/model"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/volatiletech/null/v8"
+)
+
+const (
+	defaultRepo      = "https://github.com/acme/app.git?ref=main"
+	defaultChange    = "docker.io/library/busybox:1.0=docker.io/library/busybox:1.1"
+	defaultCommitSHA = "0000000000000000000000000000000000000000"
+)
+
+// run a post hook against a synthetic task group. The http requests of the
+// hook go to a mock, which prints them, instead of the network. The outputs of
+// the hook are printed. The command fails, if the hook fails.
+func runHook(ctx context.Context, args []string, env []string, stdout io.Writer) error {
+	var (
+		set        = flag.NewFlagSet("script-test hook", flag.ExitOnError)
+		opts       = config.NewOptions().Bind(set)
+		hook       string
+		pipeline   string
+		repo       string
+		destBranch string
+		message    string
+		commitSHA  string
+		status     string
+		chainErr   string
+		changes    listFlag
+		warnings   listFlag
+		outputs    listFlag
+		hookArgs   listFlag
+		mocks      listFlag
+	)
+
+	set.StringVar(&hook, "hook", "", "name of the builtin, configured or registered native post hook")
+	set.StringVar(&pipeline, "pipeline", "", "name of a configured pipeline, whose repo, pr options and hook args are used")
+	set.StringVar(&repo, "repo", "", "repo uri of the task group, defaults to "+defaultRepo)
+	set.StringVar(&destBranch, "dest-branch", "", "dest branch of the task group")
+	set.StringVar(&message, "message", "chore(kobold): Update image refs", "commit message of the run")
+	set.StringVar(&commitSHA, "commit-sha", defaultCommitSHA, "sha of the pushed commit, empty if nothing was pushed")
+	set.StringVar(&status, "status", "success", "status of the chain, one of: success, failure")
+	set.StringVar(&chainErr, "error", "", "error of the chain, if the status is failure")
+	set.Var(&changes, "change", "change as OLD_REF=NEW_REF, defaults to "+defaultChange+". May be repeated")
+	set.Var(&warnings, "warning", "warning of the run. May be repeated")
+	set.Var(&outputs, "output", "output of a previous hook as key=value. May be repeated")
+	set.Var(&hookArgs, "arg", "hook arg as key=value, the value is parsed as json, if possible. May be repeated")
+	set.Var(&mocks, "mock", "mocked http response as 'METHOD URL STATUS [BODY|@FILE]'. May be repeated")
+
+	q, err := configure(ctx, set, opts, args, env)
+	if err != nil {
+		return err
+	}
+
+	if hook == "" {
+		return errors.New("-hook is required")
+	}
+
+	if status != "success" && status != "failure" {
+		return fmt.Errorf("invalid status %q, must be one of: success, failure", status)
+	}
+
+	group := model.TaskGroup{
+		Fingerprint:  "script-test",
+		PipelineName: null.StringFrom("script-test"),
+		TaskIds:      store.FlatList{"script-test"},
+	}
+
+	// Native post hooks have no script, they are looked up in the registry of
+	// this binary, the same way kobold does.
+	native, isNative := plugin.LookupPostHook(hook)
+	switch {
+	case isNative:
+	case plugin.IsNative(hook):
+		return fmt.Errorf("post hook %q is not registered in this binary", hook)
+	default:
+		h, err := q.PostHookGet(ctx, hook)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("post hook %q not found", hook)
+		}
+		if err != nil {
+			return fmt.Errorf("get post hook: %w", err)
+		}
+		group.PostHook, group.PostHookEnv, group.PostHookSecrets, group.PostHookHosts = h.Script, h.Env, h.Secrets, h.Hosts
+	}
+
+	if pipeline != "" {
+		if err := withPipeline(ctx, q, &group, pipeline, hook); err != nil {
+			return err
+		}
+	} else {
+		repo = firstNonEmpty(repo, defaultRepo)
+	}
+
+	if repo != "" {
+		var uri git.PackageURI
+		if err := uri.UnmarshalText([]byte(repo)); err != nil {
+			return fmt.Errorf("repo: %w", err)
+		}
+		group.RepoUri = uri
+	}
+
+	if destBranch != "" {
+		group.DestBranch = null.StringFrom(destBranch)
+	}
+
+	if group.PostHookArgs, err = parseArgs(hookArgs, group.PostHookArgs); err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		changes = listFlag{defaultChange}
+	}
+
+	run := plugin.Run{Message: message, CommitSHA: commitSHA, Warnings: warnings}
+	for _, c := range changes {
+		change, err := parseChange(c)
+		if err != nil {
+			return err
+		}
+		run.Changes = append(run.Changes, change)
+		group.Msgs = append(group.Msgs, change.NewRef)
+		group.Events = append(group.Events, store.Event{Ref: change.NewRef, Action: store.ActionPush})
+	}
+
+	state := plugin.ChainState{Status: status, Error: chainErr, Outputs: make(map[string]string, len(outputs))}
+	for _, o := range outputs {
+		k, v, ok := strings.Cut(o, "=")
+		if !ok {
+			return fmt.Errorf("output %q: expected key=value", o)
+		}
+		state.Outputs[k] = v
+	}
+
+	mock, err := newMockTransport(mocks, stdout)
+	if err != nil {
+		return err
+	}
+
+	ctx = plugin.WithTransport(plugin.WithLimits(ctx, opts.ScriptLimits), mock)
+	ctx = plugin.WithLibraries(ctx, q.LibraryGet)
+
+	var out map[string]string
+	if isNative {
+		out, err = native(ctx, group, run, state)
+	} else {
+		out, err = plugin.NewPostHookRunner().Run(ctx, group, run, state)
+	}
+	if err != nil {
+		return fmt.Errorf("post hook %q: %w", hook, err)
+	}
+
+	keys := make([]string, 0, len(out))
+	for k := range out {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintln(stdout, "# outputs")
+	for _, k := range keys {
+		fmt.Fprintf(stdout, "%s=%s\n", k, out[k])
+	}
+
+	return nil
+}
+
+// use the repo, branch, commit templates and pr options of the pipeline. If
+// the hook is part of its chain, its args in the chain are used.
+func withPipeline(ctx context.Context, q *model.Queries, group *model.TaskGroup, pipeline, hook string) error {
+	p, err := q.PipelineGet(ctx, pipeline)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("pipeline %q not found", pipeline)
+	}
+	if err != nil {
+		return fmt.Errorf("get pipeline: %w", err)
+	}
+
+	group.PipelineName = null.StringFrom(p.Name)
+	group.RepoUri, group.DestBranch = p.RepoUri, p.DestBranch
+	group.CommitTitle, group.CommitBody = p.CommitTitle, p.CommitBody
+	group.PrProvider, group.PrApiUrl, group.PrCredentialName = p.PrProvider, p.PrApiUrl, p.PrCredentialName
+	group.PrLabels, group.PrReviewers, group.PrTeamReviewers = p.PrLabels, p.PrReviewers, p.PrTeamReviewers
+	group.PrDraft, group.PrAutoMerge = p.PrDraft, p.PrAutoMerge
+
+	hooks, err := q.PipelinePostHookList(ctx, pipeline)
+	if err != nil {
+		return fmt.Errorf("list pipeline post hooks: %w", err)
+	}
+
+	for _, h := range hooks {
+		if h.PostHookName == hook {
+			group.PostHookArgs = h.Args
+			break
+		}
+	}
+
+	return nil
+}
+
+func parseChange(s string) (krm.Change, error) {
+	oldRef, newRef, ok := strings.Cut(s, "=")
+	if !ok {
+		return krm.Change{}, fmt.Errorf("change %q: expected OLD_REF=NEW_REF", s)
+	}
+	ref, err := name.ParseReference(newRef)
+	if err != nil {
+		return krm.Change{}, fmt.Errorf("change %q: %w", s, err)
+	}
+	return krm.Change{
+		Description: fmt.Sprintf("update image ref %q to %q", oldRef, newRef),
+		Registry:    ref.Context().RegistryStr(),
+		Repo:        ref.Context().RepositoryStr(),
+		OldRef:      oldRef,
+		NewRef:      newRef,
+		File:        "deployment.yaml",
+		Path:        "spec.template.spec.containers[0].image",
+	}, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bluebrown/kobold/krm"
+	"github.com/bluebrown/kobold/plugin"
+	"github.com/bluebrown/kobold/store/model"
+)
+
+func init() {
+	plugin.RegisterPostHook("go.script-test-audit@v1", func(_ context.Context, g model.TaskGroup, run plugin.Run, state plugin.ChainState) (map[string]string, error) {
+		return map[string]string{"audited": fmt.Sprintf("%s:%s:%v", state.Status, run.CommitSHA, g.PostHookArgs["level"])}, nil
+	})
+}
+
+func TestParseChange(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		give    string
+		want    krm.Change
+		wantErr bool
+	}{
+		{
+			name: "docker hub",
+			give: "busybox:1.0=docker.io/library/busybox:1.1",
+			want: krm.Change{
+				Description: `update image ref "busybox:1.0" to "docker.io/library/busybox:1.1"`,
+				Registry:    "index.docker.io",
+				Repo:        "library/busybox",
+				OldRef:      "busybox:1.0",
+				NewRef:      "docker.io/library/busybox:1.1",
+				File:        "deployment.yaml",
+				Path:        "spec.template.spec.containers[0].image",
+			},
+		},
+		{
+			name: "registry",
+			give: "ghcr.io/acme/app:1.0=ghcr.io/acme/app:1.1",
+			want: krm.Change{
+				Description: `update image ref "ghcr.io/acme/app:1.0" to "ghcr.io/acme/app:1.1"`,
+				Registry:    "ghcr.io",
+				Repo:        "acme/app",
+				OldRef:      "ghcr.io/acme/app:1.0",
+				NewRef:      "ghcr.io/acme/app:1.1",
+				File:        "deployment.yaml",
+				Path:        "spec.template.spec.containers[0].image",
+			},
+		},
+		{name: "missing new ref", give: "busybox:1.0", wantErr: true},
+		{name: "invalid new ref", give: "busybox:1.0=Busybox::", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseChange(tt.give)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseChange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseChange() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunHook(t *testing.T) {
+	t.Parallel()
+
+	cfg := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(cfg, []byte(`
+[[post_hook]]
+name = "acme.notify@v1"
+hosts = ["chat.example.com"]
+script = """
+load("http.star", "http")
+def main(repo, src_branch, dest_branch, title, body, changes, warnings, team = "", run = {}):
+    res = http.post("https://chat.example.com/hooks/" + team, json_body = {"sha": run["commit_sha"]})
+    if res.status_code != 200:
+        fail("notify: " + res.body())
+    return {"message_id": res.json()["id"]}
+"""
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantOut []string
+		wantErr bool
+	}{
+		{
+			name: "mocked",
+			args: []string{"-hook", "acme.notify@v1", "-arg", "team=platform", "-commit-sha", "abc", "-mock", `POST chat.example.com/hooks/* 200 {"id": "42"}`},
+			wantOut: []string{
+				"> POST https://chat.example.com/hooks/platform",
+				`{"sha":"abc"}`,
+				"< 200",
+				"# outputs\nmessage_id=42\n",
+			},
+		},
+		{
+			name:    "not mocked",
+			args:    []string{"-hook", "acme.notify@v1", "-arg", "team=platform"},
+			wantOut: []string{"< 404 (not mocked)"},
+			wantErr: true,
+		},
+		{
+			name:    "native",
+			args:    []string{"-hook", "go.script-test-audit@v1", "-arg", "level=high", "-commit-sha", "abc"},
+			wantOut: []string{"# outputs\naudited=success:abc:high\n"},
+		},
+		{
+			name:    "native not registered",
+			args:    []string{"-hook", "go.script-test-missing@v1"},
+			wantErr: true,
+		},
+		{
+			name:    "hook not found",
+			args:    []string{"-hook", "acme.missing@v1"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid status",
+			args:    []string{"-hook", "acme.notify@v1", "-status", "done"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var out bytes.Buffer
+			err := run(context.Background(), append([]string{"hook", "-loglvl", "8", "-config", cfg}, tt.args...), nil, nil, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("run() error = %v, wantErr %v\n%s", err, tt.wantErr, out.String())
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("expected %q in output, got:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
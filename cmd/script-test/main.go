@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/bluebrown/kobold/config"
+	"github.com/bluebrown/kobold/store"
+	"github.com/bluebrown/kobold/store/model"
+	"github.com/bluebrown/kobold/store/schema"
+	_ "modernc.org/sqlite"
+)
+
+const usage = `usage: script-test <command> [flags]
+
+commands:
+  decode  run a decoder against payload files, and validate the decoded refs
+  hook    run a post hook against a synthetic task group, with mocked http
+
+run script-test <command> -h for the flags of a command`
+
+func init() {
+	store.MustMakeUUID()
+	store.MustMakeSha1()
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if err := run(ctx, os.Args[1:], os.Environ(), os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		cancel()
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, env []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", usage)
+	}
+
+	switch args[0] {
+	case "decode":
+		return runDecode(ctx, args[1:], env, stdin, stdout)
+	case "hook":
+		return runHook(ctx, args[1:], env, stdout)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprintln(stdout, usage)
+		return nil
+	}
+
+	return fmt.Errorf("unknown command %q\n\n%s", args[0], usage)
+}
+
+// parse the flags, and configure an in memory db with the builtins and the
+// given config. That way, builtin and configured scripts can be tested, without
+// touching the db of a running kobold. The db flag may still point to one, but
+// only without config, since applying a config purges the config of the db.
+func configure(ctx context.Context, set *flag.FlagSet, opts *config.Options, args []string, env []string) (*model.Queries, error) {
+	setDefault(set, "db", ":memory:")
+	setDefault(set, "logfmt", "text")
+
+	set.VisitAll(config.UseEnv(env, "KOBOLD_"))
+
+	if err := set.Parse(args); err != nil {
+		return nil, fmt.Errorf("parse args: %w", err)
+	}
+
+	if db := set.Lookup("db").Value.String(); db != ":memory:" && (opts.Config != "" || opts.Confd != "") {
+		return nil, fmt.Errorf("config and confd require an in memory db, got %q", db)
+	}
+
+	query, err := config.Configure(ctx, *opts, schema.TaskSchema, schema.ReadSchema)
+	if err != nil {
+		return nil, fmt.Errorf("configure: %w", err)
+	}
+
+	return query, nil
+}
+
+func setDefault(set *flag.FlagSet, name, value string) {
+	f := set.Lookup(name)
+	if err := f.Value.Set(value); err != nil {
+		panic(err)
+	}
+	f.DefValue = value
+}
+
+// a flag, which may be given multiple times.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ", ") }
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// parse key=value pairs into script args. The value is parsed as json, if
+// possible, so that numbers, bools, lists and objects can be passed.
+// Otherwise, it is used as string.
+func parseArgs(pairs []string, args map[string]any) (map[string]any, error) {
+	if args == nil {
+		args = make(map[string]any, len(pairs))
+	}
+	for _, p := range pairs {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok {
+			return nil, fmt.Errorf("arg %q: expected key=value", p)
+		}
+		var val any
+		dec := json.NewDecoder(bytes.NewReader([]byte(v)))
+		dec.UseNumber()
+		if err := dec.Decode(&val); err != nil || dec.More() {
+			val = v
+		}
+		args[k] = val
+	}
+	return args, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		pairs   []string
+		args    map[string]any
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			name:  "json values",
+			pairs: []string{"n=1", "ok=true", "list=[1, \"a\"]", "obj={\"k\": \"v\"}"},
+			want: map[string]any{
+				"n":    json.Number("1"),
+				"ok":   true,
+				"list": []any{json.Number("1"), "a"},
+				"obj":  map[string]any{"k": "v"},
+			},
+		},
+		{
+			name:  "string fallback",
+			pairs: []string{"s=hello", "empty=", "two=1 2", "eq=a=b"},
+			want:  map[string]any{"s": "hello", "empty": "", "two": "1 2", "eq": "a=b"},
+		},
+		{
+			name:  "override",
+			pairs: []string{"level=high"},
+			args:  map[string]any{"level": "low", "team": "platform"},
+			want:  map[string]any{"level": "high", "team": "platform"},
+		},
+		{
+			name:    "missing value",
+			pairs:   []string{"level"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseArgs(tt.pairs, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_ConfigRequiresMemoryDB(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	dbfile := filepath.Join(dir, "kobold.sqlite3")
+	for _, flag := range []string{"-config", "-confd"} {
+		args := []string{"decode", "-loglvl", "8", "-db", dbfile, flag, dir, "-decoder", "builtin.lines@v1"}
+		if err := run(context.Background(), args, nil, nil, io.Discard); err == nil {
+			t.Errorf("run() with %s and file db: expected error", flag)
+		}
+	}
+	if _, err := os.Stat(dbfile); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected db file to be untouched, got stat error %v", err)
+	}
+}
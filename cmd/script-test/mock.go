@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// a canned response for the requests, whose method and url match. The method
+// may be *. The url is matched with path.Match against host and path, i.e.
+// api.github.com/repos/*/*/pulls. A scheme and query are ignored.
+type mockResponse struct {
+	method  string
+	pattern string
+	status  int
+	body    []byte
+}
+
+// the http layer of scripts, in place of the network. It prints each request
+// and responds with the first matching mock. Requests without a matching mock
+// get a 404.
+type mockTransport struct {
+	mu        sync.Mutex
+	w         io.Writer
+	responses []mockResponse
+}
+
+// parse the mocks, each in the form 'METHOD URL STATUS [BODY]'. If the body
+// starts with @, it is read from the named file.
+func newMockTransport(specs []string, w io.Writer) (*mockTransport, error) {
+	t := &mockTransport{w: w}
+	for _, spec := range specs {
+		fields := strings.SplitN(strings.TrimSpace(spec), " ", 4)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("mock %q: expected 'METHOD URL STATUS [BODY]'", spec)
+		}
+
+		status, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("mock %q: invalid status: %w", spec, err)
+		}
+
+		pattern := stripURL(fields[1])
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("mock %q: %w", spec, err)
+		}
+
+		var body []byte
+		if len(fields) == 4 {
+			body = []byte(fields[3])
+			if file, ok := strings.CutPrefix(fields[3], "@"); ok {
+				if body, err = os.ReadFile(file); err != nil {
+					return nil, fmt.Errorf("mock %q: %w", spec, err)
+				}
+			}
+		}
+
+		t.responses = append(t.responses, mockResponse{
+			method:  strings.ToUpper(fields[0]),
+			pattern: pattern,
+			status:  status,
+			body:    body,
+		})
+	}
+	return t, nil
+}
+
+func (t *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = b
+	}
+
+	res, ok := t.match(req)
+	if !ok {
+		res = mockResponse{status: http.StatusNotFound, body: []byte(`{"message": "not mocked"}`)}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fmt.Fprintf(t.w, "> %s %s\n", req.Method, req.URL)
+	if len(reqBody) > 0 {
+		fmt.Fprintf(t.w, "%s\n", indent(reqBody))
+	}
+	if ok {
+		fmt.Fprintf(t.w, "< %d\n", res.status)
+	} else {
+		fmt.Fprintf(t.w, "< %d (not mocked)\n", res.status)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", res.status, http.StatusText(res.status)),
+		StatusCode:    res.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(res.body)),
+		ContentLength: int64(len(res.body)),
+		Request:       req,
+	}, nil
+}
+
+func (t *mockTransport) match(req *http.Request) (mockResponse, bool) {
+	target := req.URL.Host + req.URL.Path
+	for _, res := range t.responses {
+		if res.method != "*" && res.method != req.Method {
+			continue
+		}
+		if ok, _ := path.Match(res.pattern, target); ok {
+			return res, true
+		}
+	}
+	return mockResponse{}, false
+}
+
+func stripURL(s string) string {
+	if _, rest, ok := strings.Cut(s, "://"); ok {
+		s = rest
+	}
+	s, _, _ = strings.Cut(s, "?")
+	return s
+}
+
+func indent(b []byte) string {
+	return "  " + strings.ReplaceAll(strings.TrimRight(string(b), "\n"), "\n", "\n  ")
+}
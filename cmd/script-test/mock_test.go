@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewMockTransport(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "body.json")
+	if err := os.WriteFile(file, []byte(`{"number": 1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		spec    string
+		want    mockResponse
+		wantErr bool
+	}{
+		{
+			name: "body",
+			spec: `post https://api.github.com/repos/*/*/pulls?per_page=1 201 {"number": 1, "html_url": "x"}`,
+			want: mockResponse{method: "POST", pattern: "api.github.com/repos/*/*/pulls", status: 201, body: []byte(`{"number": 1, "html_url": "x"}`)},
+		},
+		{
+			name: "body file",
+			spec: "* gitlab.com/api/v4/* 200 @" + file,
+			want: mockResponse{method: "*", pattern: "gitlab.com/api/v4/*", status: 200, body: []byte(`{"number": 1}`)},
+		},
+		{
+			name: "no body",
+			spec: "DELETE example.com/hooks/1 204",
+			want: mockResponse{method: "DELETE", pattern: "example.com/hooks/1", status: 204},
+		},
+		{name: "missing status", spec: "GET example.com", wantErr: true},
+		{name: "invalid status", spec: "GET example.com ok", wantErr: true},
+		{name: "invalid pattern", spec: "GET example.com/[ 200", wantErr: true},
+		{name: "missing body file", spec: "GET example.com 200 @" + file + ".missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := newMockTransport([]string{tt.spec}, io.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newMockTransport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			res := got.responses[0]
+			if res.method != tt.want.method || res.pattern != tt.want.pattern || res.status != tt.want.status || !bytes.Equal(res.body, tt.want.body) {
+				t.Errorf("newMockTransport() = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func TestMockTransport_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	specs := []string{
+		`POST https://api.github.com/repos/*/*/pulls 201 {"number": 1}`,
+		`* api.github.com/repos/*/*/issues/*/labels 200 []`,
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		wantStatus int
+		wantBody   string
+		wantOut    string
+	}{
+		{
+			name:       "match",
+			method:     http.MethodPost,
+			url:        "https://api.github.com/repos/acme/app/pulls",
+			body:       "{\n\"title\": \"x\"\n}",
+			wantStatus: 201,
+			wantBody:   `{"number": 1}`,
+			wantOut:    "> POST https://api.github.com/repos/acme/app/pulls\n  {\n  \"title\": \"x\"\n  }\n< 201\n",
+		},
+		{
+			name:       "any method ignores query",
+			method:     http.MethodPut,
+			url:        "https://api.github.com/repos/acme/app/issues/1/labels?page=2",
+			wantStatus: 200,
+			wantBody:   `[]`,
+			wantOut:    "> PUT https://api.github.com/repos/acme/app/issues/1/labels?page=2\n< 200\n",
+		},
+		{
+			name:       "method mismatch",
+			method:     http.MethodGet,
+			url:        "https://api.github.com/repos/acme/app/pulls",
+			wantStatus: 404,
+			wantBody:   `{"message": "not mocked"}`,
+			wantOut:    "> GET https://api.github.com/repos/acme/app/pulls\n< 404 (not mocked)\n",
+		},
+		{
+			name:       "no nested match",
+			method:     http.MethodPost,
+			url:        "https://api.github.com/repos/acme/sub/app/pulls",
+			wantStatus: 404,
+			wantBody:   `{"message": "not mocked"}`,
+			wantOut:    "> POST https://api.github.com/repos/acme/sub/app/pulls\n< 404 (not mocked)\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			mock, err := newMockTransport(specs, &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+
+			req, err := http.NewRequest(tt.method, tt.url, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := mock.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.StatusCode != tt.wantStatus || string(b) != tt.wantBody {
+				t.Errorf("RoundTrip() = %d %s, want %d %s", res.StatusCode, b, tt.wantStatus, tt.wantBody)
+			}
+
+			if out.String() != tt.wantOut {
+				t.Errorf("output = %q, want %q", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
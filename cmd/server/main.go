@@ -51,7 +51,7 @@ func run(ctx context.Context, args []string, env []string) error {
 		prefix                   = ""
 	)
 
-	set.Var(&handler, "handler", "task handler, one of: print, kobold, error")
+	set.Var(&handler, "handler", "task handler, one of: print, kobold, error, or a registered handler")
 	set.StringVar(&webhookAddr, "addr-webhook", webhookAddr, "webhook listen address")
 	set.StringVar(&apiAddr, "addr-api", apiAddr, "api listen address")
 	set.IntVar(&maxprocs, "maxprocs", 10, "max number of concurrent runs")
@@ -71,6 +71,16 @@ func run(ctx context.Context, args []string, env []string) error {
 
 	g, ctx := errgroup.WithContext(ctx)
 	sched := task.NewScheduler(ctx, query, maxprocs)
+	sched.SetScriptLimits(opts.ScriptLimits)
+
+	cache := sched.Cache()
+	cache.SetDir(opts.GitCacheDir)
+	cache.SetMaxSize(opts.GitCacheMaxSize)
+	cache.SetTTL(opts.GitFetchTTL)
+
+	if err := cache.Load(ctx); err != nil {
+		return fmt.Errorf("load cache: %w", err)
+	}
 
 	g.Go(func() error {
 		sched.SetHandler(handler)
@@ -79,7 +89,7 @@ func run(ctx context.Context, args []string, env []string) error {
 
 	g.Go(func() error {
 		apmux := http.NewServeMux()
-		apmux.Handle(prefix+"/api/", http.StripPrefix(prefix+"/api", api.New(prefix+"/api", query)))
+		apmux.Handle(prefix+"/api/", http.StripPrefix(prefix+"/api", api.New(prefix+"/api", query, cache, sched)))
 		apmux.Handle(prefix+"/metrics", promhttp.Handler())
 		return listenAndServeContext(ctx, "api", apiAddr, apmux)
 	})
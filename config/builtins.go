@@ -13,6 +13,8 @@ func ApplyBuiltins(ctx context.Context, q *model.Queries) error {
 		if err := q.DecoderPut(ctx, model.DecoderPutParams{
 			Name:   d.Name,
 			Script: []byte(d.Script),
+			Env:    d.Env,
+			Hosts:  d.Hosts,
 		}); err != nil {
 			return fmt.Errorf("create decoder %q: %w", d.Name, err)
 		}
@@ -22,10 +24,23 @@ func ApplyBuiltins(ctx context.Context, q *model.Queries) error {
 		if err := q.PostHookPut(ctx, model.PostHookPutParams{
 			Name:   p.Name,
 			Script: []byte(p.Script),
+			Env:    p.Env,
+			Hosts:  p.Hosts,
 		}); err != nil {
 			return fmt.Errorf("create post hook %q: %w", p.Name, err)
 		}
 	}
 
+	for _, p := range builtin.PreCommits() {
+		if err := q.PreCommitPut(ctx, model.PreCommitPutParams{
+			Name:   p.Name,
+			Script: []byte(p.Script),
+			Env:    p.Env,
+			Hosts:  p.Hosts,
+		}); err != nil {
+			return fmt.Errorf("create pre commit hook %q: %w", p.Name, err)
+		}
+	}
+
 	return nil
 }
@@ -2,84 +2,504 @@ package config
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
 
 	"github.com/bluebrown/kobold/git"
+	"github.com/bluebrown/kobold/plugin"
+	"github.com/bluebrown/kobold/scm"
+	"github.com/bluebrown/kobold/store"
 	"github.com/bluebrown/kobold/store/model"
+	"github.com/bluebrown/kobold/task"
 	"github.com/volatiletech/null/v8"
 )
 
+// the host env variables and secrets, a script is allowed to see as host_env,
+// and the hosts it may reach over http. The env and hosts may contain
+// patterns, such as GITHUB_* or *.github.com. The secrets map a name to a
+// file, whose content is read when the script runs. A script entry without
+// script or script file, extends the existing script of the same name, i.e. a
+// builtin.
+type HostEnv struct {
+	Env     []string          `toml:"env"`
+	Secrets map[string]string `toml:"secrets"`
+	Hosts   []string          `toml:"hosts"`
+}
+
+// return the host env of an existing script, extended by h.
+func (h HostEnv) extend(env []string, secrets map[string]string, hosts []string) HostEnv {
+	out := HostEnv{
+		Env:     union(env, h.Env),
+		Secrets: make(map[string]string, len(secrets)+len(h.Secrets)),
+		Hosts:   union(hosts, h.Hosts),
+	}
+	for k, v := range secrets {
+		out.Secrets[k] = v
+	}
+	for k, v := range h.Secrets {
+		out.Secrets[k] = v
+	}
+	return out
+}
+
+func union(a, b []string) []string {
+	out := append([]string(nil), a...)
+	for _, s := range b {
+		if !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
 type Decoder struct {
-	Name   string `toml:"name"`
-	Script string `toml:"script"`
+	Name       string `toml:"name"`
+	Script     string `toml:"script"`
+	ScriptFile string `toml:"script_file"`
+	HostEnv
 }
 
+// the decoder args are passed to the decoder as keyword arguments.
 type Channel struct {
-	Name    string `toml:"name"`
-	Decoder string `toml:"decoder"`
+	Name        string         `toml:"name"`
+	Decoder     string         `toml:"decoder"`
+	DecoderArgs map[string]any `toml:"decoder_args"`
 }
 
 type PostHook struct {
-	Name   string `toml:"name"`
-	Script string `toml:"script"`
+	Name       string `toml:"name"`
+	Script     string `toml:"script"`
+	ScriptFile string `toml:"script_file"`
+	HostEnv
+}
+
+// a pre commit hook runs before the changes of a pipeline are committed. It
+// can reject the run, or drop individual changes.
+type PreCommit struct {
+	Name       string `toml:"name"`
+	Script     string `toml:"script"`
+	ScriptFile string `toml:"script_file"`
+	HostEnv
+}
+
+// a credential is used by pipelines to authenticate against their git
+// remote. Either an ssh key or a username with a password file can be used.
+// Tokens are used as password. Secrets are referenced by file, so that they
+// are never stored in the database.
+type Credential struct {
+	Name              string `toml:"name"`
+	SSHKeyFile        string `toml:"ssh_key_file"`
+	SSHKnownHostsFile string `toml:"ssh_known_hosts_file"`
+	Username          string `toml:"username"`
+	PasswordFile      string `toml:"password_file"`
+}
+
+// an identity is used by pipelines to author and commit their changes. The
+// committer defaults to the author. If a signing key file is set, commits are
+// signed with it, using the signing format ssh (default) or openpgp.
+type Identity struct {
+	Name           string `toml:"name"`
+	AuthorName     string `toml:"author_name"`
+	AuthorEmail    string `toml:"author_email"`
+	CommitterName  string `toml:"committer_name"`
+	CommitterEmail string `toml:"committer_email"`
+	SigningFormat  string `toml:"signing_format"`
+	SigningKeyFile string `toml:"signing_key_file"`
 }
 
+// a pull request is opened natively, after the changes have been pushed to the
+// dest branch of a pipeline. The provider is detected from well known hosts, if
+// not set. The api url is derived from the repo uri, unless set. The password
+// file of the credential is used as api token. It defaults to the credential
+// of the pipeline.
+type PullRequest struct {
+	Provider   string `toml:"provider"`
+	APIURL     string `toml:"api_url"`
+	Credential string `toml:"credential"`
+}
+
+// the options of the pull request of a pipeline. They are honored by the
+// native pull request and passed to post hooks as pr_options. Auto merge is
+// the merge method: merge, squash or rebase.
+type PullRequestOptions struct {
+	Labels        []string `toml:"labels"`
+	Reviewers     []string `toml:"reviewers"`
+	TeamReviewers []string `toml:"team_reviewers"`
+	Draft         bool     `toml:"draft"`
+	AutoMerge     string   `toml:"auto_merge"`
+}
+
+// a post hook in the chain of a pipeline. On is the status of the run, that
+// is required to run the hook: success (default), failure or always. The args
+// are passed to the hook as keyword arguments.
+type PipelinePostHook struct {
+	Name string         `toml:"name"`
+	On   string         `toml:"on"`
+	Args map[string]any `toml:"args"`
+}
+
+// the commit title and body are go templates, rendered with the pipeline
+// name, the run fingerprint, the task ids and the changes of a run. The post
+// hook args are passed to the post hook as keyword arguments. The post hook
+// runs on success, before the post hooks of the chain. The pre commit hook runs
+// before the changes are committed. If the label selector is set, only events
+// with all of its labels are passed to the pipeline.
 type Pipeline struct {
-	Name       string         `toml:"name"`
-	RepoURI    git.PackageURI `toml:"repo_uri"`
-	DestBranch string         `toml:"dest_branch"`
-	Channels   []string       `toml:"channels"`
-	PostHook   string         `toml:"post_hook"`
+	Name         string             `toml:"name"`
+	RepoURI      git.PackageURI     `toml:"repo_uri"`
+	DestBranch   string             `toml:"dest_branch"`
+	Channels     []string           `toml:"channels"`
+	PostHook     string             `toml:"post_hook"`
+	Credential   string             `toml:"credential"`
+	Identity     string             `toml:"identity"`
+	CommitTitle  string             `toml:"commit_title"`
+	CommitBody   string             `toml:"commit_body"`
+	PullRequest  *PullRequest       `toml:"pull_request"`
+	PROptions    PullRequestOptions `toml:"pr_options"`
+	PostHookArgs map[string]any     `toml:"post_hook_args"`
+	PostHooks    []PipelinePostHook `toml:"post_hooks"`
+	PreCommit    string             `toml:"pre_commit"`
+
+	LabelSelector map[string]string `toml:"label_selector"`
+}
+
+// a library is a starlark module, that decoders and hooks can load as
+// lib/<name>, i.e. load("lib/auth.star", "bearer"). The name is a slash
+// separated path ending in .star.
+type Library struct {
+	Name       string `toml:"name"`
+	Script     string `toml:"script"`
+	ScriptFile string `toml:"script_file"`
 }
 
+// the script files and the library dir are relative to the config file, they
+// are declared in. Each .star file below the library dir is a library, named
+// by its path relative to the dir. Libraries declared explicitly take
+// precedence.
 type Config struct {
-	Version   string     `toml:"version"`
-	Channels  []Channel  `toml:"channel"`
-	Pipelines []Pipeline `toml:"pipeline"`
-	PostHooks []PostHook `toml:"post_hook"`
-	Decoders  []Decoder  `toml:"decoder"`
+	Version     string       `toml:"version"`
+	Channels    []Channel    `toml:"channel"`
+	Pipelines   []Pipeline   `toml:"pipeline"`
+	PostHooks   []PostHook   `toml:"post_hook"`
+	PreCommits  []PreCommit  `toml:"pre_commit"`
+	Decoders    []Decoder    `toml:"decoder"`
+	Credentials []Credential `toml:"credential"`
+	Identities  []Identity   `toml:"identity"`
+	LibraryDir  string       `toml:"library_dir"`
+	Libraries   []Library    `toml:"library"`
+}
+
+// make the relative script files and the library dir absolute, by joining
+// them with dir.
+func (cfg *Config) resolvePaths(dir string) {
+	resolve := func(p *string) {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	for i := range cfg.Decoders {
+		resolve(&cfg.Decoders[i].ScriptFile)
+	}
+	for i := range cfg.PostHooks {
+		resolve(&cfg.PostHooks[i].ScriptFile)
+	}
+	for i := range cfg.PreCommits {
+		resolve(&cfg.PreCommits[i].ScriptFile)
+	}
+	for i := range cfg.Libraries {
+		resolve(&cfg.Libraries[i].ScriptFile)
+	}
+	resolve(&cfg.LibraryDir)
+}
+
+// return the inlined script, or the content of the script file.
+func readScript(script, file string) ([]byte, error) {
+	if script != "" && file != "" {
+		return nil, errors.New("script and script_file are mutually exclusive")
+	}
+	if file == "" {
+		return []byte(script), nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read script file: %w", err)
+	}
+	return b, nil
+}
+
+// read the libraries below the library dir, and those declared explicitly.
+func (cfg *Config) libraries() (map[string][]byte, error) {
+	libs := make(map[string][]byte)
+
+	if cfg.LibraryDir != "" {
+		err := filepath.WalkDir(cfg.LibraryDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || filepath.Ext(path) != ".star" {
+				return err
+			}
+			rel, err := filepath.Rel(cfg.LibraryDir, path)
+			if err != nil {
+				return err
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			libs[filepath.ToSlash(rel)] = b
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("library dir: %w", err)
+		}
+	}
+
+	for _, l := range cfg.Libraries {
+		if l.Script == "" && l.ScriptFile == "" {
+			return nil, fmt.Errorf("library %q: no script", l.Name)
+		}
+		script, err := readScript(l.Script, l.ScriptFile)
+		if err != nil {
+			return nil, fmt.Errorf("library %q: %w", l.Name, err)
+		}
+		libs[l.Name] = script
+	}
+
+	return libs, nil
 }
 
 func (cfg *Config) Apply(ctx context.Context, q *model.Queries) error {
+	libs, err := cfg.libraries()
+	if err != nil {
+		return err
+	}
+
+	for name, script := range libs {
+		if err := plugin.CheckLibraryName(name); err != nil {
+			return err
+		}
+		if err := q.LibraryPut(ctx, model.LibraryPutParams{Name: name, Script: script}); err != nil {
+			return fmt.Errorf("create library %q: %w", name, err)
+		}
+	}
+
 	for _, d := range cfg.Decoders {
+		if plugin.IsNative(d.Name) {
+			return fmt.Errorf("decoder %q: prefix %q is reserved for native plugins", d.Name, plugin.NativePrefix)
+		}
+		script, err := readScript(d.Script, d.ScriptFile)
+		if err != nil {
+			return fmt.Errorf("decoder %q: %w", d.Name, err)
+		}
+		env := d.HostEnv
+		if d.Script == "" && d.ScriptFile == "" {
+			base, err := q.DecoderGet(ctx, d.Name)
+			if err != nil {
+				return fmt.Errorf("decoder %q: no script: %w", d.Name, err)
+			}
+			script, env = base.Script, env.extend(base.Env, base.Secrets, base.Hosts)
+		}
+		if err := plugin.CheckHostEnv(env.Env, env.Secrets, env.Hosts); err != nil {
+			return fmt.Errorf("decoder %q: %w", d.Name, err)
+		}
 		if err := q.DecoderPut(ctx, model.DecoderPutParams{
-			Name:   d.Name,
-			Script: []byte(d.Script),
+			Name:    d.Name,
+			Script:  script,
+			Env:     env.Env,
+			Secrets: env.Secrets,
+			Hosts:   env.Hosts,
 		}); err != nil {
 			return fmt.Errorf("create decoder %q: %w", d.Name, err)
 		}
 	}
 
 	for _, p := range cfg.PostHooks {
+		if plugin.IsNative(p.Name) {
+			return fmt.Errorf("post hook %q: prefix %q is reserved for native plugins", p.Name, plugin.NativePrefix)
+		}
+		script, err := readScript(p.Script, p.ScriptFile)
+		if err != nil {
+			return fmt.Errorf("post hook %q: %w", p.Name, err)
+		}
+		env := p.HostEnv
+		if p.Script == "" && p.ScriptFile == "" {
+			base, err := q.PostHookGet(ctx, p.Name)
+			if err != nil {
+				return fmt.Errorf("post hook %q: no script: %w", p.Name, err)
+			}
+			script, env = base.Script, env.extend(base.Env, base.Secrets, base.Hosts)
+		}
+		if err := plugin.CheckHostEnv(env.Env, env.Secrets, env.Hosts); err != nil {
+			return fmt.Errorf("post hook %q: %w", p.Name, err)
+		}
 		if err := q.PostHookPut(ctx, model.PostHookPutParams{
-			Name:   p.Name,
-			Script: []byte(p.Script),
+			Name:    p.Name,
+			Script:  script,
+			Env:     env.Env,
+			Secrets: env.Secrets,
+			Hosts:   env.Hosts,
 		}); err != nil {
 			return fmt.Errorf("create post hook %q: %w", p.Name, err)
 		}
 	}
 
+	for _, p := range cfg.PreCommits {
+		if plugin.IsNative(p.Name) {
+			return fmt.Errorf("pre commit hook %q: prefix %q is reserved for native plugins", p.Name, plugin.NativePrefix)
+		}
+		script, err := readScript(p.Script, p.ScriptFile)
+		if err != nil {
+			return fmt.Errorf("pre commit hook %q: %w", p.Name, err)
+		}
+		env := p.HostEnv
+		if p.Script == "" && p.ScriptFile == "" {
+			base, err := q.PreCommitGet(ctx, p.Name)
+			if err != nil {
+				return fmt.Errorf("pre commit hook %q: no script: %w", p.Name, err)
+			}
+			script, env = base.Script, env.extend(base.Env, base.Secrets, base.Hosts)
+		}
+		if err := plugin.CheckHostEnv(env.Env, env.Secrets, env.Hosts); err != nil {
+			return fmt.Errorf("pre commit hook %q: %w", p.Name, err)
+		}
+		if err := q.PreCommitPut(ctx, model.PreCommitPutParams{
+			Name:    p.Name,
+			Script:  script,
+			Env:     env.Env,
+			Secrets: env.Secrets,
+			Hosts:   env.Hosts,
+		}); err != nil {
+			return fmt.Errorf("create pre commit hook %q: %w", p.Name, err)
+		}
+	}
+
+	for _, c := range cfg.Credentials {
+		if err := q.CredentialPut(ctx, model.CredentialPutParams{
+			Name:              c.Name,
+			SshKeyFile:        null.NewString(c.SSHKeyFile, c.SSHKeyFile != ""),
+			SshKnownHostsFile: null.NewString(c.SSHKnownHostsFile, c.SSHKnownHostsFile != ""),
+			Username:          null.NewString(c.Username, c.Username != ""),
+			PasswordFile:      null.NewString(c.PasswordFile, c.PasswordFile != ""),
+		}); err != nil {
+			return fmt.Errorf("create credential %q: %w", c.Name, err)
+		}
+	}
+
+	for _, i := range cfg.Identities {
+		if err := q.IdentityPut(ctx, model.IdentityPutParams{
+			Name:           i.Name,
+			AuthorName:     null.NewString(i.AuthorName, i.AuthorName != ""),
+			AuthorEmail:    null.NewString(i.AuthorEmail, i.AuthorEmail != ""),
+			CommitterName:  null.NewString(i.CommitterName, i.CommitterName != ""),
+			CommitterEmail: null.NewString(i.CommitterEmail, i.CommitterEmail != ""),
+			SigningFormat:  null.NewString(i.SigningFormat, i.SigningFormat != ""),
+			SigningKeyFile: null.NewString(i.SigningKeyFile, i.SigningKeyFile != ""),
+		}); err != nil {
+			return fmt.Errorf("create identity %q: %w", i.Name, err)
+		}
+	}
+
 	for _, c := range cfg.Channels {
-		ch := model.ChannelPutParams{Name: c.Name, DecoderName: null.NewString(c.Decoder, c.Decoder != "")}
+		if err := plugin.CheckArgs(c.DecoderArgs); err != nil {
+			return fmt.Errorf("channel %q: decoder args: %w", c.Name, err)
+		}
+		if _, ok := plugin.LookupDecoder(c.Decoder); plugin.IsNative(c.Decoder) && !ok {
+			return fmt.Errorf("channel %q: decoder %q is not registered", c.Name, c.Decoder)
+		}
+
+		ch := model.ChannelPutParams{
+			Name:        c.Name,
+			DecoderName: null.NewString(c.Decoder, c.Decoder != ""),
+			DecoderArgs: store.Args(c.DecoderArgs),
+		}
 		if err := q.ChannelPut(ctx, ch); err != nil {
 			return fmt.Errorf("create channel %q: %w", c.Name, err)
 		}
 	}
 
+	if err := checkRepoCredentials(cfg.Pipelines); err != nil {
+		return err
+	}
+
 	for _, p := range cfg.Pipelines {
+		for name, text := range map[string]string{"title": p.CommitTitle, "body": p.CommitBody} {
+			if _, err := task.ParseCommitTemplate(name, text); err != nil {
+				return fmt.Errorf("pipeline %q: commit %s: %w", p.Name, name, err)
+			}
+		}
+
+		var pr PullRequest
+		if p.PullRequest != nil {
+			var err error
+			if pr, err = p.pullRequest(); err != nil {
+				return fmt.Errorf("pipeline %q: pull request: %w", p.Name, err)
+			}
+		}
+
+		o := p.PROptions
+		if err := scm.CheckOptions(pr.Provider, scm.Options(o)); err != nil {
+			return fmt.Errorf("pipeline %q: pr options: %w", p.Name, err)
+		}
+
+		if plugin.IsNative(p.PreCommit) {
+			return fmt.Errorf("pipeline %q: pre commit hook %q: native pre commit hooks are not supported", p.Name, p.PreCommit)
+		}
+
+		hooks := p.postHooks()
+		for i, h := range hooks {
+			switch h.On {
+			case "success", "failure", "always":
+			default:
+				return fmt.Errorf("pipeline %q: post hook %d %q: unknown on %q", p.Name, i, h.Name, h.On)
+			}
+			if err := plugin.CheckArgs(h.Args, plugin.PostHookKwargs...); err != nil {
+				return fmt.Errorf("pipeline %q: post hook %d %q: args: %w", p.Name, i, h.Name, err)
+			}
+			if _, ok := plugin.LookupPostHook(h.Name); plugin.IsNative(h.Name) && !ok {
+				return fmt.Errorf("pipeline %q: post hook %d %q: not registered", p.Name, i, h.Name)
+			}
+		}
+
 		if err := q.PipelinePut(ctx, model.PipelinePutParams{
-			Name:         p.Name,
-			RepoUri:      p.RepoURI,
-			DestBranch:   null.NewString(p.DestBranch, p.DestBranch != ""),
-			PostHookName: null.NewString(p.PostHook, p.PostHook != ""),
+			Name:             p.Name,
+			RepoUri:          p.RepoURI,
+			DestBranch:       null.NewString(p.DestBranch, p.DestBranch != ""),
+			CredentialName:   null.NewString(p.Credential, p.Credential != ""),
+			IdentityName:     null.NewString(p.Identity, p.Identity != ""),
+			CommitTitle:      null.NewString(p.CommitTitle, p.CommitTitle != ""),
+			CommitBody:       null.NewString(p.CommitBody, p.CommitBody != ""),
+			PrProvider:       null.NewString(pr.Provider, pr.Provider != ""),
+			PrApiUrl:         null.NewString(pr.APIURL, pr.APIURL != ""),
+			PrCredentialName: null.NewString(pr.Credential, pr.Credential != ""),
+			PrLabels:         store.FlatList(o.Labels),
+			PrReviewers:      store.FlatList(o.Reviewers),
+			PrTeamReviewers:  store.FlatList(o.TeamReviewers),
+			PrDraft:          null.NewBool(o.Draft, o.Draft),
+			PrAutoMerge:      null.NewString(o.AutoMerge, o.AutoMerge != ""),
+			PreCommitName:    null.NewString(p.PreCommit, p.PreCommit != ""),
 		}); err != nil {
 			return fmt.Errorf("create pipeline %q: %w", p.Name, err)
 		}
 
+		for i, h := range hooks {
+			if err := q.PipelinePostHookPut(ctx, model.PipelinePostHookPutParams{
+				PipelineName: p.Name,
+				Position:     int64(i),
+				PostHookName: h.Name,
+				RunOn:        h.On,
+				Args:         store.Args(h.Args),
+			}); err != nil {
+				return fmt.Errorf("create post hook %d %q of pipeline %q: %w", i, h.Name, p.Name, err)
+			}
+		}
+
 		for _, c := range p.Channels {
 			if err := q.SubscriptionPut(ctx, model.SubscriptionPutParams{
-				PipelineName: p.Name,
-				ChannelName:  c,
+				PipelineName:  p.Name,
+				ChannelName:   c,
+				LabelSelector: store.FlatMap(p.LabelSelector),
 			}); err != nil {
 				return fmt.Errorf("create subscription %q=>%q: %w", p.Name, c, err)
 			}
@@ -88,3 +508,65 @@ func (cfg *Config) Apply(ctx context.Context, q *model.Queries) error {
 
 	return nil
 }
+
+// the post hook chain of the pipeline. The post hook comes first, and runs on
+// success. The on condition defaults to success.
+func (p *Pipeline) postHooks() []PipelinePostHook {
+	var hooks []PipelinePostHook
+	if p.PostHook != "" {
+		hooks = append(hooks, PipelinePostHook{Name: p.PostHook, Args: p.PostHookArgs})
+	}
+
+	hooks = append(hooks, p.PostHooks...)
+	for i := range hooks {
+		if hooks[i].On == "" {
+			hooks[i].On = "success"
+		}
+	}
+
+	return hooks
+}
+
+// check that all pipelines of a repo use the same credential. The repo is
+// cloned once and fetched with a single credential, regardless of how many
+// pipelines use it.
+func checkRepoCredentials(pipelines []Pipeline) error {
+	seen := make(map[string]Pipeline, len(pipelines))
+	for _, p := range pipelines {
+		prev, ok := seen[p.RepoURI.Repo]
+		if !ok {
+			seen[p.RepoURI.Repo] = p
+			continue
+		}
+		if prev.Credential != p.Credential {
+			return fmt.Errorf("pipeline %q: credential %q conflicts with credential %q of pipeline %q for repo %q",
+				p.Name, p.Credential, prev.Credential, prev.Name, p.RepoURI.Repo)
+		}
+	}
+	return nil
+}
+
+// validate the pull request of the pipeline, and detect its provider, if not
+// set.
+func (p *Pipeline) pullRequest() (PullRequest, error) {
+	pr := *p.PullRequest
+
+	if p.DestBranch == "" {
+		return pr, fmt.Errorf("dest_branch is required")
+	}
+
+	repo, err := scm.ParseRepo(p.RepoURI.Repo)
+	if err != nil {
+		return pr, err
+	}
+
+	if pr.Provider == "" {
+		pr.Provider = scm.DetectProvider(repo.Host)
+	}
+
+	if _, err := scm.New(scm.Config{Provider: pr.Provider}); err != nil {
+		return pr, fmt.Errorf("%w, set the provider for host %q", err, repo.Host)
+	}
+
+	return pr, nil
+}
@@ -3,12 +3,17 @@ package config
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"path/filepath"
 	"reflect"
 	"testing"
 
 	"github.com/BurntSushi/toml"
 	"github.com/bluebrown/kobold/git"
+	"github.com/bluebrown/kobold/store"
+	"github.com/bluebrown/kobold/store/model"
+	"github.com/bluebrown/kobold/store/schema"
 )
 
 func TestReadDir(t *testing.T) {
@@ -34,6 +39,15 @@ func TestReadDir(t *testing.T) {
 				}},
 			},
 		},
+		{
+			givePath: "scripts",
+			wantConfig: &Config{
+				Version:    "2",
+				LibraryDir: abs(t, "testdata/scripts/lib"),
+				Decoders:   []Decoder{{Name: "lines", ScriptFile: abs(t, "testdata/scripts/decoders/lines.star")}},
+				Libraries:  []Library{{Name: "refs.star", Script: "def valid(ref):\n    return ref != \"\"\n"}},
+			},
+		},
 		{
 			givePath: "symlinks",
 			wantConfig: &Config{
@@ -71,3 +85,129 @@ func TestReadDir(t *testing.T) {
 		})
 	}
 }
+
+func abs(t *testing.T, path string) string {
+	t.Helper()
+	p, err := filepath.Abs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestCheckRepoCredentials(t *testing.T) {
+	t.Parallel()
+	pipeline := func(name, repo, credential string) Pipeline {
+		return Pipeline{Name: name, RepoURI: git.PackageURI{Repo: repo, Ref: name}, Credential: credential}
+	}
+	tests := []struct {
+		name      string
+		pipelines []Pipeline
+		wantErr   bool
+	}{
+		{
+			name: "same credential",
+			pipelines: []Pipeline{
+				pipeline("a", "https://github.com/acme/app.git", "github"),
+				pipeline("b", "https://github.com/acme/app.git", "github"),
+			},
+		},
+		{
+			name: "different repos",
+			pipelines: []Pipeline{
+				pipeline("a", "https://github.com/acme/app.git", "github"),
+				pipeline("b", "https://github.com/acme/lib.git", "other"),
+			},
+		},
+		{
+			name: "conflicting credential",
+			pipelines: []Pipeline{
+				pipeline("a", "https://github.com/acme/app.git", "github"),
+				pipeline("b", "https://github.com/acme/app.git", "other"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "credential and none",
+			pipelines: []Pipeline{
+				pipeline("a", "https://github.com/acme/app.git", ""),
+				pipeline("b", "https://github.com/acme/app.git", "github"),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if err := checkRepoCredentials(tt.pipelines); (err != nil) != tt.wantErr {
+				t.Errorf("checkRepoCredentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApply_LegacyPostHook(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	for _, s := range [][]byte{schema.TaskSchema, schema.ReadSchema} {
+		if _, err := db.ExecContext(ctx, string(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q := model.New(db)
+
+	cfg := Config{
+		Channels:  []Channel{{Name: "registry"}},
+		PostHooks: []PostHook{{Name: "legacy", Script: "def main(): pass"}, {Name: "notify", Script: "def main(): pass"}},
+		Pipelines: []Pipeline{{
+			Name:         "app",
+			RepoURI:      git.PackageURI{Repo: "https://github.com/acme/app.git", Ref: "main"},
+			Channels:     []string{"registry"},
+			PostHook:     "legacy",
+			PostHookArgs: map[string]any{"level": "high"},
+			PostHooks:    []PipelinePostHook{{Name: "notify", On: "failure"}},
+		}},
+	}
+
+	if err := cfg.Apply(ctx, q); err != nil {
+		t.Fatal(err)
+	}
+
+	// the legacy post hook is only stored as first hook of the chain
+	hooks, err := q.PipelinePostHookList(ctx, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, h := range hooks {
+		got = append(got, h.PostHookName+":"+h.RunOn)
+	}
+
+	if want := []string{"legacy:success", "notify:failure"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("chain = %v, want %v", got, want)
+	}
+
+	if want := (store.Args{"level": "high"}); !reflect.DeepEqual(hooks[0].Args, want) {
+		t.Errorf("legacy args = %v, want %v", hooks[0].Args, want)
+	}
+
+	p, err := q.PipelineGet(ctx, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.PostHookName.Valid || p.PostHookArgs != nil {
+		t.Errorf("pipeline post hook = %v %v, want none", p.PostHookName, p.PostHookArgs)
+	}
+}
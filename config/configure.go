@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net/url"
+	"strings"
 
 	"github.com/bluebrown/kobold/store/model"
 	ksql "github.com/bluebrown/kobold/store/schema"
@@ -28,10 +29,8 @@ func Configure(ctx context.Context, opts Options, schemas ...[]byte) (*model.Que
 		schemas = append(schemas, ksql.CleanConfig)
 	}
 
-	for _, schema := range schemas {
-		if _, err := db.ExecContext(ctx, string(schema)); err != nil {
-			return nil, fmt.Errorf("create schema: %w", err)
-		}
+	if err := migrate(ctx, db, schemas...); err != nil {
+		return nil, fmt.Errorf("migrate schema: %w", err)
 	}
 
 	model := model.New(db)
@@ -64,3 +63,192 @@ func Configure(ctx context.Context, opts Options, schemas ...[]byte) (*model.Que
 func query(prags []string) string {
 	return (url.Values{"_pragma": prags}).Encode()
 }
+
+// a migration adds columns to the tables of a database, created by an older
+// version. Each column is given as table and column definition.
+type migration [][2]string
+
+// the migrations, in order. The version of a database is the number of
+// migrations applied to it, and stored as its user_version. New tables and
+// views are created by the schemas, so migrations only alter existing tables.
+// Append to this list, whenever a column is added to an existing table, or a
+// view changes, since views are only recreated, if migrations are pending.
+var migrations = []migration{
+	// the credentials of pipelines
+	{
+		{"pipeline", "credential_name text"},
+		{"task", "credential_name text"},
+	},
+	// the commit identities of pipelines, and the signing key of runs
+	{
+		{"pipeline", "identity_name text"},
+		{"task", "identity_name text"},
+		{"task", "signing_key_fingerprint text"},
+	},
+	// the commit templates of pipelines, and the pipeline of tasks
+	{
+		{"pipeline", "commit_title text"},
+		{"pipeline", "commit_body text"},
+		{"task", "pipeline_name text"},
+	},
+	// the commit, pushed branch and post hook outputs of runs
+	{
+		{"task", "commit_sha text"},
+		{"task", "pushed_branch text"},
+		{"task", "hook_outputs text"},
+	},
+	// the post hook stage of runs
+	{
+		{"task", "commit_msg text"},
+		{"task", "changes text"},
+		{"task", "hook_status text check (hook_status in ('pending', 'running', 'success', 'failure'))"},
+		{"task", "hook_error text"},
+		{"task", "hook_attempts integer not null default 0"},
+	},
+	// the native pull requests of pipelines
+	{
+		{"pipeline", "pr_provider text check (pr_provider in ('github', 'gitlab', 'gitea', 'bitbucket', 'azure'))"},
+		{"pipeline", "pr_api_url text"},
+		{"pipeline", "pr_credential_name text"},
+	},
+	// the pull request options of pipelines
+	{
+		{"pipeline", "pr_labels text"},
+		{"pipeline", "pr_reviewers text"},
+		{"pipeline", "pr_team_reviewers text"},
+		{"pipeline", "pr_draft boolean"},
+		{"pipeline", "pr_auto_merge text check (pr_auto_merge in ('merge', 'squash', 'rebase'))"},
+	},
+	// the script args of channels and pipelines
+	{
+		{"channel", "decoder_args text"},
+		{"pipeline", "post_hook_args text"},
+	},
+	// the post hook results of runs
+	{
+		{"task", "hook_results text"},
+	},
+	// the pre commit hooks of pipelines
+	{
+		{"pipeline", "pre_commit_name text"},
+	},
+	// the host env of scripts
+	{
+		{"decoder", "env text"},
+		{"decoder", "secrets text"},
+		{"post_hook", "env text"},
+		{"post_hook", "secrets text"},
+		{"pre_commit", "env text"},
+		{"pre_commit", "secrets text"},
+	},
+	// the hosts of scripts
+	{
+		{"decoder", "hosts text"},
+		{"post_hook", "hosts text"},
+		{"pre_commit", "hosts text"},
+	},
+	// the events of tasks, and the label selector of subscriptions
+	{
+		{"task", "events text"},
+		{"subscription", "label_selector text"},
+	},
+	// the task group view, without the legacy post hook of tasks
+	{},
+}
+
+// bring the database up to date, and apply the schemas. If migrations are
+// pending, the views are dropped, since they are bound to the columns of the
+// tables, and recreated by the schemas. Columns that exist already, are
+// skipped, so that databases of unreleased versions migrate too.
+func migrate(ctx context.Context, db *sql.DB, schemas ...[]byte) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var version int
+	if err := tx.QueryRowContext(ctx, "pragma user_version").Scan(&version); err != nil {
+		return fmt.Errorf("get user version: %w", err)
+	}
+
+	if version < len(migrations) {
+		if err := dropViews(ctx, tx); err != nil {
+			return err
+		}
+		for _, m := range migrations[version:] {
+			for _, c := range m {
+				if err := addColumn(ctx, tx, c[0], c[1]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, schema := range schemas {
+		if _, err := tx.ExecContext(ctx, string(schema)); err != nil {
+			return fmt.Errorf("create schema: %w", err)
+		}
+	}
+
+	if version < len(migrations) {
+		slog.InfoContext(ctx, "db migrated", "from", version, "to", len(migrations))
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("pragma user_version = %d", len(migrations))); err != nil {
+			return fmt.Errorf("set user version: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func dropViews(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "select name from sqlite_master where type = 'view'")
+	if err != nil {
+		return fmt.Errorf("list views: %w", err)
+	}
+
+	var views []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("list views: %w", err)
+		}
+		views = append(views, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("list views: %w", err)
+	}
+
+	for _, v := range views {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("drop view if exists %q", v)); err != nil {
+			return fmt.Errorf("drop view %q: %w", v, err)
+		}
+	}
+
+	return nil
+}
+
+// add the column to the table, unless the table does not exist yet, or has the
+// column already.
+func addColumn(ctx context.Context, tx *sql.Tx, table, def string) error {
+	name, _, _ := strings.Cut(def, " ")
+
+	var columns, exists int
+	if err := tx.QueryRowContext(ctx,
+		"select count(*), ifnull(sum(name = ?), 0) from pragma_table_info(?)", name, table,
+	).Scan(&columns, &exists); err != nil {
+		return fmt.Errorf("get columns of %q: %w", table, err)
+	}
+
+	if columns == 0 || exists > 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("alter table %s add column %s", table, def)); err != nil {
+		return fmt.Errorf("add column %q to %q: %w", name, table, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluebrown/kobold/store"
+	"github.com/bluebrown/kobold/store/model"
+	"github.com/bluebrown/kobold/store/schema"
+)
+
+func init() {
+	store.MustMakeUUID()
+	store.MustMakeSha1()
+}
+
+func TestConfigure_Migrate(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx    = context.Background()
+		dbfile = filepath.Join(t.TempDir(), "kobold.sqlite3")
+	)
+
+	baseline, err := os.ReadFile("testdata/migrate/baseline.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", "file:"+dbfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, stmt := range []string{
+		string(baseline),
+		`insert into channel (name) values ('foo')`,
+		`insert into pipeline (name, repo_uri) values ('bar', 'https://github.com/acme/app.git?ref=main')`,
+		`insert into subscription (pipeline_name, channel_name) values ('bar', 'foo')`,
+		`insert into task (msgs, repo_uri, timestamp) values ('["busybox:1.0"]', 'https://github.com/acme/app.git?ref=main', datetime('now'))`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := NewOptions()
+	opts.dbfile, opts.W = dbfile, io.Discard
+
+	// configure twice, to see that a migrated database is left as is
+	var q *model.Queries
+	for i := 0; i < 2; i++ {
+		if q, err = Configure(ctx, *opts, schema.TaskSchema, schema.ReadSchema); err != nil {
+			t.Fatalf("Configure() attempt %d: %v", i, err)
+		}
+	}
+
+	if _, err := q.TasksAppend(ctx, model.TasksAppendParams{
+		Events: store.EventList{{Ref: "busybox:1.1", Action: store.ActionPush}},
+		Name:   "foo",
+	}); err != nil {
+		t.Fatalf("TasksAppend() error = %v", err)
+	}
+
+	groups, err := q.TaskGroupsListPending(ctx)
+	if err != nil {
+		t.Fatalf("TaskGroupsListPending() error = %v", err)
+	}
+
+	var tasks int
+	for _, g := range groups {
+		tasks += len(g.TaskIds)
+	}
+
+	if tasks != 2 {
+		t.Errorf("TaskGroupsListPending() got %d tasks, want 2", tasks)
+	}
+
+	if _, err := q.RunList(ctx, model.RunListParams{Status: []string{"pending"}, Limit: 10}); err != nil {
+		t.Errorf("RunList() error = %v", err)
+	}
+}
@@ -11,7 +11,10 @@ func MakeConfig(oldConf *old.Config) (*config.Config, error) {
 	newConf.Version = oldConf.Version
 
 	for _, oldChannel := range oldConf.Channels {
-		newConf.Channels = append(newConf.Channels, config.Channel(oldChannel))
+		newConf.Channels = append(newConf.Channels, config.Channel{
+			Name:    oldChannel.Name,
+			Decoder: oldChannel.Decoder,
+		})
 	}
 
 	for _, oldPipeline := range oldConf.Pipelines {
@@ -25,11 +28,17 @@ func MakeConfig(oldConf *old.Config) (*config.Config, error) {
 	}
 
 	for _, oldPostHook := range oldConf.PostHooks {
-		newConf.PostHooks = append(newConf.PostHooks, config.PostHook(oldPostHook))
+		newConf.PostHooks = append(newConf.PostHooks, config.PostHook{
+			Name:   oldPostHook.Name,
+			Script: oldPostHook.Script,
+		})
 	}
 
 	for _, oldDecoder := range oldConf.Decoders {
-		newConf.Decoders = append(newConf.Decoders, config.Decoder(oldDecoder))
+		newConf.Decoders = append(newConf.Decoders, config.Decoder{
+			Name:   oldDecoder.Name,
+			Script: oldDecoder.Script,
+		})
 	}
 
 	return &newConf, nil
@@ -6,6 +6,9 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/bluebrown/kobold/plugin"
 )
 
 var UsePragmas = []string{
@@ -15,12 +18,16 @@ var UsePragmas = []string{
 }
 
 type Options struct {
-	Config string
-	Confd  string
-	dbfile string
-	Loglvl int
-	Logfmt string
-	W      io.Writer
+	Config          string
+	Confd           string
+	dbfile          string
+	Loglvl          int
+	Logfmt          string
+	GitCacheDir     string
+	GitCacheMaxSize int64
+	GitFetchTTL     time.Duration
+	ScriptLimits    plugin.Limits
+	W               io.Writer
 }
 
 func (o *Options) Bind(fs *flag.FlagSet) *Options {
@@ -32,6 +39,12 @@ func (o *Options) Bind(fs *flag.FlagSet) *Options {
 	fs.StringVar(&o.dbfile, "db", o.dbfile, "path to sqlite db file")
 	fs.IntVar(&o.Loglvl, "loglvl", o.Loglvl, "log level")
 	fs.StringVar(&o.Logfmt, "logfmt", o.Logfmt, "log format, one of: json, text")
+	fs.StringVar(&o.GitCacheDir, "git-cache-dir", o.GitCacheDir, "path to git cache dir, reused across restarts")
+	fs.Int64Var(&o.GitCacheMaxSize, "git-cache-max-size", o.GitCacheMaxSize, "max size of the git cache in bytes, 0 means unlimited")
+	fs.DurationVar(&o.GitFetchTTL, "git-fetch-ttl", o.GitFetchTTL, "duration for which fetched git refs are not fetched again, 0 always fetches")
+	fs.Uint64Var(&o.ScriptLimits.MaxSteps, "script-max-steps", o.ScriptLimits.MaxSteps, "max execution steps of decoders and hooks, 0 means unlimited")
+	fs.DurationVar(&o.ScriptLimits.Timeout, "script-timeout", o.ScriptLimits.Timeout, "max run time of decoders and hooks, 0 means unlimited")
+	fs.DurationVar(&o.ScriptLimits.HTTPTimeout, "script-http-timeout", o.ScriptLimits.HTTPTimeout, "timeout of http requests made by decoders and hooks, 0 means unlimited")
 	return o
 }
 
@@ -46,9 +59,11 @@ func NewOptions() *Options {
 	}
 
 	return &Options{
-		dbfile: filepath.Join(dir, "kobold.sqlite3"),
-		Loglvl: int(slog.LevelInfo),
-		Logfmt: "json",
-		W:      os.Stderr,
+		dbfile:       filepath.Join(dir, "kobold.sqlite3"),
+		Loglvl:       int(slog.LevelInfo),
+		Logfmt:       "json",
+		GitCacheDir:  filepath.Join(os.TempDir(), "kobold-cache"),
+		ScriptLimits: plugin.DefaultLimits,
+		W:            os.Stderr,
 	}
 }
@@ -9,12 +9,18 @@ import (
 	"github.com/a8m/envsubst"
 )
 
+// read the config file into cfg. Relative paths in the file are resolved
+// against its directory.
 func ReadFile(path string, cfg *Config) error {
 	path, err := filepath.Abs(path)
 	if err != nil {
 		return fmt.Errorf("get abs path for %q: %w", path, err)
 	}
 
+	// The directory of the file, as given, so that relative paths work the
+	// same, if the file is a symlink.
+	dir := filepath.Dir(path)
+
 	path, err = filepath.EvalSymlinks(path)
 	if err != nil {
 		return fmt.Errorf("eval symlink %q: %w", path, err)
@@ -30,6 +36,8 @@ func ReadFile(path string, cfg *Config) error {
 		return fmt.Errorf("unmarshal toml: %w", err)
 	}
 
+	cfg.resolvePaths(dir)
+
 	return nil
 }
 
@@ -0,0 +1,78 @@
+package git
+
+import (
+	"context"
+	"strings"
+)
+
+// auth holds the credentials used by git commands that talk to a remote. The
+// secrets are never passed as arguments to git, since arguments show up in
+// error messages and process listings. The ssh key is referenced by path, via
+// GIT_SSH_COMMAND, and the password is read from its file by a credential
+// helper, whose location is passed through the environment.
+type Auth struct {
+	SSHKeyFile        string
+	SSHKnownHostsFile string
+	Username          string
+	PasswordFile      string
+}
+
+type authKey struct{}
+
+// return a copy of ctx, carrying the given auth. Git commands run with the
+// returned context, authenticate with it. A nil auth leaves the authentication
+// to the environment of the process, i.e. the mounted ssh dir and gitconfig.
+func WithAuth(ctx context.Context, auth *Auth) context.Context {
+	return context.WithValue(ctx, authKey{}, auth)
+}
+
+func authFrom(ctx context.Context) *Auth {
+	auth, _ := ctx.Value(authKey{}).(*Auth)
+	return auth
+}
+
+// the credential helper reads the username and password file from the
+// environment, so that neither ends up in the command line of git.
+const credentialHelper = `!f() { test "$1" = get || exit 0; ` +
+	`echo "username=$KOBOLD_GIT_USERNAME"; ` +
+	`printf 'password=%s\n' "$(cat "$KOBOLD_GIT_PASSWORD_FILE")"; }; f`
+
+// return the global args, that need to be passed to git, before the command.
+func (auth *Auth) args() []string {
+	if auth == nil || auth.PasswordFile == "" {
+		return nil
+	}
+	// The empty helper resets the helpers configured in the gitconfig.
+	return []string{"-c", "credential.helper=", "-c", "credential.helper=" + credentialHelper}
+}
+
+// return the environment variables, that need to be set for the git command.
+func (auth *Auth) env() []string {
+	if auth == nil {
+		return nil
+	}
+
+	var env []string
+
+	if auth.SSHKeyFile != "" {
+		ssh := []string{"ssh", "-i", shellQuote(auth.SSHKeyFile), "-o", "IdentitiesOnly=yes"}
+		if auth.SSHKnownHostsFile != "" {
+			ssh = append(ssh, "-o", shellQuote("UserKnownHostsFile="+auth.SSHKnownHostsFile))
+		}
+		env = append(env, "GIT_SSH_COMMAND="+strings.Join(ssh, " "))
+	}
+
+	if auth.PasswordFile != "" {
+		env = append(env,
+			"KOBOLD_GIT_USERNAME="+auth.Username,
+			"KOBOLD_GIT_PASSWORD_FILE="+auth.PasswordFile,
+			"GIT_TERMINAL_PROMPT=0",
+		)
+	}
+
+	return env
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
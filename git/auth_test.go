@@ -0,0 +1,63 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuth_CredentialHelper(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dir      = t.TempDir()
+		password = filepath.Join(dir, "password")
+		auth     = &Auth{Username: "kobold", PasswordFile: password}
+	)
+
+	if err := os.WriteFile(password, []byte("s3cre7\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := command(WithAuth(context.Background(), auth), dir, "credential", "fill")
+	cmd.Stdin = strings.NewReader("protocol=https\nhost=example.com\n\n")
+
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"username=kobold\n", "password=s3cre7\n"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected %q in output, got:\n%s", want, out)
+		}
+	}
+
+	for _, arg := range cmd.Args {
+		if strings.Contains(arg, "s3cre7") {
+			t.Errorf("secret leaked into args: %q", arg)
+		}
+	}
+}
+
+func TestAuth_SSHCommand(t *testing.T) {
+	t.Parallel()
+
+	auth := &Auth{SSHKeyFile: "/keys/it's", SSHKnownHostsFile: "/keys/known_hosts"}
+
+	env := auth.env()
+	if len(env) != 1 {
+		t.Fatalf("expected only GIT_SSH_COMMAND, got %v", env)
+	}
+
+	want := `GIT_SSH_COMMAND=ssh -i '/keys/it'\''s' -o IdentitiesOnly=yes -o 'UserKnownHostsFile=/keys/known_hosts'`
+	if env[0] != want {
+		t.Errorf("got %s, want %s", env[0], want)
+	}
+
+	if args := auth.args(); len(args) != 0 {
+		t.Errorf("expected no args for ssh auth, got %v", args)
+	}
+}
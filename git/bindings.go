@@ -77,9 +77,66 @@ func AddRoot(ctx context.Context, dir string) error {
 	return err
 }
 
-// commit the index with the given message.
-func Commit(ctx context.Context, dir, msg string) error {
-	err := run(ctx, dir, "commit", "-m", msg)
+// commit the index with the given message, as the identity carried by ctx,
+// and return the fingerprint of the key, the commit is signed with. It is
+// empty, if the commit is not signed.
+func Commit(ctx context.Context, dir, msg string) (string, error) {
+	id := identityFrom(ctx)
+	if !id.signs() {
+		err := run(ctx, dir, "commit", "-m", msg)
+		return "", err
+	}
+
+	if id.format() == SigningFormatSSH {
+		fingerprint, err := sshKeyFingerprint(ctx, id.SigningKeyFile)
+		if err != nil {
+			return "", fmt.Errorf("signing key fingerprint: %w", err)
+		}
+		err = run(ctx, dir, "commit", "-m", msg)
+		return fingerprint, err
+	}
+
+	if id.format() != SigningFormatOpenPGP {
+		return "", fmt.Errorf("unknown signing format %q", id.SigningFormat)
+	}
+
+	// OpenPGP keys are imported into a throwaway keyring, so that the keyring
+	// of the host is neither used nor modified.
+	home, cleanup, err := tempKeyring(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	key, err := importOpenPGPKey(ctx, home, id.SigningKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("import signing key: %w", err)
+	}
+
+	signer := *id
+	signer.gnupgHome = home
+	signer.signingKey = key
+
+	err = run(WithIdentity(ctx, &signer), dir, "commit", "-m", msg)
+	return key, err
+}
+
+// add a new worktree at path, with a detached HEAD at commitish. The worktree
+// shares the object store of the repo at dir, so no objects are copied.
+func WorktreeAdd(ctx context.Context, dir, path, commitish string) error {
+	err := run(ctx, dir, "worktree", "add", "--detach", path, commitish)
+	return err
+}
+
+// remove the worktree at path, discarding any local changes.
+func WorktreeRemove(ctx context.Context, dir, path string) error {
+	err := run(ctx, dir, "worktree", "remove", "--force", path)
+	return err
+}
+
+// prune the administrative files of worktrees that no longer exist.
+func WorktreePrune(ctx context.Context, dir string) error {
+	err := run(ctx, dir, "worktree", "prune")
 	return err
 }
 
@@ -91,28 +148,90 @@ func Push(ctx context.Context, dir string, refs ...string) error {
 	return err
 }
 
-// perform add, commit, and push in one step, on the current branch.
-func Publish(ctx context.Context, dir, ref, msg string) error {
+// a commit, pushed by Publish.
+type Pushed struct {
+	SHA string
+	// the fingerprint of the signing key, empty if the commit is not signed.
+	SigningKeyFingerprint string
+}
+
+// perform add, commit, and push in one step. HEAD is pushed to the remote
+// branch ref, so this works on detached worktrees too. The sha is read before
+// pushing, so that a pushed commit is never reported without it.
+func Publish(ctx context.Context, dir, ref, msg string) (Pushed, error) {
 	if err := AddRoot(ctx, dir); err != nil {
-		return fmt.Errorf("git add: %w", err)
+		return Pushed{}, fmt.Errorf("git add: %w", err)
 	}
 
-	if err := Commit(ctx, dir, msg); err != nil {
-		return fmt.Errorf("git commit: %w", err)
+	fingerprint, err := Commit(ctx, dir, msg)
+	if err != nil {
+		return Pushed{}, fmt.Errorf("git commit: %w", err)
 	}
 
-	if err := Push(ctx, dir, ref); err != nil {
-		return fmt.Errorf("git push: %w", err)
+	sha, err := Head(ctx, dir)
+	if err != nil {
+		return Pushed{}, fmt.Errorf("git rev-parse: %w", err)
 	}
 
-	return nil
+	if err := Push(ctx, dir, "HEAD:refs/heads/"+ref); err != nil {
+		return Pushed{}, fmt.Errorf("git push: %w", err)
+	}
+
+	return Pushed{SHA: sha, SigningKeyFingerprint: fingerprint}, nil
+}
+
+// return the commit sha of HEAD.
+func Head(ctx context.Context, dir string) (string, error) {
+	out, err := output(ctx, dir, "rev-parse", "HEAD")
+	return strings.TrimSpace(out), err
+}
+
+// return the url of the origin remote.
+func RemoteURL(ctx context.Context, dir string) (string, error) {
+	out, err := output(ctx, dir, "remote", "get-url", "origin")
+	return strings.TrimSpace(out), err
+}
+
+// perform a light integrity check of the repo at dir. Only the connectivity of
+// the reachable objects is verified, not their content.
+func FsckLite(ctx context.Context, dir string) error {
+	err := run(ctx, dir, "fsck", "--connectivity-only", "--no-dangling", "--no-progress")
+	return err
 }
 
 func run(ctx context.Context, dir string, args ...string) error {
-	cmd := exec.CommandContext(ctx, "git", args...)
-	cmd.Dir = dir
+	cmd := command(ctx, dir, args...)
 	if b, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("%w: %s: %s", err, string(b), strings.Join(args, " "))
 	}
 	return nil
 }
+
+func output(ctx context.Context, dir string, args ...string) (string, error) {
+	var stderr strings.Builder
+	cmd := command(ctx, dir, args...)
+	cmd.Stderr = &stderr
+	b, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %s", err, stderr.String(), strings.Join(args, " "))
+	}
+	return string(b), nil
+}
+
+// create a git command, authenticated with the auth and using the identity
+// carried by ctx, if any. Only args are used in error messages, the auth and
+// identity are never part of them.
+func command(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	var (
+		auth   = authFrom(ctx)
+		id     = identityFrom(ctx)
+		global = append(auth.args(), id.args()...)
+		env    = append(auth.env(), id.env()...)
+	)
+	cmd := exec.CommandContext(ctx, "git", append(global, args...)...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd
+}
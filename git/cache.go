@@ -2,10 +2,15 @@ package git
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
@@ -13,29 +18,79 @@ import (
 )
 
 // the repo cache will keep a clean version of each repo fetched via Fill().
-// Each time a repo is requested with Get(), a new copy of the local repo is
-// made, and the path to it is returned. These copies are unique and persist in
-// the given namespace until that namespace is purged. This allows multiple
+// Each time a repo is requested with Get(), a new git worktree of the local
+// repo is added, checked out at the requested ref, and the path to it is
+// returned. The worktrees share the object store of the cached repo, so
+// handing them out is cheap, even for large repos. They are unique and persist
+// in the given namespace until that namespace is purged. This allows multiple
 // callers to use the same repo without worrying about collisions. It also
 // allows the cache to refetch the repo, without having to reset branches or
-// clean up after itself. The cached repositories contain only the .git
-// directory, because they are obtained with git fetch. Therefore, after the
-// caller has retrieved the path to the repo, they need to git switch to their
-// desired branch. Repos and branches that have not been passed to Fill() will
-// not be available. Calling Fill() with a repo that has already been cached
-// will cause the cache to refetch the repo.
+// clean up after itself. The worktrees have a detached HEAD, so callers that
+// want to push, need to push HEAD to the desired remote branch or create a
+// new branch first. Repos and branches that have not been passed to Fill()
+// will not be available. Calling Fill() with a repo that has already been
+// cached will cause the cache to refetch the requested refs, unless they have
+// been fetched within the configured ttl. Repos that are no longer needed can
+// be dropped with Retain().
+//
+// The cache directory can be kept across restarts. Load() picks up the repos
+// of a previous process, so that only new objects have to be fetched. If a max
+// size is set, the least recently used repos are evicted after each Fill(),
+// until the cache fits into the limit again.
 type RepoCache struct {
-	repos  map[string][]string
-	mu     *sync.RWMutex
-	dir    string
-	cfetch *prometheus.CounterVec
+	repos     map[string]*cacheEntry
+	auths     map[string]*Auth
+	worktrees map[string][]worktree
+	mu        *sync.RWMutex
+	wmu       *sync.Mutex
+	dir       string
+	ttl       time.Duration
+	maxSize   int64
+	cfetch    *prometheus.CounterVec
+	gsize     *prometheus.GaugeVec
+}
+
+// the state of a single cached repo. Refs that failed to fetch during the
+// last fill, are recorded with their error, so that Get() can report it.
+type cacheEntry struct {
+	fetched  map[string]time.Time
+	failed   map[string]error
+	lastUsed time.Time
+	size     int64
+}
+
+func newCacheEntry() *cacheEntry {
+	return &cacheEntry{
+		fetched: make(map[string]time.Time),
+		failed:  make(map[string]error),
+	}
+}
+
+// a worktree handed out by the cache, remembered by namespace so that it can
+// be removed from its repo when the namespace is purged.
+type worktree struct {
+	uri  string
+	repo string
+	path string
+}
+
+// CacheEntry describes a repo held by the cache.
+type CacheEntry struct {
+	Repo      string               `json:"repo"`
+	Refs      map[string]time.Time `json:"refs"`
+	LastUsed  time.Time            `json:"last_used"`
+	Size      int64                `json:"size"`
+	Worktrees int                  `json:"worktrees"`
 }
 
 func NewRepoCache(name string) *RepoCache {
 	return &RepoCache{
-		repos: make(map[string][]string),
-		mu:    &sync.RWMutex{},
-		dir:   filepath.Join(os.TempDir(), name+"-cache"),
+		repos:     make(map[string]*cacheEntry),
+		auths:     make(map[string]*Auth),
+		worktrees: make(map[string][]worktree),
+		mu:        &sync.RWMutex{},
+		wmu:       &sync.Mutex{},
+		dir:       filepath.Join(os.TempDir(), name+"-cache"),
 	}
 }
 
@@ -43,6 +98,129 @@ func (cache *RepoCache) SetCounter(cfetch *prometheus.CounterVec) {
 	cache.cfetch = cfetch
 }
 
+// set a gauge, labeled by repo, that tracks the disk size of each cached repo.
+func (cache *RepoCache) SetSizeGauge(gsize *prometheus.GaugeVec) {
+	cache.gsize = gsize
+}
+
+// set the directory of the cache. This should be called before Load() and
+// before the cache is used.
+func (cache *RepoCache) SetDir(dir string) {
+	cache.dir = dir
+}
+
+// set the duration for which a fetched ref is considered fresh. Fresh refs
+// are not fetched again by Fill(). A ttl of 0 disables this, and each call to
+// Fill() fetches all requested refs.
+func (cache *RepoCache) SetTTL(ttl time.Duration) {
+	cache.ttl = ttl
+}
+
+// set the auth used to fetch the given repo. A nil auth removes it, and the
+// environment of the process is used instead.
+func (cache *RepoCache) SetAuth(repo string, auth *Auth) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if auth == nil {
+		delete(cache.auths, repo)
+		return
+	}
+	cache.auths[repo] = auth
+}
+
+// set the max total disk size of the cached repos in bytes. A size of 0
+// disables eviction.
+func (cache *RepoCache) SetMaxSize(size int64) {
+	cache.maxSize = size
+}
+
+// load the repos, left behind in the cache directory by a previous process.
+// Each repo is validated, by checking that its origin matches its location in
+// the cache and by running a light fsck. Invalid repos are removed. Leftover
+// worktrees are discarded, since their namespaces are gone.
+func (cache *RepoCache) Load(ctx context.Context) error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if err := os.RemoveAll(filepath.Join(cache.dir, "namespaces")); err != nil {
+		return fmt.Errorf("remove namespaces: %w", err)
+	}
+
+	root := filepath.Join(cache.dir, "repos")
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		if _, err := os.Stat(filepath.Join(path, ".git")); err != nil {
+			return nil
+		}
+
+		uri, err := cache.validate(ctx, path)
+		if err != nil {
+			slog.WarnContext(ctx, "discard cached repo", "path", path, "error", err)
+			if err := os.RemoveAll(path); err != nil {
+				return fmt.Errorf("remove %q: %w", path, err)
+			}
+			return filepath.SkipDir
+		}
+
+		size, err := dirSize(path)
+		if err != nil {
+			return fmt.Errorf("size %q: %w", path, err)
+		}
+
+		entry := newCacheEntry()
+		entry.size = size
+		cache.repos[uri] = entry
+		cache.observe(uri)
+
+		slog.InfoContext(ctx, "load cached repo", "repo", uri, "size", size)
+
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return fmt.Errorf("walk %q: %w", root, err)
+	}
+
+	return nil
+}
+
+func (cache *RepoCache) validate(ctx context.Context, path string) (string, error) {
+	uri, err := RemoteURL(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("git remote get-url: %w", err)
+	}
+
+	if want := filepath.Join(cache.dir, "repos", uri); want != path {
+		return "", fmt.Errorf("origin %q does not belong to %q", uri, path)
+	}
+
+	if err := WorktreePrune(ctx, path); err != nil {
+		return "", fmt.Errorf("git worktree prune: %w", err)
+	}
+
+	if err := FsckLite(ctx, path); err != nil {
+		return "", fmt.Errorf("git fsck: %w", err)
+	}
+
+	return uri, nil
+}
+
+// fetch the repos and refs of the given uris. Only the refs passed to this
+// call are fetched, refs that are still fresh according to the ttl are
+// skipped. Each repo is fetched independently, a failing repo does not affect
+// the others. The returned error joins the errors of all failed repos. The
+// error of a failed repo is also returned by Get(), for each of its refs, until
+// they have been fetched successfully.
 func (cache *RepoCache) Fill(ctx context.Context, lim int, uris ...PackageURI) error {
 	if err := ctx.Err(); err != nil {
 		return err
@@ -55,43 +233,266 @@ func (cache *RepoCache) Fill(ctx context.Context, lim int, uris ...PackageURI) e
 		return err
 	}
 
-	for _, uri := range uris {
-		cache.repos[uri.Repo] = append(cache.repos[uri.Repo], uri.Ref)
-	}
+	var (
+		now   = time.Now()
+		stale = make(map[string][]string)
+		used  = make(map[string]struct{})
+	)
 
-	for uri, refs := range cache.repos {
-		cache.repos[uri] = unique(refs)
+	for _, uri := range uris {
+		entry, ok := cache.repos[uri.Repo]
+		if !ok {
+			entry = newCacheEntry()
+			cache.repos[uri.Repo] = entry
+		}
+		entry.lastUsed = now
+		used[uri.Repo] = struct{}{}
+		if t, ok := entry.fetched[uri.Ref]; ok && cache.ttl > 0 && now.Sub(t) < cache.ttl {
+			continue
+		}
+		stale[uri.Repo] = append(stale[uri.Repo], uri.Ref)
 	}
 
 	g := errgroup.Group{}
 	g.SetLimit(lim)
 
-	for uri, path := range cache.repos {
-		uri, refs := uri, path
+	// The goroutines never return an error, instead the error is recorded per
+	// ref, so that a failing repo does not hide the errors of other repos.
+	errs := make(map[string]error, len(stale))
+
+	for uri, refs := range stale {
+		uri, refs, entry := uri, unique(refs), cache.repos[uri]
+		ctx := WithAuth(ctx, cache.auths[uri])
 		g.Go(func() error {
-			if cache.cfetch != nil {
-				cache.cfetch.With(prometheus.Labels{"repo": uri}).Inc()
-			}
-			if err := Ensure(ctx, filepath.Join(cache.dir, "repos", uri), uri, refs...); err != nil {
-				return fmt.Errorf("ensure %#q: %w", uri, err)
+			// Each goroutine owns the entry of its repo,
+			// so this does not race with the other goroutines.
+			err := cache.fetch(ctx, uri, refs, entry, now)
+			for _, ref := range refs {
+				if err != nil {
+					entry.failed[ref] = err
+				} else {
+					delete(entry.failed, ref)
+				}
 			}
 			return nil
 		})
 	}
 
-	// TODO: this may swallow errors,
-	// since only the first non-nil error is returned.
-	err := g.Wait()
+	_ = g.Wait()
+
+	for uri, refs := range stale {
+		for _, ref := range refs {
+			if err, ok := cache.repos[uri].failed[ref]; ok {
+				errs[uri] = err
+			}
+		}
+	}
+
+	fetchErrs := make([]error, 0, len(errs))
+	for _, err := range errs {
+		fetchErrs = append(fetchErrs, err)
+	}
+
+	err := errors.Join(fetchErrs...)
+
+	for uri := range stale {
+		cache.observe(uri)
+	}
+
+	if eerr := cache.evict(used); eerr != nil {
+		err = errors.Join(err, eerr)
+	}
 
 	return err
 }
 
-func (cache *RepoCache) Get(ctx context.Context, namespace, repo string) (string, error) {
+func (cache *RepoCache) fetch(ctx context.Context, uri string, refs []string, entry *cacheEntry, now time.Time) error {
+	if cache.cfetch != nil {
+		cache.cfetch.With(prometheus.Labels{"repo": uri}).Inc()
+	}
+
+	dir := filepath.Join(cache.dir, "repos", uri)
+	if err := Ensure(ctx, dir, uri, refs...); err != nil {
+		return fmt.Errorf("ensure %#q: %w", uri, err)
+	}
+
+	for _, ref := range refs {
+		entry.fetched[ref] = now
+	}
+
+	size, err := dirSize(dir)
+	if err != nil {
+		return fmt.Errorf("size %#q: %w", uri, err)
+	}
+
+	entry.size = size
+
+	return nil
+}
+
+// evict the least recently used repos until the total size is within the max
+// size. Repos in keep, or with worktrees handed out, are never evicted. Must
+// be called with the write lock held.
+func (cache *RepoCache) evict(keep map[string]struct{}) error {
+	if cache.maxSize <= 0 {
+		return nil
+	}
+
+	var (
+		total      int64
+		candidates []string
+		inUse      = cache.inUse()
+	)
+
+	for uri, entry := range cache.repos {
+		total += entry.size
+		if _, ok := keep[uri]; ok {
+			continue
+		}
+		if _, ok := inUse[uri]; ok {
+			continue
+		}
+		candidates = append(candidates, uri)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return cache.repos[candidates[i]].lastUsed.Before(cache.repos[candidates[j]].lastUsed)
+	})
+
+	var errs []error
+
+	for _, uri := range candidates {
+		if total <= cache.maxSize {
+			break
+		}
+		size := cache.repos[uri].size
+		if err := cache.remove(uri); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		total -= size
+	}
+
+	return errors.Join(errs...)
+}
+
+// forget all cached repos, that are not in the given list, and remove them
+// from disk. Repos that still have worktrees handed out, are kept until they
+// have been purged.
+func (cache *RepoCache) Retain(repos ...string) error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	keep := make(map[string]struct{}, len(repos))
+	for _, repo := range repos {
+		keep[repo] = struct{}{}
+	}
+
+	inUse := cache.inUse()
+
+	var errs []error
+
+	for uri := range cache.repos {
+		if _, ok := keep[uri]; ok {
+			continue
+		}
+		if _, ok := inUse[uri]; ok {
+			continue
+		}
+		if err := cache.remove(uri); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// remove the repo from disk and forget about it.
+func (cache *RepoCache) remove(uri string) error {
+	src := filepath.Join(cache.dir, "repos", uri)
+	if err := os.RemoveAll(src); err != nil {
+		return fmt.Errorf("remove %q: %w", src, err)
+	}
+	delete(cache.repos, uri)
+	delete(cache.auths, uri)
+	if cache.gsize != nil {
+		cache.gsize.DeleteLabelValues(uri)
+	}
+	return nil
+}
+
+// return the set of repos that have worktrees handed out.
+func (cache *RepoCache) inUse() map[string]struct{} {
+	inUse := make(map[string]struct{})
+	for _, wts := range cache.worktrees {
+		for _, wt := range wts {
+			inUse[wt.uri] = struct{}{}
+		}
+	}
+	return inUse
+}
+
+func (cache *RepoCache) observe(uri string) {
+	if cache.gsize == nil {
+		return
+	}
+	if entry, ok := cache.repos[uri]; ok {
+		cache.gsize.With(prometheus.Labels{"repo": uri}).Set(float64(entry.size))
+	}
+}
+
+// list the repos currently held by the cache, sorted by repo.
+func (cache *RepoCache) Entries() []CacheEntry {
 	cache.mu.RLock()
 	defer cache.mu.RUnlock()
 
-	src := filepath.Join(cache.dir, "repos", repo)
-	d := filepath.Join(cache.dir, "namespaces", namespace, repo)
+	// The worktrees are written under the worktree lock, while holding the
+	// read lock, so it has to be held to count them.
+	cache.wmu.Lock()
+	counts := make(map[string]int)
+	for _, wts := range cache.worktrees {
+		for _, wt := range wts {
+			counts[wt.uri]++
+		}
+	}
+	cache.wmu.Unlock()
+
+	entries := make([]CacheEntry, 0, len(cache.repos))
+	for uri, entry := range cache.repos {
+		refs := make(map[string]time.Time, len(entry.fetched))
+		for ref, t := range entry.fetched {
+			refs[ref] = t
+		}
+		entries = append(entries, CacheEntry{
+			Repo:      uri,
+			Refs:      refs,
+			LastUsed:  entry.lastUsed,
+			Size:      entry.size,
+			Worktrees: counts[uri],
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Repo < entries[j].Repo })
+
+	return entries
+}
+
+// add a new worktree for the repo of the given uri, checked out at its ref,
+// and return its path. The worktree belongs to the namespace and is removed
+// when the namespace is purged. If the ref failed to fetch during the last
+// fill, the fetch error is returned.
+func (cache *RepoCache) Get(ctx context.Context, namespace string, uri PackageURI) (string, error) {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	if entry, ok := cache.repos[uri.Repo]; ok {
+		if err, ok := entry.failed[uri.Ref]; ok {
+			return "", fmt.Errorf("fetch %#q: %w", uri.Ref, err)
+		}
+	}
+
+	src := filepath.Join(cache.dir, "repos", uri.Repo)
+	d := filepath.Join(cache.dir, "namespaces", namespace, uri.Repo)
 
 	if err := os.MkdirAll(d, 0o755); err != nil {
 		return "", fmt.Errorf("mkdir %q: %w", d, err)
@@ -99,17 +500,72 @@ func (cache *RepoCache) Get(ctx context.Context, namespace, repo string) (string
 
 	d = filepath.Join(d, uuid.NewString())
 
-	if err := copyDir(ctx, src, d); err != nil {
-		return "", fmt.Errorf("copy %q: %w", src, err)
+	// Adding worktrees writes to the admin dir of the shared repo, so only one
+	// worktree is added at a time. This is cheap compared to copying the repo.
+	cache.wmu.Lock()
+	defer cache.wmu.Unlock()
+
+	if err := WorktreeAdd(ctx, src, d, "refs/remotes/origin/"+uri.Ref); err != nil {
+		return "", fmt.Errorf("git worktree add %q: %w", d, err)
 	}
 
+	cache.worktrees[namespace] = append(cache.worktrees[namespace], worktree{uri: uri.Repo, repo: src, path: d})
+
 	return d, nil
 }
 
-func (cache *RepoCache) Purge(namespace string) error {
+// remove all worktrees of the namespace from their repos and delete the
+// namespace directory. Worktree metadata of the affected repos is pruned, so
+// that it does not accumulate over time.
+func (cache *RepoCache) Purge(ctx context.Context, namespace string) error {
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
-	return os.RemoveAll(filepath.Join(cache.dir, "namespaces", namespace))
+
+	var (
+		errs  []error
+		repos = make(map[string]struct{})
+	)
+
+	for _, wt := range cache.worktrees[namespace] {
+		repos[wt.repo] = struct{}{}
+		if err := WorktreeRemove(ctx, wt.repo, wt.path); err != nil {
+			errs = append(errs, fmt.Errorf("git worktree remove %q: %w", wt.path, err))
+		}
+	}
+
+	delete(cache.worktrees, namespace)
+
+	if err := os.RemoveAll(filepath.Join(cache.dir, "namespaces", namespace)); err != nil {
+		errs = append(errs, err)
+	}
+
+	for repo := range repos {
+		if err := WorktreePrune(ctx, repo); err != nil {
+			errs = append(errs, fmt.Errorf("git worktree prune %q: %w", repo, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// return the total size of all regular files below dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
 }
 
 func unique(ss []string) []string {
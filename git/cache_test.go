@@ -0,0 +1,207 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepoCache_Worktrees(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		origin = newOrigin(t, "main")
+		cache  = NewRepoCache("test")
+		uri    = PackageURI{Repo: "file://" + origin, Ref: "main"}
+	)
+
+	cache.dir = t.TempDir()
+
+	if err := cache.Fill(ctx, 1, uri); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := cache.Get(ctx, "ns", uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := cache.Get(ctx, "ns", uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a == b {
+		t.Fatalf("expected unique worktrees, got %q twice", a)
+	}
+
+	for _, p := range []string{a, b} {
+		if _, err := os.Stat(filepath.Join(p, "README")); err != nil {
+			t.Errorf("expected checked out file in %q: %v", p, err)
+		}
+	}
+
+	if err := cache.Purge(ctx, "ns"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(cache.dir, "namespaces", "ns")); !os.IsNotExist(err) {
+		t.Errorf("expected namespace to be removed, got %v", err)
+	}
+
+	out, err := exec.Command("git", "-C", filepath.Join(cache.dir, "repos", uri.Repo), "worktree", "list", "--porcelain").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countPrefix(string(out), "worktree "); n != 1 {
+		t.Errorf("expected only the main worktree after purge, got %d:\n%s", n, out)
+	}
+}
+
+// create a repo with a single commit on the given branch and return its path.
+func newOrigin(t *testing.T, branch string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("test\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "-b", branch},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@localhost", "commit", "-m", "init"},
+	} {
+		if err := run(context.Background(), dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func countPrefix(s, prefix string) int {
+	n := 0
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRepoCache_TTLAndRetain(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		origin = newOrigin(t, "main")
+		cache  = NewRepoCache("test")
+		uri    = PackageURI{Repo: "file://" + origin, Ref: "main"}
+	)
+
+	cache.dir = t.TempDir()
+	cache.SetTTL(time.Hour)
+
+	if err := cache.Fill(ctx, 1, uri); err != nil {
+		t.Fatal(err)
+	}
+
+	// The ref is still fresh, so the unreachable origin is not contacted.
+	if err := os.RemoveAll(origin); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cache.Fill(ctx, 1, uri); err != nil {
+		t.Fatalf("expected fresh ref to be skipped, got %v", err)
+	}
+
+	if err := cache.Retain(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(cache.dir, "repos", uri.Repo)); !os.IsNotExist(err) {
+		t.Errorf("expected repo to be removed, got %v", err)
+	}
+
+	if _, ok := cache.repos[uri.Repo]; ok {
+		t.Errorf("expected repo to be forgotten")
+	}
+}
+
+func TestRepoCache_LoadAndEvict(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		dir   = t.TempDir()
+		uriA  = PackageURI{Repo: "file://" + newOrigin(t, "main"), Ref: "main"}
+		uriB  = PackageURI{Repo: "file://" + newOrigin(t, "main"), Ref: "main"}
+		first = NewRepoCache("test")
+	)
+
+	first.SetDir(dir)
+
+	if err := first.Fill(ctx, 1, uriA); err != nil {
+		t.Fatal(err)
+	}
+
+	// A repo whose origin does not match its location is discarded on load.
+	bogus := filepath.Join(dir, "repos", "bogus")
+	if err := Init(ctx, bogus, uriA.Repo); err != nil {
+		t.Fatal(err)
+	}
+
+	second := NewRepoCache("test")
+	second.SetDir(dir)
+	second.SetMaxSize(1)
+
+	if err := second.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(bogus); !os.IsNotExist(err) {
+		t.Errorf("expected bogus repo to be removed, got %v", err)
+	}
+
+	entries := second.Entries()
+	if len(entries) != 1 || entries[0].Repo != uriA.Repo || entries[0].Size == 0 {
+		t.Fatalf("expected loaded repo %q, got %+v", uriA.Repo, entries)
+	}
+
+	// Filling another repo exceeds the max size, so the least recently used
+	// repo is evicted, while the repo of the current fill is kept.
+	if err := second.Fill(ctx, 1, uriB); err != nil {
+		t.Fatal(err)
+	}
+
+	entries = second.Entries()
+	if len(entries) != 1 || entries[0].Repo != uriB.Repo {
+		t.Fatalf("expected only %q to remain, got %+v", uriB.Repo, entries)
+	}
+}
+
+func TestRepoCache_FetchFailureIsolation(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		cache = NewRepoCache("test")
+		good  = PackageURI{Repo: "file://" + newOrigin(t, "main"), Ref: "main"}
+		bad   = PackageURI{Repo: "file://" + filepath.Join(t.TempDir(), "missing"), Ref: "main"}
+	)
+
+	cache.SetDir(t.TempDir())
+
+	err := cache.Fill(ctx, 2, good, bad)
+	if err == nil || !strings.Contains(err.Error(), bad.Repo) {
+		t.Fatalf("expected fill error for %q, got %v", bad.Repo, err)
+	}
+
+	if strings.Contains(err.Error(), good.Repo) {
+		t.Errorf("expected no error for %q, got %v", good.Repo, err)
+	}
+
+	if _, err := cache.Get(ctx, "ns", good); err != nil {
+		t.Errorf("expected good repo to be available, got %v", err)
+	}
+
+	if _, err := cache.Get(ctx, "ns", bad); err == nil || !strings.Contains(err.Error(), "ensure") {
+		t.Errorf("expected fetch error for bad repo, got %v", err)
+	}
+}
@@ -1,18 +0,0 @@
-//go:build linux || darwin
-
-package git
-
-import (
-	"context"
-	"fmt"
-	"os/exec"
-)
-
-func copyDir(ctx context.Context, src, dst string) error {
-	cmd := exec.CommandContext(ctx, "cp", "-r", src, dst)
-	b, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("cp: %w: %s", err, string(b))
-	}
-	return nil
-}
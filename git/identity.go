@@ -0,0 +1,166 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	SigningFormatSSH     = "ssh"
+	SigningFormatOpenPGP = "openpgp"
+)
+
+// identity holds the author and committer of commits and the key they are
+// signed with. The committer defaults to the author. If no signing key file is
+// set, commits are not signed. OpenPGP keys must not be protected by a
+// passphrase, since there is nobody to enter it.
+type Identity struct {
+	AuthorName     string
+	AuthorEmail    string
+	CommitterName  string
+	CommitterEmail string
+	SigningFormat  string
+	SigningKeyFile string
+
+	// openpgp keys are referenced by fingerprint, from a throwaway keyring.
+	// Both are only set for the duration of a commit.
+	gnupgHome  string
+	signingKey string
+}
+
+type identityKey struct{}
+
+// return a copy of ctx, carrying the given identity. Commits created with the
+// returned context, use it. A nil identity leaves the identity to the
+// environment of the process, i.e. the gitconfig.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+func identityFrom(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
+
+func (id *Identity) signs() bool {
+	return id != nil && id.SigningKeyFile != ""
+}
+
+// return the global args, that need to be passed to git, before the command.
+func (id *Identity) args() []string {
+	if !id.signs() {
+		return nil
+	}
+	key := id.SigningKeyFile
+	if id.SigningFormat == SigningFormatOpenPGP {
+		key = id.signingKey
+	}
+	return []string{
+		"-c", "gpg.format=" + id.format(),
+		"-c", "user.signingkey=" + key,
+		"-c", "commit.gpgsign=true",
+	}
+}
+
+// return the environment variables, that need to be set for the git command.
+func (id *Identity) env() []string {
+	if id == nil {
+		return nil
+	}
+
+	var (
+		env            []string
+		committerName  = id.CommitterName
+		committerEmail = id.CommitterEmail
+	)
+
+	if committerName == "" {
+		committerName = id.AuthorName
+	}
+
+	if committerEmail == "" {
+		committerEmail = id.AuthorEmail
+	}
+
+	for _, kv := range [][2]string{
+		{"GIT_AUTHOR_NAME", id.AuthorName},
+		{"GIT_AUTHOR_EMAIL", id.AuthorEmail},
+		{"GIT_COMMITTER_NAME", committerName},
+		{"GIT_COMMITTER_EMAIL", committerEmail},
+		{"GNUPGHOME", id.gnupgHome},
+	} {
+		if kv[1] != "" {
+			env = append(env, kv[0]+"="+kv[1])
+		}
+	}
+
+	return env
+}
+
+func (id *Identity) format() string {
+	if id.SigningFormat == "" {
+		return SigningFormatSSH
+	}
+	return id.SigningFormat
+}
+
+// return the fingerprint of the ssh key in file.
+func sshKeyFingerprint(ctx context.Context, file string) (string, error) {
+	out, err := exec.CommandContext(ctx, "ssh-keygen", "-l", "-f", file).Output()
+	if err != nil {
+		return "", fmt.Errorf("ssh-keygen -l %q: %w", file, err)
+	}
+	// the output has the form: <bits> <fingerprint> <comment> (<type>)
+	fields := strings.Fields(string(out))
+	if len(fields) < 2 {
+		return "", fmt.Errorf("unexpected ssh-keygen output: %q", out)
+	}
+	return fields[1], nil
+}
+
+// create a throwaway keyring. The cleanup func stops the gpg agent, that may
+// have been started for it, and removes the keyring.
+func tempKeyring(ctx context.Context) (string, func(), error) {
+	home, err := os.MkdirTemp("", "kobold-gnupg-")
+	if err != nil {
+		return "", nil, fmt.Errorf("create gnupg home: %w", err)
+	}
+	return home, func() {
+		_ = exec.CommandContext(context.WithoutCancel(ctx), "gpgconf", "--homedir", home, "--kill", "gpg-agent").Run()
+		_ = os.RemoveAll(home)
+	}, nil
+}
+
+// import the openpgp key file into the keyring at home and return the
+// fingerprint of its primary key.
+func importOpenPGPKey(ctx context.Context, home, file string) (string, error) {
+	gpg := func(args ...string) ([]byte, error) {
+		args = append([]string{"--batch", "--homedir", home}, args...)
+		b, err := exec.CommandContext(ctx, "gpg", args...).CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: gpg %s", err, b, strings.Join(args, " "))
+		}
+		return b, nil
+	}
+
+	if _, err := gpg("--import", file); err != nil {
+		return "", err
+	}
+
+	out, err := gpg("--with-colons", "--list-secret-keys")
+	if err != nil {
+		return "", err
+	}
+
+	// the fingerprint is the 10th field of the first fpr record
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Split(line, ":"); fields[0] == "fpr" && len(fields) > 9 {
+			return fields[9], nil
+		}
+	}
+
+	return "", fmt.Errorf("no secret key found in %q", file)
+}
@@ -0,0 +1,113 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIdentity_SignedCommit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		format    string
+		genKey    func(t *testing.T, dir string) string
+		signature string
+	}{
+		{
+			name:      "ssh",
+			format:    SigningFormatSSH,
+			genKey:    sshKey,
+			signature: "-----BEGIN SSH SIGNATURE-----",
+		},
+		{
+			name:      "openpgp",
+			format:    SigningFormatOpenPGP,
+			genKey:    openPGPKey,
+			signature: "-----BEGIN PGP SIGNATURE-----",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				repo = newOrigin(t, "main")
+				id   = &Identity{
+					AuthorName:     "kobold",
+					AuthorEmail:    "kobold@localhost",
+					SigningFormat:  tt.format,
+					SigningKeyFile: tt.genKey(t, t.TempDir()),
+				}
+				ctx = WithIdentity(context.Background(), id)
+			)
+
+			if err := os.WriteFile(filepath.Join(repo, "README"), []byte("signed\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := AddRoot(ctx, repo); err != nil {
+				t.Fatal(err)
+			}
+
+			fpr, err := Commit(ctx, repo, "signed")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := output(context.Background(), repo, "cat-file", "commit", "HEAD")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range []string{
+				"author kobold <kobold@localhost>",
+				"committer kobold <kobold@localhost>",
+				tt.signature,
+			} {
+				if !strings.Contains(out, want) {
+					t.Errorf("expected %q in commit, got:\n%s", want, out)
+				}
+			}
+
+			if fpr == "" {
+				t.Error("expected signing key fingerprint")
+			}
+		})
+	}
+}
+
+func sshKey(t *testing.T, dir string) string {
+	t.Helper()
+	key := filepath.Join(dir, "id_ed25519")
+	if b, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, b)
+	}
+	return key
+}
+
+func openPGPKey(t *testing.T, dir string) string {
+	t.Helper()
+	home, cleanup, err := tempKeyring(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanup)
+	key := filepath.Join(dir, "key.asc")
+	for _, args := range [][]string{
+		{"--passphrase", "", "--quick-gen-key", "kobold <kobold@localhost>", "ed25519", "sign", "never"},
+		{"--armor", "--output", key, "--export-secret-keys", "kobold@localhost"},
+	} {
+		args = append([]string{"--batch", "--homedir", home}, args...)
+		if b, err := exec.Command("gpg", args...).CombinedOutput(); err != nil {
+			t.Fatalf("%v: %s", err, b)
+		}
+	}
+	return key
+}
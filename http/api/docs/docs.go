@@ -18,6 +18,34 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/cache": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "cache"
+                ],
+                "summary": "get a list of the repos in the git cache",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/git.CacheEntry"
+                            }
+                        }
+                    },
+                    "default": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.errorMsg"
+                        }
+                    }
+                }
+            }
+        },
         "/channels": {
             "get": {
                 "produces": [
@@ -321,6 +349,68 @@ const docTemplate = `{
                 }
             }
         },
+        "/precommits": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "precommits"
+                ],
+                "summary": "get a list of precommit hooks",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.PreCommit"
+                            }
+                        }
+                    },
+                    "default": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.errorMsg"
+                        }
+                    }
+                }
+            }
+        },
+        "/precommits/{name}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "precommits"
+                ],
+                "summary": "get a precommit hook by name",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "precommit name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.PreCommit"
+                        }
+                    },
+                    "default": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.errorMsg"
+                        }
+                    }
+                }
+            }
+        },
         "/runs": {
             "get": {
                 "produces": [
@@ -403,6 +493,41 @@ const docTemplate = `{
                 }
             }
         },
+        "/runs/{id}/hook": {
+            "post": {
+                "description": "The hooks run on the worker pool, once a worker is available. The run is returned as is, poll it for the hook status.\nThe api has no authentication. Do not expose it, without securing it in front of kobold.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "runs"
+                ],
+                "summary": "queue a retry of the failed post hook of a run, without pushing again",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "run fingerprint",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/model.Run"
+                        }
+                    },
+                    "default": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/api.errorMsg"
+                        }
+                    }
+                }
+            }
+        },
         "/tasks": {
             "get": {
                 "produces": [
@@ -498,9 +623,64 @@ const docTemplate = `{
                 }
             }
         },
+        "git.CacheEntry": {
+            "type": "object",
+            "properties": {
+                "last_used": {
+                    "type": "string"
+                },
+                "refs": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "repo": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "worktrees": {
+                    "type": "integer"
+                }
+            }
+        },
+        "krm.Change": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "file": {
+                    "description": "the file containing the updated node, relative to the package",
+                    "type": "string"
+                },
+                "new_ref": {
+                    "type": "string"
+                },
+                "old_ref": {
+                    "description": "the image ref before and after the change. The old ref is completed\nwith the context of the node, if only a part of the ref is updated.",
+                    "type": "string"
+                },
+                "path": {
+                    "description": "the path of the updated node within its document, i.e.\nspec.containers[0].image",
+                    "type": "string"
+                },
+                "registry": {
+                    "type": "string"
+                },
+                "repo": {
+                    "type": "string"
+                }
+            }
+        },
         "model.Channel": {
             "type": "object",
             "properties": {
+                "decoder_args": {
+                    "$ref": "#/definitions/store.Args"
+                },
                 "decoder_name": {
                     "type": "string"
                 },
@@ -512,6 +692,18 @@ const docTemplate = `{
         "model.Decoder": {
             "type": "object",
             "properties": {
+                "env": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "hosts": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "name": {
                     "type": "string"
                 },
@@ -520,6 +712,9 @@ const docTemplate = `{
                     "items": {
                         "type": "integer"
                     }
+                },
+                "secrets": {
+                    "$ref": "#/definitions/store.FlatMap"
                 }
             }
         },
@@ -532,15 +727,66 @@ const docTemplate = `{
                         "type": "string"
                     }
                 },
+                "commit_body": {
+                    "type": "string"
+                },
+                "commit_title": {
+                    "type": "string"
+                },
+                "credential_name": {
+                    "type": "string"
+                },
                 "dest_branch": {
                     "type": "string"
                 },
+                "identity_name": {
+                    "type": "string"
+                },
                 "name": {
                     "type": "string"
                 },
+                "post_hook_args": {
+                    "$ref": "#/definitions/store.Args"
+                },
                 "post_hook_name": {
                     "type": "string"
                 },
+                "pr_api_url": {
+                    "type": "string"
+                },
+                "pr_auto_merge": {
+                    "type": "string"
+                },
+                "pr_credential_name": {
+                    "type": "string"
+                },
+                "pr_draft": {
+                    "$ref": "#/definitions/null.Bool"
+                },
+                "pr_labels": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "pr_provider": {
+                    "type": "string"
+                },
+                "pr_reviewers": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "pr_team_reviewers": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "pre_commit_name": {
+                    "type": "string"
+                },
                 "repo_uri": {
                     "type": "string"
                 }
@@ -549,6 +795,7 @@ const docTemplate = `{
         "model.PipelineRunListRow": {
             "type": "object",
             "properties": {
+                "commit_sha": {},
                 "dest_branch": {
                     "type": "string"
                 },
@@ -556,6 +803,18 @@ const docTemplate = `{
                 "fingerprint": {
                     "type": "string"
                 },
+                "hook_attempts": {},
+                "hook_error": {},
+                "hook_outputs": {
+                    "$ref": "#/definitions/store.FlatMap"
+                },
+                "hook_results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/store.HookResult"
+                    }
+                },
+                "hook_status": {},
                 "msgs": {
                     "type": "array",
                     "items": {
@@ -568,9 +827,11 @@ const docTemplate = `{
                 "post_hook": {
                     "type": "string"
                 },
+                "pushed_branch": {},
                 "repo_uri": {
                     "type": "string"
                 },
+                "signing_key_fingerprint": {},
                 "status": {
                     "type": "string"
                 },
@@ -586,6 +847,47 @@ const docTemplate = `{
         "model.PostHook": {
             "type": "object",
             "properties": {
+                "env": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "hosts": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                },
+                "script": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "secrets": {
+                    "$ref": "#/definitions/store.FlatMap"
+                }
+            }
+        },
+        "model.PreCommit": {
+            "type": "object",
+            "properties": {
+                "env": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "hosts": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "name": {
                     "type": "string"
                 },
@@ -594,12 +896,16 @@ const docTemplate = `{
                     "items": {
                         "type": "integer"
                     }
+                },
+                "secrets": {
+                    "$ref": "#/definitions/store.FlatMap"
                 }
             }
         },
         "model.Run": {
             "type": "object",
             "properties": {
+                "commit_sha": {},
                 "dest_branch": {
                     "type": "string"
                 },
@@ -607,6 +913,18 @@ const docTemplate = `{
                 "fingerprint": {
                     "type": "string"
                 },
+                "hook_attempts": {},
+                "hook_error": {},
+                "hook_outputs": {
+                    "$ref": "#/definitions/store.FlatMap"
+                },
+                "hook_results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/store.HookResult"
+                    }
+                },
+                "hook_status": {},
                 "msgs": {
                     "type": "array",
                     "items": {
@@ -616,9 +934,11 @@ const docTemplate = `{
                 "post_hook": {
                     "type": "string"
                 },
+                "pushed_branch": {},
                 "repo_uri": {
                     "type": "string"
                 },
+                "signing_key_fingerprint": {},
                 "status": {
                     "type": "string"
                 },
@@ -634,27 +954,78 @@ const docTemplate = `{
         "model.Task": {
             "type": "object",
             "properties": {
+                "changes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/krm.Change"
+                    }
+                },
+                "commit_msg": {
+                    "type": "string"
+                },
+                "commit_sha": {
+                    "type": "string"
+                },
+                "credential_name": {
+                    "type": "string"
+                },
                 "dest_branch": {
                     "type": "string"
                 },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/store.Event"
+                    }
+                },
                 "failure_reason": {
                     "type": "string"
                 },
+                "hook_attempts": {
+                    "type": "integer"
+                },
+                "hook_error": {
+                    "type": "string"
+                },
+                "hook_outputs": {
+                    "$ref": "#/definitions/store.FlatMap"
+                },
+                "hook_results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/store.HookResult"
+                    }
+                },
+                "hook_status": {
+                    "type": "string"
+                },
                 "id": {
                     "type": "string"
                 },
+                "identity_name": {
+                    "type": "string"
+                },
                 "msgs": {
                     "type": "array",
                     "items": {
                         "type": "string"
                     }
                 },
+                "pipeline_name": {
+                    "type": "string"
+                },
                 "post_hook_name": {
                     "type": "string"
                 },
+                "pushed_branch": {
+                    "type": "string"
+                },
                 "repo_uri": {
                     "type": "string"
                 },
+                "signing_key_fingerprint": {
+                    "type": "string"
+                },
                 "status": {
                     "type": "string"
                 },
@@ -671,6 +1042,70 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "null.Bool": {
+            "type": "object",
+            "properties": {
+                "bool": {
+                    "type": "boolean"
+                },
+                "valid": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "store.Args": {
+            "type": "object",
+            "additionalProperties": {}
+        },
+        "store.Event": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "ref": {
+                    "type": "string"
+                }
+            }
+        },
+        "store.FlatMap": {
+            "type": "object",
+            "additionalProperties": {
+                "type": "string"
+            }
+        },
+        "store.HookResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "on": {
+                    "type": "string"
+                },
+                "outputs": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "position": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
@@ -1,14 +1,17 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"log/slog"
 	"net/http"
 
+	"github.com/bluebrown/kobold/git"
 	"github.com/bluebrown/kobold/http/api/docs"
 	"github.com/bluebrown/kobold/store/model"
+	"github.com/bluebrown/kobold/task"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/schema"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
@@ -18,15 +21,25 @@ import (
 
 type WebAPI struct {
 	q      *model.Queries
+	cache  repoCache
+	hooks  hookRetrier
 	router *mux.Router
 }
 
+type repoCache interface {
+	Entries() []git.CacheEntry
+}
+
+type hookRetrier interface {
+	RetryHook(ctx context.Context, fingerprint string) error
+}
+
 // create a new web api handler. Requires to know the basepath its being served
 // on, in order to generate correct swagger docs. It will not register routes on
 // the basepath, the caller should remove the basepath from the mux before
 // calling ServeHTTP.
-func New(basepath string, q *model.Queries) *WebAPI {
-	api := WebAPI{q, mux.NewRouter()}
+func New(basepath string, q *model.Queries, cache repoCache, hooks hookRetrier) *WebAPI {
+	api := WebAPI{q, cache, hooks, mux.NewRouter()}
 
 	docs.SwaggerInfo.Title = "Kobold API"
 	docs.SwaggerInfo.Version = "dev"
@@ -35,6 +48,8 @@ func New(basepath string, q *model.Queries) *WebAPI {
 	api.router.PathPrefix("/docs/").Handler(http.StripPrefix("/docs", httpSwagger.Handler())).Methods("GET")
 	api.router.Path("/docs").Handler(http.RedirectHandler(basepath+"/docs/", http.StatusMovedPermanently)).Methods("GET")
 
+	api.router.HandleFunc("/cache", api.GetCacheList).Methods("GET")
+
 	api.router.HandleFunc("/channels", api.GetChannelList).Methods("GET")
 	api.router.HandleFunc("/channels/{name}", api.GetChannel).Methods("GET")
 
@@ -48,11 +63,15 @@ func New(basepath string, q *model.Queries) *WebAPI {
 	api.router.HandleFunc("/posthooks", api.GetPostHookList).Methods("GET")
 	api.router.HandleFunc("/posthooks/{name}", api.GetPostHook).Methods("GET")
 
+	api.router.HandleFunc("/precommits", api.GetPreCommitList).Methods("GET")
+	api.router.HandleFunc("/precommits/{name}", api.GetPreCommit).Methods("GET")
+
 	api.router.HandleFunc("/tasks", api.GetTaskList).Methods("GET")
 	api.router.HandleFunc("/tasks/{name}", api.GetTask).Methods("GET")
 
 	api.router.HandleFunc("/runs", api.GetRunList).Methods("GET")
 	api.router.HandleFunc("/runs/{name}", api.GetRun).Methods("GET")
+	api.router.HandleFunc("/runs/{name}/hook", api.RetryRunHook).Methods("POST")
 
 	return &api
 }
@@ -103,6 +122,22 @@ func (api *WebAPI) respond(w http.ResponseWriter, r *http.Request, data any, err
 	api.send(w, r, http.StatusOK, data)
 }
 
+// GetCacheList godoc
+//
+//	@Router		/cache [get]
+//	@Summary	get a list of the repos in the git cache
+//	@Tags		cache
+//	@Produce	json
+//	@Success	200		{array}		git.CacheEntry
+//	@Response	default	{object}	errorMsg "Error"
+func (api *WebAPI) GetCacheList(w http.ResponseWriter, r *http.Request) {
+	if api.cache == nil {
+		api.error(w, r, http.StatusNotFound)
+		return
+	}
+	api.respond(w, r, api.cache.Entries(), nil)
+}
+
 // GetChannel godoc
 //
 //	@Router		/channels/{name} [get]
@@ -249,6 +284,34 @@ func (api *WebAPI) GetPostHookList(w http.ResponseWriter, r *http.Request) {
 	api.respond(w, r, d, err)
 }
 
+// GetPreCommit godoc
+//
+//	@Router		/precommits/{name} [get]
+//	@Summary	get a precommit hook by name
+//	@Tags		precommits
+//	@Produce	json
+//	@Param		name	path		string	true	"precommit name"
+//	@Success	200		{object}	model.PreCommit
+//	@Response	default	{object}	errorMsg "Error"
+func (api *WebAPI) GetPreCommit(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	d, err := api.q.PreCommitGet(r.Context(), name)
+	api.respond(w, r, d, err)
+}
+
+// GetPreCommitList godoc
+//
+//	@Router		/precommits [get]
+//	@Summary	get a list of precommit hooks
+//	@Tags		precommits
+//	@Produce	json
+//	@Success	200		{array}		model.PreCommit
+//	@Response	default	{object}	errorMsg "Error"
+func (api *WebAPI) GetPreCommitList(w http.ResponseWriter, r *http.Request) {
+	d, err := api.q.PreCommitList(r.Context())
+	api.respond(w, r, d, err)
+}
+
 // GetTask godoc
 //
 //	@Router		/tasks/{id} [get]
@@ -340,3 +403,40 @@ func (api *WebAPI) GetRunList(w http.ResponseWriter, r *http.Request) {
 	d, err := api.q.RunList(r.Context(), params)
 	api.respond(w, r, d, err)
 }
+
+// RetryRunHook godoc
+//
+//	@Router			/runs/{id}/hook [post]
+//	@Summary		queue a retry of the failed post hook of a run, without pushing again
+//	@Description	The hooks run on the worker pool, once a worker is available. The run is returned as is, poll it for the hook status.
+//	@Description	The api has no authentication. Do not expose it, without securing it in front of kobold.
+//	@Tags			runs
+//	@Produce		json
+//	@Param			id		path		string	true	"run fingerprint"
+//	@Success		202		{object}	model.Run
+//	@Response		default	{object}	errorMsg "Error"
+func (api *WebAPI) RetryRunHook(w http.ResponseWriter, r *http.Request) {
+	if api.hooks == nil {
+		api.error(w, r, http.StatusNotFound)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+
+	if err := api.hooks.RetryHook(r.Context(), name); err != nil {
+		if errors.Is(err, task.ErrHookNotRetryable) {
+			api.error(w, r, http.StatusConflict)
+			return
+		}
+		api.respond(w, r, nil, err)
+		return
+	}
+
+	d, err := api.q.RunGet(r.Context(), name)
+	if err != nil {
+		api.respond(w, r, nil, err)
+		return
+	}
+
+	api.send(w, r, http.StatusAccepted, d)
+}
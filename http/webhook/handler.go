@@ -5,14 +5,16 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"strings"
 
+	"github.com/bluebrown/kobold/plugin"
 	"github.com/gorilla/mux"
 )
 
 const warnQueryDeprecated = `sending channel name using query parameters is deprecated and will be removed in future releases. Please use path parameters instead.`
 
 type scheduler interface {
-	Schedule(ctx context.Context, chn string, data []byte) error
+	Schedule(ctx context.Context, chn string, data []byte, src plugin.Source) error
 }
 
 type Webhook struct {
@@ -41,7 +43,7 @@ func (api *Webhook) handleEvent(w http.ResponseWriter, r *http.Request) {
 	chn := mux.Vars(r)["chan"]
 	logger := slog.With("chan", chn)
 
-	if err := api.s.Schedule(r.Context(), chn, buf.Bytes()); err != nil {
+	if err := api.s.Schedule(r.Context(), chn, buf.Bytes(), source(r)); err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		logger.Error("schedule task", "error", err)
 		return
@@ -58,3 +60,24 @@ func (api *Webhook) handleEvent(w http.ResponseWriter, r *http.Request) {
 		logger.Error("write response body", "error", err)
 	}
 }
+
+// the source of the event, so that decoders can use the headers and query of
+// the request, i.e. to tell the event type or check a token. Credential
+// headers are dropped.
+func source(r *http.Request) plugin.Source {
+	src := plugin.Source{
+		Headers:    make(map[string]string, len(r.Header)),
+		Query:      make(map[string]string),
+		RemoteAddr: r.RemoteAddr,
+	}
+	for k, v := range r.Header {
+		if plugin.IsCredentialHeader(k) {
+			continue
+		}
+		src.Headers[strings.ToLower(k)] = strings.Join(v, ", ")
+	}
+	for k, v := range r.URL.Query() {
+		src.Query[k] = v[0]
+	}
+	return src
+}
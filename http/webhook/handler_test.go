@@ -6,6 +6,8 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/bluebrown/kobold/plugin"
 )
 
 func TestWebhook_ServeHTTP(t *testing.T) {
@@ -14,9 +16,11 @@ func TestWebhook_ServeHTTP(t *testing.T) {
 		name        string
 		giveURL     string
 		giveBody    string
+		giveHeader  map[string]string
 		wantStatus  int
 		wantResBody string
 		wantChan    string
+		wantSource  *plugin.Source
 	}{
 		{
 			name:        "query parameter",
@@ -33,6 +37,25 @@ func TestWebhook_ServeHTTP(t *testing.T) {
 			wantStatus: 202,
 			wantChan:   "path",
 		},
+		{
+			name:     "source",
+			giveURL:  "/events/path?token=abc&token=def",
+			giveBody: "hello",
+			giveHeader: map[string]string{
+				"X-GitHub-Event":      "package",
+				"X-Hub-Signature-256": "sha256=abc",
+				"Authorization":       "Bearer secret",
+				"Cookie":              "session=secret",
+				"Proxy-Authorization": "Basic secret",
+			},
+			wantStatus: 202,
+			wantChan:   "path",
+			wantSource: &plugin.Source{
+				Headers:    map[string]string{"x-github-event": "package", "x-hub-signature-256": "sha256=abc"},
+				Query:      map[string]string{"token": "abc"},
+				RemoteAddr: "192.0.2.1:1234",
+			},
+		},
 	}
 	for _, tt := range tests {
 		tt := tt
@@ -44,6 +67,9 @@ func TestWebhook_ServeHTTP(t *testing.T) {
 				rec = httptest.NewRecorder()
 				req = httptest.NewRequest("POST", tt.giveURL, strings.NewReader(tt.giveBody))
 			)
+			for k, v := range tt.giveHeader {
+				req.Header.Set(k, v)
+			}
 			api.ServeHTTP(rec, req)
 			res := rec.Result()
 			defer res.Body.Close()
@@ -51,6 +77,9 @@ func TestWebhook_ServeHTTP(t *testing.T) {
 			assertEq(t, rec.Body.String(), tt.wantResBody)
 			assertEq(t, ms.ch, tt.wantChan)
 			assertEq(t, string(ms.buf), tt.giveBody)
+			if tt.wantSource != nil {
+				assertEq(t, ms.src, *tt.wantSource)
+			}
 		})
 	}
 }
@@ -58,11 +87,13 @@ func TestWebhook_ServeHTTP(t *testing.T) {
 type mockScheduler struct {
 	ch  string
 	buf []byte
+	src plugin.Source
 }
 
-func (m *mockScheduler) Schedule(_ context.Context, chn string, data []byte) error {
+func (m *mockScheduler) Schedule(_ context.Context, chn string, data []byte, src plugin.Source) error {
 	m.ch = chn
 	m.buf = data
+	m.src = src
 	return nil
 }
 
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	"sigs.k8s.io/kustomize/kyaml/kio/kioutil"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
@@ -52,6 +53,8 @@ func DefaultNodeHandler(_, curr, next string, opts Options) (string, Change, err
 		Description: fmt.Sprintf("update image ref %q to %q", curr, next),
 		Registry:    newRef.Context().RegistryStr(),
 		Repo:        newRef.Context().RepositoryStr(),
+		OldRef:      rawRef,
+		NewRef:      next,
 	}
 
 	switch opts.Part {
@@ -80,14 +83,26 @@ type NodeHandler func(key, currentRef, nextRef string, opts Options) (string, Ch
 type ImageRefUpdateFilter struct {
 	handler   NodeHandler
 	imageRefs []string
-	Changes   []Change
-	Warnings  []string
+	// if set, only changes for which keep returns true are made. Other
+	// changes are reverted and not recorded.
+	Keep     func(Change) bool
+	Changes  []Change
+	Warnings []string
 }
 
 type Change struct {
-	Description string
-	Registry    string
-	Repo        string
+	Description string `json:"description"`
+	Registry    string `json:"registry"`
+	Repo        string `json:"repo"`
+	// the image ref before and after the change. The old ref is completed
+	// with the context of the node, if only a part of the ref is updated.
+	OldRef string `json:"old_ref"`
+	NewRef string `json:"new_ref"`
+	// the file containing the updated node, relative to the package
+	File string `json:"file"`
+	// the path of the updated node within its document, i.e.
+	// spec.containers[0].image
+	Path string `json:"path"`
 }
 
 // create a new krm filter. The filter will traverse all nodes and invoke the
@@ -105,8 +120,20 @@ func NewImageRefUpdateFilter(handler NodeHandler, imageRefs ...string) *ImageRef
 }
 
 func (i *ImageRefUpdateFilter) Filter(nodes []*yaml.RNode) ([]*yaml.RNode, error) {
-	// TODO: use top level loop to capture the current source file info.
-	err := VisitMapLeafs(nodes, func(mn *yaml.MapNode) error {
+	for _, node := range nodes {
+		if err := i.filterNode(node); err != nil {
+			return nodes, err
+		}
+	}
+	return nodes, nil
+}
+
+func (i *ImageRefUpdateFilter) filterNode(node *yaml.RNode) error {
+	// The path annotation is set by the package reader. It is missing, when
+	// the nodes did not come from files.
+	file, _, _ := kioutil.GetFileAnnotations(node)
+
+	return visitMapLeafs(node, "", func(path string, mn *yaml.MapNode) error {
 		lineComment := mn.Value.YNode().LineComment
 
 		if !strings.HasPrefix(lineComment, CommentPrefix) {
@@ -129,16 +156,31 @@ func (i *ImageRefUpdateFilter) Filter(nodes []*yaml.RNode) ([]*yaml.RNode, error
 				continue
 			}
 			mn.Value.YNode().Value = v
-			lastChange = change
+			// Image refs that do not apply to the node, return an empty
+			// change. They must not overwrite a previous change.
+			if change != (Change{}) {
+				if lastChange.OldRef != "" {
+					change.OldRef = lastChange.OldRef
+				}
+				lastChange = change
+			}
 		}
 
-		if originalValue != mn.Value.YNode().Value {
-			i.Changes = append(i.Changes, lastChange)
+		if originalValue == mn.Value.YNode().Value {
+			return nil
+		}
+
+		lastChange.File = file
+		lastChange.Path = path
+		if i.Keep != nil && !i.Keep(lastChange) {
+			mn.Value.YNode().Value = originalValue
+			return nil
 		}
 
+		i.Changes = append(i.Changes, lastChange)
+
 		return nil
 	})
-	return nodes, err
 }
 
 func GetRepoName(image string) (result string) {
@@ -168,40 +210,47 @@ func ParseImageRefWithDigest(s string) (name.Reference, string, error) {
 
 func VisitMapLeafs(nodes []*yaml.RNode, fn func(*yaml.MapNode) error) error {
 	for _, node := range nodes {
-		switch node.YNode().Kind {
-		case yaml.SequenceNode:
-			els, err := node.Elements()
-			if err != nil {
-				return err
-			}
-			if err := VisitMapLeafs(els, fn); err != nil {
+		if err := visitMapLeafs(node, "", func(_ string, mn *yaml.MapNode) error { return fn(mn) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// visit the map leafs of the node like VisitMapLeafs, but pass the path of each
+// leaf along with it. Fields are separated by dots, and the elements of
+// sequences are indexed, i.e. spec.containers[0].image.
+func visitMapLeafs(node *yaml.RNode, path string, fn func(string, *yaml.MapNode) error) error {
+	switch node.YNode().Kind {
+	case yaml.SequenceNode:
+		els, err := node.Elements()
+		if err != nil {
+			return err
+		}
+		for i, el := range els {
+			if err := visitMapLeafs(el, fmt.Sprintf("%s[%d]", path, i), fn); err != nil {
 				return err
 			}
-		case yaml.MappingNode:
-			fields, err := node.Fields()
-			if err != nil {
-				return err
+		}
+	case yaml.MappingNode:
+		fields, err := node.Fields()
+		if err != nil {
+			return err
+		}
+		for _, field := range fields {
+			f := node.Field(field)
+			p := field
+			if path != "" {
+				p = path + "." + field
 			}
-			for _, field := range fields {
-				f := node.Field(field)
-				switch f.Value.YNode().Kind {
-				case yaml.ScalarNode:
-					if err := fn(f); err != nil {
-						return err
-					}
-				case yaml.SequenceNode:
-					els, err := f.Value.Elements()
-					if err != nil {
-						return err
-					}
-					if err := VisitMapLeafs(els, fn); err != nil {
-						return err
-					}
-				default:
-					if err := VisitMapLeafs([]*yaml.RNode{f.Value}, fn); err != nil {
-						return err
-					}
+			if f.Value.YNode().Kind == yaml.ScalarNode {
+				if err := fn(p, f); err != nil {
+					return err
 				}
+				continue
+			}
+			if err := visitMapLeafs(f.Value, p, fn); err != nil {
+				return err
 			}
 		}
 	}
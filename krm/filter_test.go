@@ -1,7 +1,10 @@
 package krm
 
 import (
+	"context"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/google/go-containerregistry/pkg/name"
@@ -309,6 +312,12 @@ func Test_renderer_Render(t *testing.T) {
 
 			}
 
+			for _, c := range changes {
+				if c.File == "" {
+					t.Errorf("change %q has no source file", c.Description)
+				}
+			}
+
 			for source, fieldValues := range tt.wantSourceFieldValue {
 				if !fs.Exists(source) {
 					t.Errorf("%s: file does not exist in outFs", source)
@@ -354,3 +363,60 @@ func Test_renderer_Render(t *testing.T) {
 		})
 	}
 }
+
+func TestPipelineKeep(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	b, err := os.ReadFile(filepath.Join("testdata", "kube", "deployment.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "deployment.yaml"), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	events := []string{
+		"test.azurecr.io/nginx:latest@sha256:82becede498899ec668628e7cb0ad87b6e1c371cb8a1e597d83a47fac21d6af3",
+		"test.azurecr.io/nginx:v1@sha256:993518ca49ede3c4e751fe799837ede16e60bc410452e3922602ebceda9b4c73",
+	}
+
+	planned, _, err := Plan(context.Background(), dir, events...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(planned) != 2 {
+		t.Fatalf("planned %d changes, want 2", len(planned))
+	}
+	for _, c := range planned {
+		if c.File != "deployment.yaml" || c.Path != "spec.template.spec.containers[0].image" {
+			t.Errorf("change at %s %s, want deployment.yaml spec.template.spec.containers[0].image", c.File, c.Path)
+		}
+	}
+
+	after, err := os.ReadFile(filepath.Join(dir, "deployment.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(b) {
+		t.Fatal("plan must not write files")
+	}
+
+	keep := func(c Change) bool { return c == planned[1] }
+
+	changes, _, err := PipelineKeep(context.Background(), dir, keep, events...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0] != planned[1] {
+		t.Fatalf("changes = %v, want %v", changes, planned[1:])
+	}
+
+	after, err = os.ReadFile(filepath.Join(dir, "deployment.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(after), events[0]) || !strings.Contains(string(after), events[1]) {
+		t.Errorf("expected only the kept change to be written:\n%s", after)
+	}
+}
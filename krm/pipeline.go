@@ -7,7 +7,22 @@ import (
 	"sigs.k8s.io/kustomize/kyaml/kio"
 )
 
+// update the image refs in the package, and write the changed files.
 func Pipeline(ctx context.Context, pkg string, refs ...string) ([]Change, []string, error) {
+	return pipeline(ctx, pkg, nil, true, refs)
+}
+
+// like Pipeline, but only the changes for which keep returns true are made.
+func PipelineKeep(ctx context.Context, pkg string, keep func(Change) bool, refs ...string) ([]Change, []string, error) {
+	return pipeline(ctx, pkg, keep, true, refs)
+}
+
+// return the changes Pipeline would make, without writing any files.
+func Plan(ctx context.Context, pkg string, refs ...string) ([]Change, []string, error) {
+	return pipeline(ctx, pkg, nil, false, refs)
+}
+
+func pipeline(ctx context.Context, pkg string, keep func(Change) bool, write bool, refs []string) ([]Change, []string, error) {
 	rw := &kio.LocalPackageReadWriter{
 		PackageFileName:     ".krmignore",
 		PackagePath:         pkg,
@@ -19,11 +34,15 @@ func Pipeline(ctx context.Context, pkg string, refs ...string) ([]Change, []stri
 	}
 
 	filter := NewImageRefUpdateFilter(nil, refs...)
+	filter.Keep = keep
 
 	pipe := kio.Pipeline{
 		Inputs:  []kio.Reader{rw},
 		Filters: []kio.Filter{filter},
-		Outputs: []kio.Writer{rw},
+	}
+
+	if write {
+		pipe.Outputs = []kio.Writer{rw}
 	}
 
 	if err := ctx.Err(); err != nil {
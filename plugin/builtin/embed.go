@@ -2,6 +2,8 @@ package builtin
 
 import (
 	"embed"
+	"net/url"
+	"os"
 	"path/filepath"
 	"strings"
 )
@@ -17,9 +19,62 @@ func PostHooks() []data {
 	return read("posthook")
 }
 
+func PreCommits() []data {
+	return read("precommit")
+}
+
 type data struct {
 	Name   string
 	Script string
+	Env    []string
+	Hosts  []string
+}
+
+// the host env variables, the builtin scripts are allowed to see.
+var env = map[string][]string{
+	"builtin.ado-pr@v1":    {"ADO_USR", "ADO_PAT"},
+	"builtin.gitea-pr@v1":  {"GITEA_HOST", "GITEA_AUTH_HEADER"},
+	"builtin.github-pr@v1": {"GITHUB_TOKEN", "GITHUB_API_URL"},
+	"builtin.gitlab-mr@v1": {"GITLAB_TOKEN", "GITLAB_API_URL"},
+}
+
+// the hosts, the builtin scripts are allowed to reach. Self hosted instances
+// are added from the api url env, or need to be added in the config.
+var hosts = map[string][]string{
+	"builtin.ado-pr@v1":    {"dev.azure.com"},
+	"builtin.github-pr@v1": {"api.github.com"},
+	"builtin.gitlab-mr@v1": {"gitlab.com"},
+}
+
+// the host env variable, that holds the api url of the builtin scripts. The
+// host of the url is allowed in addition to the default hosts.
+var apiURLEnv = map[string]string{
+	"builtin.gitea-pr@v1":  "GITEA_HOST",
+	"builtin.github-pr@v1": "GITHUB_API_URL",
+	"builtin.gitlab-mr@v1": "GITLAB_API_URL",
+}
+
+// the hosts of the builtin, including the host of its api url, if set
+func hostsOf(name string) []string {
+	items := append([]string(nil), hosts[name]...)
+
+	key, ok := apiURLEnv[name]
+	if !ok {
+		return items
+	}
+
+	u, err := url.Parse(os.Getenv(key))
+	if err != nil || u.Host == "" {
+		return items
+	}
+
+	for _, h := range items {
+		if h == u.Host {
+			return items
+		}
+	}
+
+	return append(items, u.Host)
 }
 
 func read(kind string) []data {
@@ -49,6 +104,8 @@ func read(kind string) []data {
 		items = append(items, data{
 			Name:   "builtin." + name,
 			Script: string(script),
+			Env:    env["builtin."+name],
+			Hosts:  hostsOf("builtin." + name),
 		})
 
 	}
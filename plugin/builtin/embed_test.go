@@ -0,0 +1,69 @@
+package builtin
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHostsOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		builtin string
+		env     map[string]string
+		want    []string
+	}{
+		{
+			name:    "default",
+			builtin: "builtin.gitlab-mr@v1",
+			want:    []string{"gitlab.com"},
+		},
+		{
+			name:    "self hosted gitlab",
+			builtin: "builtin.gitlab-mr@v1",
+			env:     map[string]string{"GITLAB_API_URL": "https://gitlab.myorg.dev/api/v4"},
+			want:    []string{"gitlab.com", "gitlab.myorg.dev"},
+		},
+		{
+			name:    "gitea with port",
+			builtin: "builtin.gitea-pr@v1",
+			env:     map[string]string{"GITEA_HOST": "http://gitea.local:3000"},
+			want:    []string{"gitea.local:3000"},
+		},
+		{
+			name:    "gitea without env",
+			builtin: "builtin.gitea-pr@v1",
+			want:    nil,
+		},
+		{
+			name:    "github default api url",
+			builtin: "builtin.github-pr@v1",
+			env:     map[string]string{"GITHUB_API_URL": "https://api.github.com"},
+			want:    []string{"api.github.com"},
+		},
+		{
+			name:    "invalid url",
+			builtin: "builtin.github-pr@v1",
+			env:     map[string]string{"GITHUB_API_URL": "github.myorg.dev"},
+			want:    []string{"api.github.com"},
+		},
+		{
+			name:    "no api url env",
+			builtin: "builtin.ado-pr@v1",
+			env:     map[string]string{"GITLAB_API_URL": "https://gitlab.myorg.dev/api/v4"},
+			want:    []string{"dev.azure.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range []string{"GITEA_HOST", "GITHUB_API_URL", "GITLAB_API_URL"} {
+				t.Setenv(k, tt.env[k])
+			}
+
+			if got := hostsOf(tt.builtin); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
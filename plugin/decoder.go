@@ -1,25 +1,158 @@
 package plugin
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"strings"
 
+	"github.com/bluebrown/kobold/store"
 	"go.starlark.net/starlark"
 )
 
-type Decoder struct{}
+type Decoder struct {
+	environ []string
+}
 
 func NewDecoderRunner() *Decoder {
-	return &Decoder{}
+	return &Decoder{
+		environ: os.Environ(),
+	}
+}
+
+// the source of a message. Messages received by the webhook carry the headers
+// and query of their request, and its remote address. Header names are lower
+// case, and multiple values are joined by comma. Of the query, only the first
+// value of each parameter is kept. Messages from other sources carry none.
+// Headers, which carry credentials, are not part of the source.
+type Source struct {
+	Headers    map[string]string
+	Query      map[string]string
+	RemoteAddr string
 }
 
-func (d *Decoder) Decode(name string, script []byte, data []byte) ([]string, error) {
-	res, err := runMain(defaultThread(name), name, script, d.args(data), nil)
+// report if the header carries credentials, i.e. Authorization, Cookie or any
+// Proxy-* header. Those are dropped from the source, so that scripts never see
+// credentials, that are meant for a proxy in front of kobold.
+func IsCredentialHeader(name string) bool {
+	name = strings.ToLower(name)
+	return name == "authorization" || name == "cookie" || strings.HasPrefix(name, "proxy-")
+}
+
+// decode the data with the script. The source is passed as dict to main, if
+// it accepts a second argument. The args are passed to main as keyword
+// arguments. The script sees only the host env, it is allowed to see. Main
+// returns a list, whose items are either image refs, or dicts with the ref, and
+// optionally the action and labels of the event. The action defaults to push.
+func (d *Decoder) Decode(ctx context.Context, name string, script []byte, data []byte, src Source, args map[string]any, env HostEnv) ([]store.Event, error) {
+	kwargs, err := argsToKwargs(args)
+	if err != nil {
+		return nil, err
+	}
+	res, err := runMain(ctx, defaultThread(name), name, script, d.args(data), starlark.Tuple{d.source(name, src)}, kwargs, d.environ, env)
 	if err != nil {
 		return nil, fmt.Errorf("run main: %w", err)
 	}
-	return asStringSlice(res)
+	return asEvents(res)
+}
+
+func asEvents(v starlark.Value) ([]store.Event, error) {
+	if _, ok := v.(starlark.Iterable); !ok {
+		return nil, fmt.Errorf("expected iterable, got %s", v.Type())
+	}
+	iterator := starlark.Iterate(v)
+	defer iterator.Done()
+	var item starlark.Value
+	var events []store.Event
+	for iterator.Next(&item) {
+		ev, err := asEvent(item)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+func asEvent(v starlark.Value) (store.Event, error) {
+	if s, ok := starlark.AsString(v); ok {
+		return store.Event{Ref: s, Action: store.ActionPush}, nil
+	}
+
+	d, ok := v.(*starlark.Dict)
+	if !ok {
+		return store.Event{}, fmt.Errorf("expected string or dict, got %s", v.Type())
+	}
+
+	ev := store.Event{Action: store.ActionPush}
+	for _, kv := range d.Items() {
+		k, _ := starlark.AsString(kv[0])
+		switch k {
+		case "ref", "action":
+			s, ok := starlark.AsString(kv[1])
+			if !ok {
+				return store.Event{}, fmt.Errorf("%s: expected string, got %s", k, kv[1].Type())
+			}
+			if k == "ref" {
+				ev.Ref = s
+			} else {
+				ev.Action = s
+			}
+		case "labels":
+			labels, ok := kv[1].(*starlark.Dict)
+			if !ok {
+				return store.Event{}, fmt.Errorf("labels: expected dict, got %s", kv[1].Type())
+			}
+			ev.Labels = make(map[string]string, labels.Len())
+			for _, l := range labels.Items() {
+				lk, ok := starlark.AsString(l[0])
+				if !ok {
+					return store.Event{}, fmt.Errorf("labels: expected string key, got %s", l[0].Type())
+				}
+				lv, ok := starlark.AsString(l[1])
+				if !ok {
+					return store.Event{}, fmt.Errorf("labels: %s: expected string, got %s", lk, l[1].Type())
+				}
+				ev.Labels[lk] = lv
+			}
+		default:
+			return store.Event{}, fmt.Errorf("unknown key %s", kv[0].String())
+		}
+	}
+
+	if ev.Ref == "" {
+		return store.Event{}, fmt.Errorf("no ref in %s", d.String())
+	}
+
+	return ev, nil
 }
 
 func (d *Decoder) args(data []byte) starlark.Tuple {
 	return starlark.Tuple{starlark.String(data)}
 }
+
+func (d *Decoder) source(channel string, src Source) *starlark.Dict {
+	s := starlark.NewDict(4)
+	for k, v := range map[string]starlark.Value{
+		"channel":     starlark.String(channel),
+		"headers":     stringDict(src.Headers),
+		"query":       stringDict(src.Query),
+		"remote_addr": starlark.String(src.RemoteAddr),
+	} {
+		if err := s.SetKey(starlark.String(k), v); err != nil {
+			panic(err)
+		}
+	}
+	s.Freeze()
+	return s
+}
+
+func stringDict(m map[string]string) *starlark.Dict {
+	d := starlark.NewDict(len(m))
+	for k, v := range m {
+		if err := d.SetKey(starlark.String(k), starlark.String(v)); err != nil {
+			panic(err)
+		}
+	}
+	return d
+}
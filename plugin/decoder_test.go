@@ -1,11 +1,15 @@
 package plugin
 
 import (
+	"context"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/bluebrown/kobold/krm"
 	"github.com/bluebrown/kobold/plugin/builtin"
+	"github.com/bluebrown/kobold/store"
 )
 
 func TestDecoder(t *testing.T) {
@@ -28,10 +32,10 @@ func TestDecoder(t *testing.T) {
 		{
 			name:       "distribution",
 			decoder:    "decoder.distribution@v1",
-			giveFile:   "testdata/distribution.json",
+			giveFile:   "testdata/distribution-events.json",
 			wantName:   "test.azurecr.io/busybox",
 			wantTag:    "v1",
-			wantDigest: "sha256:xxxxd5c8786bb9e621a45ece0dbxxxx1cdc624ad20da9fe62e9d25490f33xxxx",
+			wantDigest: "sha256:9ae97d36d26566ff84e8893c64a6dc4fe8ca6d1144bf5b87b2b85a32def253c7",
 		},
 		{
 			name:     "dockerhub",
@@ -64,7 +68,7 @@ func TestDecoder(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			refs, err := dec.Decode(tc.decoder, sb, fb)
+			refs, err := dec.Decode(context.Background(), tc.decoder, sb, fb, Source{}, nil, HostEnv{})
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -73,7 +77,7 @@ func TestDecoder(t *testing.T) {
 				t.Errorf("ref mismatch, got %v, want %v", len(refs), 1)
 			}
 
-			tag, digest, err := krm.ParseImageRefWithDigest(refs[0])
+			tag, digest, err := krm.ParseImageRefWithDigest(refs[0].Ref)
 			if err != nil {
 				t.Fatalf("failed to parse image ref: %v", err)
 			}
@@ -92,3 +96,141 @@ func TestDecoder(t *testing.T) {
 		})
 	}
 }
+
+// the distribution decoder parses the ref with the kobold module, so that an
+// event with an invalid digest is rejected, instead of queued.
+func TestDecoder_InvalidDigest(t *testing.T) {
+	t.Parallel()
+
+	sb, err := builtin.StarlarkScripts.ReadFile("starlark/decoder.distribution@v1.star")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fb, err := os.ReadFile("testdata/distribution.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refs, err := NewDecoderRunner().Decode(context.Background(), "decoder.distribution@v1", sb, fb, Source{}, nil, HostEnv{})
+	if err == nil {
+		t.Fatalf("expected invalid digest to be rejected, got %v", refs)
+	}
+
+	if !strings.Contains(err.Error(), "sha256:xxxx") {
+		t.Errorf("expected error to name the digest, got %v", err)
+	}
+}
+
+func TestDecoder_Source(t *testing.T) {
+	t.Parallel()
+
+	src := Source{
+		Headers:    map[string]string{"x-event": "push"},
+		Query:      map[string]string{"token": "abc"},
+		RemoteAddr: "192.0.2.1:1234",
+	}
+
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "input only",
+			script: `def main(input): return [input]`,
+			want:   []string{"data"},
+		},
+		{
+			name:   "source",
+			script: `def main(input, source): return [source["channel"], source["headers"]["x-event"], source["query"]["token"], source["remote_addr"]]`,
+			want:   []string{"test", "push", "abc", "192.0.2.1:1234"},
+		},
+		{
+			name:   "source with default and kwargs",
+			script: `def main(input, source = None, **kwargs): return [source["headers"]["x-event"]]`,
+			want:   []string{"push"},
+		},
+		{
+			name:   "varargs",
+			script: `def main(*args): return [args[0], args[1]["channel"]]`,
+			want:   []string{"data", "test"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			events, err := NewDecoderRunner().Decode(context.Background(), "test", []byte(tt.script), []byte("data"), src, nil, HostEnv{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range events {
+				got = append(got, e.Ref)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecoder_Events(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		script  string
+		want    []store.Event
+		wantErr bool
+	}{
+		{
+			name:   "strings",
+			script: `def main(input): return ["a:1", "b:2"]`,
+			want:   []store.Event{{Ref: "a:1", Action: "push"}, {Ref: "b:2", Action: "push"}},
+		},
+		{
+			name:   "dicts",
+			script: `def main(input): return ["a:1", {"ref": "b:2", "action": "delete", "labels": {"platform": "linux/arm64"}}, {"ref": "c:3"}]`,
+			want: []store.Event{
+				{Ref: "a:1", Action: "push"},
+				{Ref: "b:2", Action: "delete", Labels: map[string]string{"platform": "linux/arm64"}},
+				{Ref: "c:3", Action: "push"},
+			},
+		},
+		{
+			name:    "no ref",
+			script:  `def main(input): return [{"action": "push"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown key",
+			script:  `def main(input): return [{"ref": "a:1", "tags": ["1"]}]`,
+			wantErr: true,
+		},
+		{
+			name:    "non string label",
+			script:  `def main(input): return [{"ref": "a:1", "labels": {"n": 1}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "int",
+			script:  `def main(input): return [1]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := NewDecoderRunner().Decode(context.Background(), "test", []byte(tt.script), nil, Source{}, nil, HostEnv{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
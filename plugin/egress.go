@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+// returned, if a script requests a host, it is not allowed to reach.
+var ErrEgressDenied = errors.New("egress denied")
+
+// allows requests only to the hosts of the allowlist, and logs each request
+// with the fingerprint of the run. The query is not logged, since it may
+// carry secrets.
+type egressGuard struct {
+	fingerprint string
+	hosts       []string
+}
+
+func (g egressGuard) Allowed(req *http.Request) error {
+	u := url.URL{Scheme: req.URL.Scheme, Host: req.URL.Host, Path: req.URL.Path}
+	for _, h := range g.hosts {
+		if g.match(h, req.URL) {
+			slog.Info("http request", "method", req.Method, "url", u.String(), "fingerprint", g.fingerprint)
+			return nil
+		}
+	}
+	slog.Warn("http request denied", "method", req.Method, "url", u.String(), "fingerprint", g.fingerprint)
+	return fmt.Errorf("%w: %s", ErrEgressDenied, req.URL.Host)
+}
+
+// hosts with a port, match only that port. Hosts without a port, match only
+// the default port of the scheme.
+func (g egressGuard) match(pattern string, u *url.URL) bool {
+	host := u.Hostname()
+	if _, _, err := net.SplitHostPort(pattern); err == nil {
+		host = u.Host
+	} else if u.Port() != "" && u.Port() != defaultPorts[u.Scheme] {
+		return false
+	}
+	ok, _ := path.Match(pattern, host)
+	return ok
+}
+
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
@@ -0,0 +1,38 @@
+package plugin
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEgressGuard_Allowed(t *testing.T) {
+	t.Parallel()
+	guard := egressGuard{fingerprint: "test", hosts: []string{"api.github.com", "*.example.com", "localhost:8080"}}
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{url: "https://api.github.com/repos", want: true},
+		{url: "https://api.github.com:443/repos", want: true},
+		{url: "https://api.github.com:8443/repos", want: false},
+		{url: "https://github.com", want: false},
+		{url: "https://gitlab.example.com/api/v4", want: true},
+		{url: "https://example.com", want: false},
+		{url: "http://localhost:8080/hook", want: true},
+		{url: "http://localhost/hook", want: false},
+		{url: "https://api.github.com.evil.dev", want: false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.url, func(t *testing.T) {
+			t.Parallel()
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := guard.Allowed(req); (err == nil) != tt.want {
+				t.Errorf("Allowed() error = %v, want allowed %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -1,40 +1,92 @@
 package plugin
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/bluebrown/kobold/krm"
+	"github.com/bluebrown/kobold/store"
 	"github.com/bluebrown/kobold/store/model"
 	"go.starlark.net/starlark"
 )
 
 type PostHookRunner struct {
-	hostEnv *starlark.Dict
+	environ []string
 }
 
 func NewPostHookRunner() *PostHookRunner {
 	return &PostHookRunner{
-		hostEnv: envToStarlarkDict(os.Environ()),
+		environ: os.Environ(),
 	}
 }
 
-func (runner *PostHookRunner) Run(group model.TaskGroup, msg string, changes []krm.Change, warnings []string) error {
+// the state of the post hook chain of a run, when a hook runs. The status is
+// the status of the run, until a hook of the chain fails. Then it is failure,
+// and the error is that of the hook. The outputs are those of the hooks, that
+// ran before.
+type ChainState struct {
+	Status  string
+	Error   string
+	Outputs map[string]string
+}
+
+// the run, a post hook is called for. The commit message, changes and
+// warnings are those of the handler. The commit sha is empty, if nothing has
+// been pushed.
+type Run struct {
+	Message   string
+	CommitSHA string
+	Changes   []krm.Change
+	Warnings  []string
+}
+
+// run the post hook of the group. The hook may return None or a dict of
+// outputs, such as the url of a pull request. Any other return value is
+// treated as error.
+func (runner *PostHookRunner) Run(ctx context.Context, group model.TaskGroup, run Run, state ChainState) (map[string]string, error) {
 	if group.PostHook == nil {
-		return nil
+		return nil, nil
+	}
+
+	kwargs, err := runner.kwargs(group, run, state)
+	if err != nil {
+		return nil, err
 	}
 
-	res, err := runMain(defaultThread(group.Fingerprint), "post_hook", group.PostHook, runner.args(group, msg, changes, warnings), runner.hostEnv)
+	res, err := runMain(ctx, defaultThread(group.Fingerprint), "post_hook", group.PostHook, runner.args(group, run.Message, run.Changes, run.Warnings), nil, kwargs, runner.environ,
+		HostEnv{Env: group.PostHookEnv, Secrets: group.PostHookSecrets, Hosts: group.PostHookHosts})
 	if err != nil {
-		return fmt.Errorf("run main: %w", err)
+		return nil, fmt.Errorf("run main: %w", err)
 	}
 
-	if res != starlark.None {
-		return fmt.Errorf("post_hook returned %s", res.String())
+	switch v := res.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case *starlark.Dict:
+		return asOutputs(v)
+	default:
+		return nil, fmt.Errorf("post_hook returned %s", res.String())
 	}
+}
 
-	return nil
+// convert the dict returned by a post hook into outputs. Keys must be strings.
+// Values are converted to their string representation.
+func asOutputs(d *starlark.Dict) (map[string]string, error) {
+	outputs := make(map[string]string, d.Len())
+	for _, item := range d.Items() {
+		k, ok := starlark.AsString(item[0])
+		if !ok {
+			return nil, fmt.Errorf("post_hook output key: expected string, got %s", item[0].Type())
+		}
+		if s, ok := starlark.AsString(item[1]); ok {
+			outputs[k] = s
+		} else {
+			outputs[k] = item[1].String()
+		}
+	}
+	return outputs, nil
 }
 
 func (runner *PostHookRunner) args(group model.TaskGroup, msg string, changes []krm.Change, warnings []string) starlark.Tuple {
@@ -75,3 +127,125 @@ func (runner *PostHookRunner) args(group model.TaskGroup, msg string, changes []
 
 	return starlark.Tuple([]starlark.Value{r, sb, db, t, b, ch, warns})
 }
+
+// the names of the keyword arguments, that are passed to every post hook.
+// Post hook args must not use them.
+var PostHookKwargs = []string{"pr_options", "status", "error", "outputs", "run"}
+
+// the keyword arguments of the post hook. The pr options of the pipeline are
+// passed as dict, so that pull request hooks can honor them. The state of the
+// chain is passed as status, error and outputs. The run is passed as dict,
+// with its metadata, the decoded events, and the changes and warnings in
+// structured form, since the positional arguments only carry their
+// descriptions. The post hook args of the pipeline are passed as they are.
+func (runner *PostHookRunner) kwargs(group model.TaskGroup, run Run, state ChainState) ([]starlark.Tuple, error) {
+	kwargs, err := argsToKwargs(group.PostHookArgs, PostHookKwargs...)
+	if err != nil {
+		return nil, err
+	}
+
+	var autoMerge starlark.Value = starlark.None
+	if group.PrAutoMerge.Valid {
+		autoMerge = starlark.String(group.PrAutoMerge.String)
+	}
+
+	opts := starlark.NewDict(5)
+	for k, v := range map[string]starlark.Value{
+		"labels":         stringList(group.PrLabels),
+		"reviewers":      stringList(group.PrReviewers),
+		"team_reviewers": stringList(group.PrTeamReviewers),
+		"draft":          starlark.Bool(group.PrDraft.Bool),
+		"auto_merge":     autoMerge,
+	} {
+		if err := opts.SetKey(starlark.String(k), v); err != nil {
+			panic(err)
+		}
+	}
+
+	outputs := starlark.NewDict(len(state.Outputs))
+	for k, v := range state.Outputs {
+		if err := outputs.SetKey(starlark.String(k), starlark.String(v)); err != nil {
+			panic(err)
+		}
+	}
+
+	changes := make([]starlark.Value, 0, len(run.Changes))
+	for _, c := range run.Changes {
+		changes = append(changes, changeDict(c))
+	}
+
+	events := make([]starlark.Value, 0, len(group.Events))
+	for _, e := range group.Events {
+		events = append(events, eventDict(e))
+	}
+
+	r := starlark.NewDict(7)
+	for k, v := range map[string]starlark.Value{
+		"fingerprint": starlark.String(group.Fingerprint),
+		"pipeline":    starlark.String(group.PipelineName.String),
+		"commit_sha":  starlark.String(run.CommitSHA),
+		"task_ids":    stringList(group.TaskIds),
+		"changes":     starlark.NewList(changes),
+		"warnings":    stringList(run.Warnings),
+		"events":      starlark.NewList(events),
+	} {
+		if err := r.SetKey(starlark.String(k), v); err != nil {
+			panic(err)
+		}
+	}
+	r.Freeze()
+
+	return append(kwargs,
+		starlark.Tuple{starlark.String("pr_options"), opts},
+		starlark.Tuple{starlark.String("status"), starlark.String(state.Status)},
+		starlark.Tuple{starlark.String("error"), starlark.String(state.Error)},
+		starlark.Tuple{starlark.String("outputs"), outputs},
+		starlark.Tuple{starlark.String("run"), r},
+	), nil
+}
+
+// convert a decoded event to a frozen dict, with the keys of its json form.
+func eventDict(e store.Event) *starlark.Dict {
+	labels := stringDict(e.Labels)
+	labels.Freeze()
+	d := starlark.NewDict(3)
+	for k, v := range map[string]starlark.Value{
+		"ref":    starlark.String(e.Ref),
+		"action": starlark.String(e.Action),
+		"labels": labels,
+	} {
+		if err := d.SetKey(starlark.String(k), v); err != nil {
+			panic(err)
+		}
+	}
+	d.Freeze()
+	return d
+}
+
+// convert a change to a frozen dict, with the keys of its json form.
+func changeDict(c krm.Change) *starlark.Dict {
+	d := starlark.NewDict(7)
+	for k, v := range map[string]string{
+		"description": c.Description,
+		"registry":    c.Registry,
+		"repo":        c.Repo,
+		"old_ref":     c.OldRef,
+		"new_ref":     c.NewRef,
+		"file":        c.File,
+		"path":        c.Path,
+	} {
+		if err := d.SetKey(starlark.String(k), starlark.String(v)); err != nil {
+			panic(err)
+		}
+	}
+	d.Freeze()
+	return d
+}
+
+func stringList(items []string) *starlark.List {
+	list := make([]starlark.Value, 0, len(items))
+	for _, i := range items {
+		list = append(list, starlark.String(i))
+	}
+	return starlark.NewList(list)
+}
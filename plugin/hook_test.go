@@ -0,0 +1,263 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/bluebrown/kobold/krm"
+	"github.com/bluebrown/kobold/plugin/builtin"
+	"github.com/bluebrown/kobold/store"
+	"github.com/bluebrown/kobold/store/model"
+	"github.com/volatiletech/null/v8"
+)
+
+func TestPostHookRunner_Outputs(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		script  string
+		args    store.Args
+		state   ChainState
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "none",
+			script: `def main(*args): return None`,
+			want:   nil,
+		},
+		{
+			name:   "outputs",
+			script: `def main(*args): return {"pr_url": "https://example.com/pr/1", "pr_number": 1}`,
+			want:   map[string]string{"pr_url": "https://example.com/pr/1", "pr_number": "1"},
+		},
+		{
+			name:   "args",
+			script: `def main(*args, team, retries = 1): return {"team": team, "retries": retries}`,
+			args:   store.Args{"team": "platform", "retries": 3},
+			want:   map[string]string{"team": "platform", "retries": "3"},
+		},
+		{
+			name:   "chain state",
+			script: `def main(*args, status, error, outputs): return {"status": status, "error": error, "pr": outputs["pr_url"]}`,
+			state:  ChainState{Status: "failure", Error: "notify: boom", Outputs: map[string]string{"pr_url": "https://example.com/pr/1"}},
+			want:   map[string]string{"status": "failure", "error": "notify: boom", "pr": "https://example.com/pr/1"},
+		},
+		{
+			name:   "positional",
+			script: `def main(repo, src_branch, dest_branch, title, body, changes, warnings): return {"title": title, "change": changes[0]}`,
+			want:   map[string]string{"title": "title", "change": "a -> b"},
+		},
+		{
+			name: "run",
+			script: `
+def main(*args, run):
+    c, e = run["changes"][0], run["events"][0]
+    return {"run": run["fingerprint"] + " " + run["commit_sha"] + " " + ",".join(run["task_ids"]), "change": c["new_ref"] + " " + c["path"], "event": e["ref"] + " " + e["labels"]["arch"]}
+`,
+			want: map[string]string{"run": "test abc 1,2", "change": "b spec.image", "event": "b amd64"},
+		},
+		{
+			name:    "reserved arg",
+			script:  `def main(*args, **kwargs): return None`,
+			args:    store.Args{"pr_options": "x"},
+			wantErr: true,
+		},
+		{
+			name:    "error string",
+			script:  `def main(*args): return "pr failed"`,
+			wantErr: true,
+		},
+		{
+			name:    "non string key",
+			script:  `def main(*args): return {1: "one"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			group := model.TaskGroup{
+				Fingerprint:  "test",
+				TaskIds:      store.FlatList{"1", "2"},
+				Events:       store.EventList{{Ref: "b", Action: "push", Labels: map[string]string{"arch": "amd64"}}},
+				PostHook:     []byte(tt.script),
+				PostHookArgs: tt.args,
+			}
+			run := Run{Message: "title\n\nbody", CommitSHA: "abc", Changes: []krm.Change{{Description: "a -> b", OldRef: "a", NewRef: "b", Path: "spec.image"}}}
+			got, err := NewPostHookRunner().Run(context.Background(), group, run, tt.state)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Run() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostHookRunner_GitLabMR(t *testing.T) {
+	t.Parallel()
+
+	var script []byte
+	var env []string
+	for _, h := range builtin.PostHooks() {
+		if h.Name == "builtin.gitlab-mr@v1" {
+			script, env = []byte(h.Script), h.Env
+		}
+	}
+
+	reqs := map[string]map[string]any{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("PRIVATE-TOKEN"); got != "secret" {
+			t.Errorf("private token = %q", got)
+		}
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		reqs[r.Method+" "+r.URL.EscapedPath()] = body
+		if r.Method == http.MethodPut {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"iid": 4, "web_url": "https://gitlab.example.com/org/sub/app/-/merge_requests/4"}`))
+	}))
+	defer srv.Close()
+
+	runner := &PostHookRunner{environ: []string{
+		"GITLAB_API_URL=" + srv.URL + "/api/v4",
+		"GITLAB_TOKEN=secret",
+	}}
+
+	group := model.TaskGroup{
+		PostHook:      script,
+		PostHookEnv:   env,
+		PostHookHosts: store.FlatList{srv.Listener.Addr().String()},
+		PostHookArgs:  store.Args{"remove_source_branch": true, "assignee_ids": []any{1, 2}, "merge_when_pipeline_succeeds": true},
+		PrLabels:      store.FlatList{"kobold", "deps"},
+	}
+	group.RepoUri.MustUnmarshalText("ssh://git@gitlab.example.com:2222/org/sub/app.git?ref=main")
+	group.DestBranch.SetValid("kobold")
+
+	got, err := runner.Run(context.Background(), group, Run{Message: "title\n\nbody"}, ChainState{Status: "success"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"pr_url":                       "https://gitlab.example.com/org/sub/app/-/merge_requests/4",
+		"pr_number":                    "4",
+		"merge_when_pipeline_succeeds": "true",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Run() = %v, want %v", got, want)
+	}
+
+	wantReqs := map[string]map[string]any{
+		"POST /api/v4/projects/org%2Fsub%2Fapp/merge_requests": {
+			"title":                "title",
+			"description":          "body",
+			"source_branch":        "kobold",
+			"target_branch":        "main",
+			"remove_source_branch": true,
+			"squash":               false,
+			"labels":               "kobold,deps",
+			"assignee_ids":         []any{float64(1), float64(2)},
+		},
+		"PUT /api/v4/projects/org%2Fsub%2Fapp/merge_requests/4/merge": {
+			"merge_when_pipeline_succeeds": true,
+			"should_remove_source_branch":  true,
+			"squash":                       false,
+		},
+	}
+	if !reflect.DeepEqual(reqs, wantReqs) {
+		t.Errorf("requests = %v, want %v", reqs, wantReqs)
+	}
+}
+
+func TestPostHookRunner_GitHubPROptions(t *testing.T) {
+	t.Parallel()
+
+	var script []byte
+	var env []string
+	for _, h := range builtin.PostHooks() {
+		if h.Name == "builtin.github-pr@v1" {
+			script, env = []byte(h.Script), h.Env
+		}
+	}
+
+	reqs := map[string]map[string]any{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		reqs[r.URL.Path] = body
+		switch r.URL.Path {
+		case "/repos/acme/app/pulls":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"number": 5, "node_id": "PR_5", "html_url": "https://github.com/acme/app/pull/5"}`))
+		case "/repos/acme/app/pulls/5/requested_reviewers":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	runner := &PostHookRunner{environ: []string{
+		"GITHUB_API_URL=" + srv.URL,
+		"GITHUB_TOKEN=secret",
+	}}
+
+	group := model.TaskGroup{
+		PostHook:        script,
+		PostHookEnv:     env,
+		PostHookHosts:   store.FlatList{srv.Listener.Addr().String()},
+		PrLabels:        store.FlatList{"kobold"},
+		PrReviewers:     store.FlatList{"alice"},
+		PrTeamReviewers: store.FlatList{"platform"},
+		PrDraft:         null.BoolFrom(true),
+		PrAutoMerge:     null.StringFrom("squash"),
+	}
+	group.RepoUri.MustUnmarshalText("git@github.com:acme/app.git?ref=main")
+	group.DestBranch.SetValid("kobold")
+
+	got, err := runner.Run(context.Background(), group, Run{Message: "title\n\nbody"}, ChainState{Status: "success"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"pr_url": "https://github.com/acme/app/pull/5", "pr_number": "5"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Run() = %v, want %v", got, want)
+	}
+
+	if draft := reqs["/repos/acme/app/pulls"]["draft"]; draft != true {
+		t.Errorf("draft = %v, want true", draft)
+	}
+
+	for path, want := range map[string]any{
+		"/repos/acme/app/issues/5/labels":             map[string]any{"labels": []any{"kobold"}},
+		"/repos/acme/app/pulls/5/requested_reviewers": map[string]any{"reviewers": []any{"alice"}, "team_reviewers": []any{"platform"}},
+		"/graphql": map[string]any{"id": "PR_5", "method": "SQUASH"},
+	} {
+		got := any(reqs[path])
+		if path == "/graphql" {
+			got = reqs[path]["variables"]
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/bluebrown/kobold/krm"
+	"github.com/bluebrown/kobold/scm"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/qri-io/starlib"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// the name under which scripts load the kobold module, i.e.
+// load("kobold.star", "kobold").
+const koboldModuleName = "kobold.star"
+
+// the kobold module offers the parsing and matching of kobold itself, so that
+// scripts dont have to reimplement it.
+var koboldModule = &starlarkstruct.Module{
+	Name: "kobold",
+	Members: starlark.StringDict{
+		"parse_ref":      starlark.NewBuiltin("parse_ref", parseRef),
+		"parse_repo":     starlark.NewBuiltin("parse_repo", parseRepo),
+		"match_tag":      starlark.NewBuiltin("match_tag", matchTag),
+		"semver_parse":   starlark.NewBuiltin("semver_parse", semverParse),
+		"semver_compare": starlark.NewBuiltin("semver_compare", semverCompare),
+		"semver_check":   starlark.NewBuiltin("semver_check", semverCheck),
+	},
+}
+
+// load the kobold module, or any of the starlib modules.
+func loader(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+	if module == koboldModuleName {
+		return starlark.StringDict{"kobold": koboldModule}, nil
+	}
+	return starlib.Loader(thread, module)
+}
+
+// an image reference, as passed to and returned by decoders. The tag and
+// digest are optional. The registry and repository are normalized, i.e.
+// busybox becomes index.docker.io/library/busybox.
+type imageRef struct {
+	repo   name.Repository
+	tag    string
+	digest string
+}
+
+var (
+	_ starlark.HasAttrs   = imageRef{}
+	_ starlark.Comparable = imageRef{}
+)
+
+func newImageRef(s string) (imageRef, error) {
+	raw, digest, hasDigest := strings.Cut(s, "@")
+
+	var ref imageRef
+	// A colon after the last slash separates the tag. Otherwise, it is the
+	// port of the registry.
+	if i := strings.LastIndex(raw, ":"); i > strings.LastIndex(raw, "/") {
+		tag, err := name.NewTag(raw, name.WeakValidation)
+		if err != nil {
+			return imageRef{}, fmt.Errorf("invalid ref %q: %w", s, err)
+		}
+		ref.repo, ref.tag = tag.Context(), tag.TagStr()
+	} else {
+		repo, err := name.NewRepository(raw, name.WeakValidation)
+		if err != nil {
+			return imageRef{}, fmt.Errorf("invalid ref %q: %w", s, err)
+		}
+		ref.repo = repo
+	}
+
+	if hasDigest {
+		return ref.withDigest(digest)
+	}
+	return ref, nil
+}
+
+func (r imageRef) withTag(tag string) (imageRef, error) {
+	if _, err := name.NewTag(r.repo.Name()+":"+tag, name.WeakValidation); err != nil {
+		return imageRef{}, fmt.Errorf("invalid tag %q: %w", tag, err)
+	}
+	// The digest belongs to the old tag, and is dropped.
+	return imageRef{repo: r.repo, tag: tag}, nil
+}
+
+func (r imageRef) withDigest(digest string) (imageRef, error) {
+	if _, err := name.NewDigest(r.repo.Name()+"@"+digest, name.WeakValidation); err != nil {
+		return imageRef{}, fmt.Errorf("invalid digest %q: %w", digest, err)
+	}
+	return imageRef{repo: r.repo, tag: r.tag, digest: digest}, nil
+}
+
+func (r imageRef) String() string {
+	s := r.repo.Name()
+	if r.tag != "" {
+		s += ":" + r.tag
+	}
+	if r.digest != "" {
+		s += "@" + r.digest
+	}
+	return s
+}
+
+func (r imageRef) Type() string         { return "kobold.ref" }
+func (r imageRef) Freeze()              {}
+func (r imageRef) Truth() starlark.Bool { return starlark.True }
+
+func (r imageRef) Hash() (uint32, error) {
+	return starlark.String(r.String()).Hash()
+}
+
+func (r imageRef) CompareSameType(op syntax.Token, y starlark.Value, depth int) (bool, error) {
+	return starlark.Compare(op, starlark.String(r.String()), starlark.String(y.(imageRef).String()))
+}
+
+func (r imageRef) AttrNames() []string {
+	return []string{"digest", "name", "registry", "repository", "tag", "with_digest", "with_tag"}
+}
+
+func (r imageRef) Attr(attr string) (starlark.Value, error) {
+	switch attr {
+	case "registry":
+		return starlark.String(r.repo.RegistryStr()), nil
+	case "repository":
+		return starlark.String(r.repo.RepositoryStr()), nil
+	case "name":
+		return starlark.String(r.repo.Name()), nil
+	case "tag":
+		return starlark.String(r.tag), nil
+	case "digest":
+		return starlark.String(r.digest), nil
+	case "with_tag":
+		return r.method(attr, "tag", r.withTag), nil
+	case "with_digest":
+		return r.method(attr, "digest", r.withDigest), nil
+	}
+	return nil, nil
+}
+
+// a builtin, taking a single string, and returning a new ref.
+func (r imageRef) method(builtin, param string, fn func(string) (imageRef, error)) *starlark.Builtin {
+	return starlark.NewBuiltin(builtin, func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var s string
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, param, &s); err != nil {
+			return nil, err
+		}
+		ref, err := fn(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", b.Name(), err)
+		}
+		return ref, nil
+	}).BindReceiver(r)
+}
+
+func parseRef(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "ref", &s); err != nil {
+		return nil, err
+	}
+	ref, err := newImageRef(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	return ref, nil
+}
+
+func parseRepo(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "url", &s); err != nil {
+		return nil, err
+	}
+	repo, err := scm.ParseRepo(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"host":  starlark.String(repo.Host),
+		"owner": starlark.String(repo.Owner),
+		"name":  starlark.String(repo.Name),
+		"path":  starlark.String(repo.Path()),
+	}), nil
+}
+
+// match a tag against options, in the same format as the kobold comments in
+// manifests, i.e. "type: semver; tag: ^1".
+func matchTag(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var tag, expr string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "tag", &tag, "opts", &expr); err != nil {
+		return nil, err
+	}
+	opts, err := krm.ParseOpts(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	ok, err := krm.MatchTag(tag, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	return starlark.Bool(ok), nil
+}
+
+// parse a version into its major, minor, patch, prerelease and metadata. A
+// version, which is not a valid semver, i.e. latest, is None.
+func semverParse(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var version string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "version", &version); err != nil {
+		return nil, err
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return starlark.None, nil //nolint:nilerr
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"major":      starlark.MakeInt64(v.Major()),
+		"minor":      starlark.MakeInt64(v.Minor()),
+		"patch":      starlark.MakeInt64(v.Patch()),
+		"prerelease": starlark.String(v.Prerelease()),
+		"metadata":   starlark.String(v.Metadata()),
+	}), nil
+}
+
+// compare two versions, returning -1, 0 or 1.
+func semverCompare(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var x, y string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "a", &x, "b", &y); err != nil {
+		return nil, err
+	}
+	vx, err := semver.NewVersion(x)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %q: %w", b.Name(), x, err)
+	}
+	vy, err := semver.NewVersion(y)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %q: %w", b.Name(), y, err)
+	}
+	return starlark.MakeInt(vx.Compare(vy)), nil
+}
+
+// check if the version satisfies the constraint. A version, which is not a
+// valid semver, does not satisfy any constraint.
+func semverCheck(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var constraint, version string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "constraint", &constraint, "version", &version); err != nil {
+		return nil, err
+	}
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %q: %w", b.Name(), constraint, err)
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return starlark.False, nil //nolint:nilerr
+	}
+	return starlark.Bool(c.Check(v)), nil
+}
@@ -0,0 +1,58 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+)
+
+func TestKoboldModule(t *testing.T) {
+	t.Parallel()
+
+	digest := "sha256:" + "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+
+	tests := []struct {
+		name    string
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{name: "ref name", expr: `kobold.parse_ref("busybox:1.0").name`, want: `"index.docker.io/library/busybox"`},
+		{name: "ref parts", expr: `[kobold.parse_ref("localhost:5000/a/b:1.0").registry, kobold.parse_ref("localhost:5000/a/b:1.0").repository]`, want: `["localhost:5000", "a/b"]`},
+		{name: "ref no tag", expr: `kobold.parse_ref("test.azurecr.io/busybox").tag`, want: `""`},
+		{name: "ref digest", expr: `kobold.parse_ref("test.azurecr.io/busybox:1.0@` + digest + `").digest`, want: `"` + digest + `"`},
+		{name: "ref with tag", expr: `str(kobold.parse_ref("test.azurecr.io/busybox:1.0@` + digest + `").with_tag("1.1"))`, want: `"test.azurecr.io/busybox:1.1"`},
+		{name: "ref with digest", expr: `str(kobold.parse_ref("test.azurecr.io/busybox").with_tag("1.1").with_digest("` + digest + `"))`, want: `"test.azurecr.io/busybox:1.1@` + digest + `"`},
+		{name: "ref equal", expr: `kobold.parse_ref("busybox:1.0") == kobold.parse_ref("docker.io/library/busybox:1.0")`, want: `True`},
+		{name: "ref invalid", expr: `kobold.parse_ref("Busybox:1.0")`, wantErr: true},
+		{name: "ref invalid tag", expr: `kobold.parse_ref("busybox").with_tag("a b")`, wantErr: true},
+		{name: "ref invalid digest", expr: `kobold.parse_ref("busybox@sha256:x")`, wantErr: true},
+		{name: "repo https", expr: `kobold.parse_repo("https://github.com/bluebrown/kobold.git").path`, want: `"bluebrown/kobold"`},
+		{name: "repo scp", expr: `[kobold.parse_repo("git@gitlab.com:a/b/c.git").host, kobold.parse_repo("git@gitlab.com:a/b/c.git").owner]`, want: `["gitlab.com", "a/b"]`},
+		{name: "repo invalid", expr: `kobold.parse_repo("kobold")`, wantErr: true},
+		{name: "semver parse", expr: `[(v.major, v.minor, v.patch, v.prerelease) for v in [kobold.semver_parse("v1.2.3-rc.1"), kobold.semver_parse("2")]]`, want: `[(1, 2, 3, "rc.1"), (2, 0, 0, "")]`},
+		{name: "semver parse invalid", expr: `[kobold.semver_parse("latest"), kobold.semver_parse("sha-abc")]`, want: `[None, None]`},
+		{name: "semver compare", expr: `[kobold.semver_compare("1.0.0", "v1.1"), kobold.semver_compare("1.1", "1.1.0"), kobold.semver_compare("2", "1.9")]`, want: `[-1, 0, 1]`},
+		{name: "semver compare invalid", expr: `kobold.semver_compare("latest", "1.0")`, wantErr: true},
+		{name: "semver check", expr: `[kobold.semver_check("^1", "1.2.3"), kobold.semver_check("^1", "2.0.0"), kobold.semver_check("^1", "latest")]`, want: `[True, False, False]`},
+		{name: "semver check invalid", expr: `kobold.semver_check("^^", "1.0")`, wantErr: true},
+		{name: "match tag", expr: `[kobold.match_tag("1.2.3", "type: semver; tag: ~1.2"), kobold.match_tag("1.2.3-rc", "type: regex; tag: .*-rc")]`, want: `[True, True]`},
+		{name: "match tag invalid", expr: `kobold.match_tag("1.2.3", "type: glob")`, wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			script := "load(\"kobold.star\", \"kobold\")\n\ndef main():\n    return " + tt.expr + "\n"
+			got, err := runMain(context.Background(), defaultThread("test"), "test", []byte(script), nil, nil, nil, nil, HostEnv{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runMain() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if s := got.String(); s != tt.want {
+				t.Errorf("runMain() = %s, want %s", s, tt.want)
+			}
+		})
+	}
+}
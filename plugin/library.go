@@ -0,0 +1,111 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// the prefix of library modules, i.e. load("lib/auth.star", "bearer").
+const libraryPrefix = "lib/"
+
+// returns the script of the named library module. If no such module exists,
+// the error wraps sql.ErrNoRows or fs.ErrNotExist.
+type LibraryFunc func(ctx context.Context, name string) ([]byte, error)
+
+// check that the name of a library module is a relative, slash separated path
+// ending in .star, such as github/auth.star.
+func CheckLibraryName(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return fmt.Errorf("library %q: invalid path", name)
+	}
+	if path.Ext(name) != ".star" {
+		return fmt.Errorf("library %q: must end in .star", name)
+	}
+	return nil
+}
+
+type librariesKey struct{}
+
+// return a copy of ctx, whose scripts load library modules with fn.
+func WithLibraries(ctx context.Context, fn LibraryFunc) context.Context {
+	return context.WithValue(ctx, librariesKey{}, fn)
+}
+
+func librariesFrom(ctx context.Context) LibraryFunc {
+	if fn, ok := ctx.Value(librariesKey{}).(LibraryFunc); ok {
+		return fn
+	}
+	return nil
+}
+
+// a library module, loaded by a script. The globals are nil, while the module
+// is being loaded, which detects load cycles.
+type libraryEntry struct {
+	globals starlark.StringDict
+	err     error
+}
+
+// wrap the load function of a thread, so that modules prefixed with lib/ are
+// loaded from the libraries carried by ctx. Each module is executed once per
+// script, and sees the same host env as the script. Library modules may load
+// other modules, including libraries.
+func libraryLoader(ctx context.Context, hostEnv *starlark.Dict, load func(*starlark.Thread, string) (starlark.StringDict, error)) func(*starlark.Thread, string) (starlark.StringDict, error) {
+	var (
+		libraries = librariesFrom(ctx)
+		cache     = make(map[string]*libraryEntry)
+	)
+
+	return func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+		name, ok := strings.CutPrefix(module, libraryPrefix)
+		if !ok {
+			return load(thread, module)
+		}
+
+		if e, ok := cache[name]; ok {
+			if e == nil {
+				return nil, fmt.Errorf("cycle in load graph of %q", module)
+			}
+			return e.globals, e.err
+		}
+
+		cache[name] = nil
+		globals, err := execLibrary(ctx, thread, libraries, name, hostEnv)
+		cache[name] = &libraryEntry{globals: globals, err: err}
+
+		return globals, err
+	}
+}
+
+func execLibrary(ctx context.Context, thread *starlark.Thread, libraries LibraryFunc, name string, hostEnv *starlark.Dict) (starlark.StringDict, error) {
+	if err := CheckLibraryName(name); err != nil {
+		return nil, err
+	}
+
+	if libraries == nil {
+		return nil, fmt.Errorf("library %q not found", name)
+	}
+
+	script, err := libraries(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("library %q not found", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("library %q: %w", name, err)
+	}
+
+	globals, err := starlark.ExecFile(thread, libraryPrefix+name, script, starlark.StringDict{"host_env": hostEnv})
+	if err != nil {
+		return nil, fmt.Errorf("library %q: %w", name, err)
+	}
+
+	globals.Freeze()
+
+	return globals, nil
+}
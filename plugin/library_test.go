@@ -0,0 +1,95 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestRunMain_Libraries(t *testing.T) {
+	t.Parallel()
+
+	libs := map[string]string{
+		"auth.star": `
+def bearer(name):
+    return {"Authorization": "Bearer " + host_env[name]}
+`,
+		"github/api.star": `
+load("lib/auth.star", "bearer")
+load("kobold.star", "kobold")
+def headers():
+    return bearer("GITHUB_TOKEN")
+def owner(repo):
+    return kobold.parse_repo(repo).owner
+`,
+		"cycle/a.star": `load("lib/cycle/b.star", "b")`,
+		"cycle/b.star": `load("lib/cycle/a.star", "a")`,
+	}
+
+	library := func(_ context.Context, name string) ([]byte, error) {
+		s, ok := libs[name]
+		if !ok {
+			return nil, sql.ErrNoRows
+		}
+		return []byte(s), nil
+	}
+
+	tests := []struct {
+		name    string
+		script  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "host env",
+			script: `
+load("lib/auth.star", "bearer")
+def main():
+    return bearer("GITHUB_TOKEN")
+`,
+			want: `{"Authorization": "Bearer secret"}`,
+		},
+		{
+			name: "nested",
+			script: `
+load("lib/github/api.star", "headers", "owner")
+load("lib/auth.star", "bearer")
+def main():
+    return [headers() == bearer("GITHUB_TOKEN"), owner("https://github.com/bluebrown/kobold")]
+`,
+			want: `[True, "bluebrown"]`,
+		},
+		{
+			name:    "not found",
+			script:  `load("lib/missing.star", "x")`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid name",
+			script:  `load("lib/../auth.star", "bearer")`,
+			wantErr: true,
+		},
+		{
+			name:    "cycle",
+			script:  `load("lib/cycle/a.star", "b")`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := WithLibraries(context.Background(), library)
+			got, err := runMain(ctx, defaultThread("test"), "test", []byte(tt.script), nil, nil, nil, []string{"GITHUB_TOKEN=secret"}, HostEnv{Env: []string{"GITHUB_TOKEN"}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runMain() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.String() != tt.want {
+				t.Errorf("runMain() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	starlibhttp "github.com/qri-io/starlib/http"
+	"go.starlark.net/starlark"
+)
+
+// the execution limits of scripts. The steps are the abstract computation
+// steps of the starlark interpreter. The timeout is the wall clock time, a
+// script may run, including its http requests, which are additionally limited
+// by the http timeout. A zero value means no limit.
+type Limits struct {
+	MaxSteps    uint64
+	Timeout     time.Duration
+	HTTPTimeout time.Duration
+}
+
+// the limits used, if the context of a script carries none.
+var DefaultLimits = Limits{
+	MaxSteps:    10_000_000,
+	Timeout:     time.Minute,
+	HTTPTimeout: 30 * time.Second,
+}
+
+// the reasons, a script is stopped, before it returned.
+var (
+	ErrMaxSteps    = errors.New("max steps exceeded")
+	ErrTimeout     = errors.New("timeout exceeded")
+	ErrHTTPTimeout = errors.New("http timeout exceeded")
+)
+
+type limitsKey struct{}
+
+// return a copy of ctx, carrying the given limits. Scripts run with the
+// returned context, are limited by them.
+func WithLimits(ctx context.Context, l Limits) context.Context {
+	return context.WithValue(ctx, limitsKey{}, l)
+}
+
+func limitsFrom(ctx context.Context) Limits {
+	if l, ok := ctx.Value(limitsKey{}).(Limits); ok {
+		return l
+	}
+	return DefaultLimits
+}
+
+type transportKey struct{}
+
+// return a copy of ctx, whose scripts send their http requests through rt,
+// instead of the default transport. The requests are still checked against
+// the allowed hosts. This allows to mock the http layer of scripts.
+func WithTransport(ctx context.Context, rt http.RoundTripper) context.Context {
+	return context.WithValue(ctx, transportKey{}, rt)
+}
+
+func transportFrom(ctx context.Context) http.RoundTripper {
+	if rt, ok := ctx.Value(transportKey{}).(http.RoundTripper); ok {
+		return rt
+	}
+	return http.DefaultTransport
+}
+
+// the starlib http module reads its client from a package variable, when it
+// is loaded. The lock guards swapping it, so that each script gets its own
+// client.
+var httpModuleMu sync.Mutex
+
+// wrap the load function of a thread, so that the http module uses a client,
+// whose requests are canceled, once ctx is done, or the timeout is exceeded.
+// Requests are only made, if the guard allows them.
+func httpLoader(ctx context.Context, timeout time.Duration, guard starlibhttp.RequestGuard, load func(*starlark.Thread, string) (starlark.StringDict, error)) func(*starlark.Thread, string) (starlark.StringDict, error) {
+	return func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+		if module != starlibhttp.ModuleName {
+			return load(thread, module)
+		}
+
+		httpModuleMu.Lock()
+		defer httpModuleMu.Unlock()
+
+		client, prev := starlibhttp.Client, starlibhttp.Guard
+		defer func() { starlibhttp.Client, starlibhttp.Guard = client, prev }()
+
+		starlibhttp.Guard = guard
+		starlibhttp.Client = &http.Client{
+			Timeout:   timeout,
+			Transport: ctxTransport{ctx: ctx, base: transportFrom(ctx)},
+			// Redirects are checked against the allowlist, too.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 10 {
+					return errors.New("stopped after 10 redirects")
+				}
+				return guard.Allowed(req)
+			},
+		}
+
+		return starlibhttp.LoadModule()
+	}
+}
+
+// cancels the requests, once ctx is done.
+type ctxTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t ctxTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The script context is always canceled, when the script returns, so that
+	// the request context does not outlive it.
+	ctx, cancel := context.WithCancel(req.Context())
+	context.AfterFunc(t.ctx, cancel)
+	return t.base.RoundTrip(req.WithContext(ctx))
+}
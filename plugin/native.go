@@ -0,0 +1,81 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bluebrown/kobold/store"
+	"github.com/bluebrown/kobold/store/model"
+)
+
+// the prefix of native plugins, i.e. go.myorg-ecr@v1. Scripts must not use
+// it, so that a native plugin cannot be shadowed by a script.
+const NativePrefix = "go."
+
+// a decoder implemented in go. It receives the same input as a starlark
+// decoder, and returns the decoded events.
+type DecoderFunc func(ctx context.Context, data []byte, src Source, args map[string]any) ([]store.Event, error)
+
+// a post hook implemented in go. It receives the same input as a starlark
+// post hook, with the args of the hook in the group, and returns its outputs.
+type PostHookFunc func(ctx context.Context, group model.TaskGroup, run Run, state ChainState) (map[string]string, error)
+
+var (
+	nativeMu        sync.RWMutex
+	nativeDecoders  = make(map[string]DecoderFunc)
+	nativePostHooks = make(map[string]PostHookFunc)
+)
+
+// register a native decoder, so that channels can select it by name. It is
+// meant to be called from init functions, or before the config is applied. It
+// panics, if the name is invalid, or already registered.
+func RegisterDecoder(name string, fn DecoderFunc) {
+	nativeMu.Lock()
+	defer nativeMu.Unlock()
+	mustRegister("decoder", name, fn == nil, nativeDecoders[name] != nil)
+	nativeDecoders[name] = fn
+}
+
+// register a native post hook, so that pipelines can select it by name. It
+// panics, if the name is invalid, or already registered.
+func RegisterPostHook(name string, fn PostHookFunc) {
+	nativeMu.Lock()
+	defer nativeMu.Unlock()
+	mustRegister("post hook", name, fn == nil, nativePostHooks[name] != nil)
+	nativePostHooks[name] = fn
+}
+
+func mustRegister(kind, name string, isNil, exists bool) {
+	if !IsNative(name) || name == NativePrefix {
+		panic(fmt.Sprintf("register %s %q: name must start with %q", kind, name, NativePrefix))
+	}
+	if isNil {
+		panic(fmt.Sprintf("register %s %q: nil func", kind, name))
+	}
+	if exists {
+		panic(fmt.Sprintf("register %s %q: already registered", kind, name))
+	}
+}
+
+// report, if the name is that of a native plugin.
+func IsNative(name string) bool {
+	return strings.HasPrefix(name, NativePrefix)
+}
+
+// return the native decoder of the given name.
+func LookupDecoder(name string) (DecoderFunc, bool) {
+	nativeMu.RLock()
+	defer nativeMu.RUnlock()
+	fn, ok := nativeDecoders[name]
+	return fn, ok
+}
+
+// return the native post hook of the given name.
+func LookupPostHook(name string) (PostHookFunc, bool) {
+	nativeMu.RLock()
+	defer nativeMu.RUnlock()
+	fn, ok := nativePostHooks[name]
+	return fn, ok
+}
@@ -0,0 +1,44 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bluebrown/kobold/store"
+)
+
+func TestRegisterDecoder(t *testing.T) {
+	t.Parallel()
+
+	noop := func(context.Context, []byte, Source, map[string]any) ([]store.Event, error) { return nil, nil }
+
+	RegisterDecoder("go.test-registered@v1", noop)
+
+	tests := []struct {
+		name      string
+		give      string
+		fn        DecoderFunc
+		wantPanic bool
+	}{
+		{name: "valid", give: "go.test-valid@v1", fn: noop},
+		{name: "no prefix", give: "myorg-ecr@v1", fn: noop, wantPanic: true},
+		{name: "prefix only", give: "go.", fn: noop, wantPanic: true},
+		{name: "nil", give: "go.test-nil@v1", wantPanic: true},
+		{name: "duplicate", give: "go.test-registered@v1", fn: noop, wantPanic: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			defer func() {
+				if r := recover(); (r != nil) != tt.wantPanic {
+					t.Errorf("RegisterDecoder() panic = %v, wantPanic %v", r, tt.wantPanic)
+				}
+			}()
+			RegisterDecoder(tt.give, tt.fn)
+			if _, ok := LookupDecoder(tt.give); !ok {
+				t.Errorf("LookupDecoder(%q) not found", tt.give)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bluebrown/kobold/krm"
+	"github.com/bluebrown/kobold/store/model"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// returned, if a pre commit hook rejected the changes of a run.
+var ErrRejected = errors.New("rejected")
+
+type PreCommitRunner struct {
+	environ []string
+}
+
+func NewPreCommitRunner() *PreCommitRunner {
+	return &PreCommitRunner{
+		environ: os.Environ(),
+	}
+}
+
+// run the pre commit hook of the group, before its changes are committed. The
+// hook receives the changes, and read only access to the package at root. The
+// decoded events of the run are passed as keyword argument, so that the hook
+// can decide by their labels. It may return None to keep all changes, a string
+// to reject the run with that reason, or the list of changes to keep. The
+// changes to keep are returned.
+func (runner *PreCommitRunner) Run(ctx context.Context, group model.TaskGroup, root string, changes []krm.Change) ([]krm.Change, error) {
+	if group.PreCommit == nil {
+		return changes, nil
+	}
+
+	list := make([]starlark.Value, 0, len(changes))
+	for _, c := range changes {
+		list = append(list, changeDict(c))
+	}
+
+	args := starlark.Tuple{starlark.NewList(list), newWorkspace(root)}
+
+	var destBranch starlark.Value = starlark.None
+	if group.DestBranch.Valid {
+		destBranch = starlark.String(group.DestBranch.String)
+	}
+
+	events := make([]starlark.Value, 0, len(group.Events))
+	for _, e := range group.Events {
+		events = append(events, eventDict(e))
+	}
+
+	kwargs := []starlark.Tuple{
+		{starlark.String("events"), starlark.NewList(events)},
+		{starlark.String("pipeline"), starlark.String(group.PipelineName.String)},
+		{starlark.String("repo"), starlark.String(group.RepoUri.Repo)},
+		{starlark.String("src_branch"), starlark.String(group.RepoUri.Ref)},
+		{starlark.String("dest_branch"), destBranch},
+	}
+
+	res, err := runMain(ctx, defaultThread(group.Fingerprint), "pre_commit", group.PreCommit, args, nil, kwargs, runner.environ,
+		HostEnv{Env: group.PreCommitEnv, Secrets: group.PreCommitSecrets, Hosts: group.PreCommitHosts})
+	if err != nil {
+		return nil, fmt.Errorf("run main: %w", err)
+	}
+
+	switch v := res.(type) {
+	case starlark.NoneType:
+		return changes, nil
+	case starlark.String:
+		return nil, fmt.Errorf("%w: %s", ErrRejected, v.GoString())
+	case *starlark.List:
+		return keptChanges(v, list, changes)
+	default:
+		return nil, fmt.Errorf("pre_commit returned %s", res.String())
+	}
+}
+
+// map the list returned by the hook back to the changes. Each item must be one
+// of the changes passed to the hook.
+func keptChanges(kept *starlark.List, passed []starlark.Value, changes []krm.Change) ([]krm.Change, error) {
+	out := make([]krm.Change, 0, kept.Len())
+	for i := 0; i < kept.Len(); i++ {
+		found := false
+		for j, p := range passed {
+			if ok, err := starlark.Equal(kept.Index(i), p); err == nil && ok {
+				out = append(out, changes[j])
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("pre_commit returned unknown change %s", kept.Index(i).String())
+		}
+	}
+	return out, nil
+}
+
+// a read only view of a directory. Paths are slash separated and relative to
+// the root. They must not leave the root, neither by .. nor by symlinks.
+type workspace struct {
+	root string
+}
+
+func newWorkspace(root string) *starlarkstruct.Module {
+	w := workspace{root: root}
+	return &starlarkstruct.Module{
+		Name: "workspace",
+		Members: starlark.StringDict{
+			"read":   starlark.NewBuiltin("read", w.read),
+			"exists": starlark.NewBuiltin("exists", w.exists),
+			"glob":   starlark.NewBuiltin("glob", w.glob),
+		},
+	}
+}
+
+func (w workspace) path(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", fmt.Errorf("invalid path %q", name)
+	}
+
+	root, err := filepath.EvalSymlinks(w.root)
+	if err != nil {
+		return "", err
+	}
+
+	p, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		return "", err
+	}
+
+	if rel, err := filepath.Rel(root, p); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q is outside of the workspace", name)
+	}
+
+	return p, nil
+}
+
+func (w workspace) read(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &name); err != nil {
+		return nil, err
+	}
+	p, err := w.path(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	return starlark.String(data), nil
+}
+
+func (w workspace) exists(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "path", &name); err != nil {
+		return nil, err
+	}
+	_, err := w.path(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return starlark.False, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	return starlark.True, nil
+}
+
+func (w workspace) glob(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "pattern", &pattern); err != nil {
+		return nil, err
+	}
+	names, err := fs.Glob(os.DirFS(w.root), pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	list := make([]starlark.Value, 0, len(names))
+	for _, n := range names {
+		list = append(list, starlark.String(n))
+	}
+	return starlark.NewList(list), nil
+}
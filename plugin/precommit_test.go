@@ -0,0 +1,181 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bluebrown/kobold/krm"
+	"github.com/bluebrown/kobold/plugin/builtin"
+	"github.com/bluebrown/kobold/store"
+	"github.com/bluebrown/kobold/store/model"
+)
+
+func TestPreCommitRunner_Run(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "app"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "app", "deploy.yaml"), []byte("kind: Deployment"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(root), "secret"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(filepath.Dir(root), "secret"), filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := []krm.Change{
+		{Registry: "docker.io", Repo: "library/nginx", OldRef: "1.0", NewRef: "1.1", File: "app/deploy.yaml"},
+		{Registry: "docker.io", Repo: "library/redis", OldRef: "6.0", NewRef: "7.0", File: "app/deploy.yaml"},
+	}
+
+	tests := []struct {
+		name      string
+		script    string
+		events    store.EventList
+		want      []krm.Change
+		wantErr   bool
+		rejectErr bool
+	}{
+		{
+			name:   "keep all",
+			script: `def main(changes, workspace): return None`,
+			want:   changes,
+		},
+		{
+			name:      "reject",
+			script:    `def main(changes, workspace, dest_branch): return "direct push" if dest_branch == None else None`,
+			wantErr:   true,
+			rejectErr: true,
+		},
+		{
+			name: "drop",
+			script: `
+def main(changes, workspace):
+    return [c for c in changes if c["old_ref"].split(".")[0] == c["new_ref"].split(".")[0]]
+`,
+			want: changes[:1],
+		},
+		{
+			name:   "events",
+			script: `def main(changes, workspace, events): return [c for c in changes if c["repo"] not in [e["labels"].get("skip") for e in events]]`,
+			events: store.EventList{{Ref: "docker.io/library/redis:7.0", Action: "push", Labels: map[string]string{"skip": "library/redis"}}},
+			want:   changes[:1],
+		},
+		{
+			name: "workspace",
+			script: `
+def main(changes, workspace):
+    if not workspace.exists("app/deploy.yaml") or workspace.exists("app/missing.yaml"):
+        return "exists"
+    if workspace.glob("app/*.yaml") != ["app/deploy.yaml"]:
+        return "glob"
+    if workspace.read(changes[0]["file"]) != "kind: Deployment":
+        return "read"
+    return None
+`,
+			want: changes,
+		},
+		{
+			name:    "dotdot",
+			script:  `def main(changes, workspace): return workspace.read("../secret")`,
+			wantErr: true,
+		},
+		{
+			name:    "symlink",
+			script:  `def main(changes, workspace): return workspace.read("link")`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown change",
+			script:  `def main(changes, workspace): return [{"repo": "x"}]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			group := model.TaskGroup{Fingerprint: "test", PreCommit: []byte(tt.script), Events: tt.events}
+			got, err := NewPreCommitRunner().Run(context.Background(), group, root, changes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrRejected) != tt.rejectErr {
+				t.Errorf("Run() error = %v, rejected %v", err, tt.rejectErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Run() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreCommitRunner_NoMajor(t *testing.T) {
+	t.Parallel()
+
+	var script []byte
+	for _, d := range builtin.PreCommits() {
+		if d.Name == "builtin.no-major@v1" {
+			script = []byte(d.Script)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		changes []krm.Change
+		wantErr bool
+	}{
+		{
+			name: "minor",
+			changes: []krm.Change{
+				{Repo: "library/nginx", OldRef: "nginx:1.25.0", NewRef: "docker.io/library/nginx:1.26.0"},
+				{Repo: "library/redis", OldRef: "v6.0", NewRef: "docker.io/library/redis:v6.2@sha256:" + strings.Repeat("a", 64)},
+			},
+		},
+		{
+			name: "not semver",
+			changes: []krm.Change{
+				{Repo: "library/nginx", OldRef: "nginx:latest", NewRef: "docker.io/library/nginx:2.0.0"},
+				{Repo: "acme/app", OldRef: "localhost:5000/acme/app:sha-abc", NewRef: "localhost:5000/acme/app:sha-def"},
+				{Repo: "acme/lib", OldRef: "localhost:5000/acme/lib", NewRef: "localhost:5000/acme/lib:2.0.0"},
+			},
+		},
+		{
+			name: "major",
+			changes: []krm.Change{
+				{Repo: "library/nginx", OldRef: "nginx:1.25.0", NewRef: "docker.io/library/nginx:1.26.0"},
+				{Repo: "library/redis", OldRef: "6.2", NewRef: "docker.io/library/redis:7.0"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			group := model.TaskGroup{Fingerprint: "test", PreCommit: script}
+			got, err := NewPreCommitRunner().Run(context.Background(), group, t.TempDir(), tt.changes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrRejected) || !strings.Contains(err.Error(), "library/redis 6.2 -> 7.0") {
+					t.Errorf("Run() error = %v, want rejection of library/redis", err)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.changes) {
+				t.Errorf("Run() = %v, want all changes kept", got)
+			}
+		})
+	}
+}
@@ -3,15 +3,162 @@ package plugin
 // TODO: dont panic on error.
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
-	"github.com/qri-io/starlib"
 	"go.starlark.net/starlark"
 )
 
-func runMain(thread *starlark.Thread, name string, script []byte, args starlark.Tuple, hostEnv *starlark.Dict) (starlark.Value, error) {
+// the part of the host environment, a script may see as host_env, and the
+// hosts it may reach over http. Env lists the names of the variables, and may
+// contain patterns, such as GITHUB_*. Secrets map a name to a file, whose
+// content is exposed under that name. Hosts may contain patterns, such as
+// *.github.com, and a port, if the host is reached on a non default port.
+// Nothing is exposed or reachable by default.
+type HostEnv struct {
+	Env     []string
+	Secrets map[string]string
+	Hosts   []string
+}
+
+// check that the env and host patterns are valid, and that the secrets have a
+// file.
+func CheckHostEnv(env []string, secrets map[string]string, hosts []string) error {
+	for _, e := range env {
+		if e == "" {
+			return fmt.Errorf("env: empty name")
+		}
+		if _, err := path.Match(e, ""); err != nil {
+			return fmt.Errorf("env %q: %w", e, err)
+		}
+	}
+	for _, h := range hosts {
+		if h == "" {
+			return fmt.Errorf("hosts: empty host")
+		}
+		if _, err := path.Match(h, ""); err != nil {
+			return fmt.Errorf("host %q: %w", h, err)
+		}
+	}
+	for k, v := range secrets {
+		if k == "" {
+			return fmt.Errorf("secrets: empty name")
+		}
+		if v == "" {
+			return fmt.Errorf("secret %q: no file", k)
+		}
+	}
+	return nil
+}
+
+// build the host_env dict from the environ, with only the allowed variables,
+// and the secrets read from their files. The dict is frozen.
+func (h HostEnv) dict(environ []string) (*starlark.Dict, error) {
+	d := starlark.NewDict(len(h.Env) + len(h.Secrets))
+	for _, e := range environ {
+		key, val, ok := strings.Cut(e, "=")
+		if !ok || !h.allowed(key) {
+			continue
+		}
+		if err := d.SetKey(starlark.String(key), starlark.String(val)); err != nil {
+			return nil, err
+		}
+	}
+	for k, file := range h.Secrets {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("secret %q: %w", k, err)
+		}
+		if err := d.SetKey(starlark.String(k), starlark.String(strings.TrimSpace(string(b)))); err != nil {
+			return nil, err
+		}
+	}
+	d.Freeze()
+	return d, nil
+}
+
+func (h HostEnv) allowed(key string) bool {
+	for _, e := range h.Env {
+		if ok, _ := path.Match(e, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// run the main function of the script. The optional arguments are passed after
+// the args, as far as main accepts them. Keyword arguments are only passed, if
+// main declares a parameter of the same name, or accepts **kwargs. That way,
+// new arguments can be introduced, without breaking existing scripts. The
+// script sees only the host env, it is allowed to see. It may load the library
+// modules carried by ctx. It is canceled, once ctx is done, or it exceeds the
+// limits carried by ctx.
+func runMain(ctx context.Context, thread *starlark.Thread, name string, script []byte, args, optional starlark.Tuple, kwargs []starlark.Tuple, environ []string, env HostEnv) (starlark.Value, error) {
+	hostEnv, err := env.dict(environ)
+	if err != nil {
+		return nil, fmt.Errorf("host env: %w", err)
+	}
+
+	limits := limitsFrom(ctx)
+
+	var cancel context.CancelFunc
+	if limits.Timeout > 0 {
+		ctx, cancel = context.WithTimeoutCause(ctx, limits.Timeout, ErrTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	stop := context.AfterFunc(ctx, func() { thread.Cancel(context.Cause(ctx).Error()) })
+	defer stop()
+
+	var maxSteps bool
+	if limits.MaxSteps > 0 {
+		thread.SetMaxExecutionSteps(limits.MaxSteps)
+		thread.OnMaxSteps = func(thread *starlark.Thread) {
+			maxSteps = true
+			thread.Cancel(ErrMaxSteps.Error())
+		}
+	}
+
+	if thread.Load != nil {
+		thread.Load = libraryLoader(ctx, hostEnv, thread.Load)
+		thread.Load = httpLoader(ctx, limits.HTTPTimeout, egressGuard{fingerprint: thread.Name, hosts: env.Hosts}, thread.Load)
+	}
+
+	res, err := execMain(thread, name, script, args, optional, kwargs, hostEnv)
+
+	switch {
+	case err == nil:
+		return res, nil
+	case maxSteps:
+		return nil, fmt.Errorf("%w: %d", ErrMaxSteps, limits.MaxSteps)
+	case ctx.Err() != nil:
+		if cause := context.Cause(ctx); errors.Is(cause, ErrTimeout) {
+			return nil, fmt.Errorf("%w: %s", ErrTimeout, limits.Timeout)
+		}
+		return nil, fmt.Errorf("canceled: %w", context.Cause(ctx))
+	case errors.Is(err, ErrEgressDenied):
+		return nil, err
+	case isTimeout(err):
+		return nil, fmt.Errorf("%w: %s: %w", ErrHTTPTimeout, limits.HTTPTimeout, err)
+	}
+
+	return nil, err
+}
+
+func execMain(thread *starlark.Thread, name string, script []byte, args, optional starlark.Tuple, kwargs []starlark.Tuple, hostEnv *starlark.Dict) (starlark.Value, error) {
 	globals := starlark.StringDict{
 		"host_env": hostEnv,
 	}
@@ -23,7 +170,44 @@ func runMain(thread *starlark.Thread, name string, script []byte, args starlark.
 	if !ok {
 		return nil, fmt.Errorf("no main function defined")
 	}
-	return starlark.Call(thread, m, args, nil)
+	return starlark.Call(thread, m, acceptedArgs(m, args, optional), acceptedKwargs(m, kwargs))
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// the args, followed by as many of the optional args, as fn accepts.
+func acceptedArgs(fn starlark.Value, args, optional starlark.Tuple) starlark.Tuple {
+	n := len(args) + len(optional)
+	if f, ok := fn.(*starlark.Function); ok && !f.HasVarargs() {
+		n = f.NumParams() - f.NumKwonlyParams()
+		if f.HasKwargs() {
+			n--
+		}
+	}
+	accepted := append(starlark.Tuple{}, args...)
+	for i := 0; i < len(optional) && len(accepted) < n; i++ {
+		accepted = append(accepted, optional[i])
+	}
+	return accepted
+}
+
+func acceptedKwargs(fn starlark.Value, kwargs []starlark.Tuple) []starlark.Tuple {
+	f, ok := fn.(*starlark.Function)
+	if !ok || f.HasKwargs() {
+		return kwargs
+	}
+	var accepted []starlark.Tuple
+	for _, kv := range kwargs {
+		for i := 0; i < f.NumParams(); i++ {
+			if name, _ := f.Param(i); name == string(kv[0].(starlark.String)) {
+				accepted = append(accepted, kv)
+			}
+		}
+	}
+	return accepted
 }
 
 func asStringSlice(v starlark.Value) ([]string, error) {
@@ -45,26 +229,104 @@ func asStringSlice(v starlark.Value) ([]string, error) {
 	return slice, nil
 }
 
-func envToStarlarkDict(env []string) *starlark.Dict {
-	d := starlark.NewDict(0)
-	for _, e := range env {
-		key, val, ok := strings.Cut(e, "=")
-		if !ok {
-			continue
-		}
-		if err := d.SetKey(starlark.String(key), starlark.String(val)); err != nil {
-			panic(err)
-		}
-	}
-	return d
-}
-
 func defaultThread(name string) *starlark.Thread {
 	return &starlark.Thread{
 		Name: name,
-		Load: starlib.Loader,
+		Load: loader,
 		Print: func(thread *starlark.Thread, msg string) {
 			slog.Info("post hook", "msg", msg, "fingerprint", thread.Name)
 		},
 	}
 }
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// check that the args can be passed to a script as keyword arguments. The
+// names must be identifiers, and must not be one of the reserved names, which
+// are passed by kobold itself.
+func CheckArgs(args map[string]any, reserved ...string) error {
+	_, err := argsToKwargs(args, reserved...)
+	return err
+}
+
+// convert the args to keyword arguments, sorted by name.
+func argsToKwargs(args map[string]any, reserved ...string) ([]starlark.Tuple, error) {
+	kwargs := make([]starlark.Tuple, 0, len(args))
+	for k, v := range args {
+		if !identifier.MatchString(k) {
+			return nil, fmt.Errorf("arg %q: not an identifier", k)
+		}
+		for _, r := range reserved {
+			if k == r {
+				return nil, fmt.Errorf("arg %q: reserved name", k)
+			}
+		}
+		sv, err := toStarlark(v)
+		if err != nil {
+			return nil, fmt.Errorf("arg %q: %w", k, err)
+		}
+		kwargs = append(kwargs, starlark.Tuple{starlark.String(k), sv})
+	}
+	sort.Slice(kwargs, func(i, j int) bool {
+		return kwargs[i][0].(starlark.String) < kwargs[j][0].(starlark.String)
+	})
+	return kwargs, nil
+}
+
+// convert a go value, as decoded from toml or json, to a starlark value.
+func toStarlark(v any) (starlark.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case string:
+		return starlark.String(v), nil
+	case int64:
+		return starlark.MakeInt64(v), nil
+	case int:
+		return starlark.MakeInt(v), nil
+	case float64:
+		return starlark.Float(v), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return starlark.MakeInt64(i), nil
+		}
+		f, err := v.Float64()
+		return starlark.Float(f), err
+	case time.Time:
+		return starlark.String(v.Format(time.RFC3339)), nil
+	}
+
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Slice:
+		list := make([]starlark.Value, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			item, err := toStarlark(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return starlark.NewList(list), nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		d := starlark.NewDict(rv.Len())
+		for _, k := range rv.MapKeys() {
+			item, err := toStarlark(rv.MapIndex(k).Interface())
+			if err != nil {
+				return nil, err
+			}
+			if err := d.SetKey(starlark.String(k.String()), item); err != nil {
+				return nil, err
+			}
+		}
+		return d, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
@@ -1,8 +1,17 @@
 package plugin
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"go.starlark.net/starlark"
 )
@@ -14,7 +23,9 @@ func TestRunMain(t *testing.T) {
 		name    string
 		script  []byte
 		args    starlark.Tuple
-		hostEnv *starlark.Dict
+		kwargs  []starlark.Tuple
+		environ []string
+		env     HostEnv
 	}
 	tests := []struct {
 		name    string
@@ -35,20 +46,26 @@ func TestRunMain(t *testing.T) {
 		{
 			name: "lookup env",
 			args: args{
-				thread: defaultThread("test"),
-				name:   "test",
-				script: []byte(`def main(): return host_env["FOO"]`),
-				args:   starlark.Tuple{},
-				hostEnv: func() *starlark.Dict {
-					d := starlark.NewDict(0)
-					if err := d.SetKey(starlark.String("FOO"), starlark.String("BAR")); err != nil {
-						panic(err)
-					}
-					return d
-				}(),
+				thread:  defaultThread("test"),
+				name:    "test",
+				script:  []byte(`def main(): return host_env["FOO"]`),
+				args:    starlark.Tuple{},
+				environ: []string{"FOO=BAR"},
+				env:     HostEnv{Env: []string{"FOO"}},
 			},
 			want: starlark.String("BAR"),
 		},
+		{
+			name: "hide env",
+			args: args{
+				thread:  defaultThread("test"),
+				name:    "test",
+				script:  []byte(`def main(): return len(host_env)`),
+				args:    starlark.Tuple{},
+				environ: []string{"FOO=BAR", "DB_PASSWORD=secret"},
+			},
+			want: starlark.MakeInt(0),
+		},
 		{
 			name: "pass args",
 			args: args{
@@ -59,12 +76,39 @@ func TestRunMain(t *testing.T) {
 			},
 			want: starlark.MakeInt(3),
 		},
+		{
+			name: "pass declared kwargs",
+			args: args{
+				thread: defaultThread("test"),
+				name:   "test",
+				script: []byte(`def main(a, b = 0): return a + b`),
+				args:   starlark.Tuple{starlark.MakeInt(1)},
+				kwargs: []starlark.Tuple{
+					{starlark.String("b"), starlark.MakeInt(2)},
+					{starlark.String("c"), starlark.MakeInt(3)},
+				},
+			},
+			want: starlark.MakeInt(3),
+		},
+		{
+			name: "pass all kwargs",
+			args: args{
+				thread: defaultThread("test"),
+				name:   "test",
+				script: []byte(`def main(**kwargs): return len(kwargs)`),
+				kwargs: []starlark.Tuple{
+					{starlark.String("b"), starlark.MakeInt(2)},
+					{starlark.String("c"), starlark.MakeInt(3)},
+				},
+			},
+			want: starlark.MakeInt(2),
+		},
 	}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			got, err := runMain(tt.args.thread, tt.args.name, tt.args.script, tt.args.args, tt.args.hostEnv)
+			got, err := runMain(context.Background(), tt.args.thread, tt.args.name, tt.args.script, tt.args.args, nil, tt.args.kwargs, tt.args.environ, tt.args.env)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("RunMain() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -76,31 +120,57 @@ func TestRunMain(t *testing.T) {
 	}
 }
 
-func TestEnvToStarlarkDict(t *testing.T) {
+func TestHostEnv_Dict(t *testing.T) {
 	t.Parallel()
+
+	secret := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	environ := []string{"GITHUB_TOKEN=a", "GITHUB_API_URL=b", "GITLAB_TOKEN=c", "HOME=/root"}
+
 	tests := []struct {
-		name     string
-		giveEnv  []string
-		wantDict *starlark.Dict
+		name    string
+		env     HostEnv
+		want    string
+		wantErr bool
 	}{
 		{
-			name:    "simple",
-			giveEnv: []string{"FOO=BAR"},
-			wantDict: func() *starlark.Dict {
-				d := starlark.NewDict(0)
-				if err := d.SetKey(starlark.String("FOO"), starlark.String("BAR")); err != nil {
-					panic(err)
-				}
-				return d
-			}(),
+			name: "none",
+			want: `{}`,
+		},
+		{
+			name: "names",
+			env:  HostEnv{Env: []string{"HOME", "MISSING"}},
+			want: `{"HOME": "/root"}`,
+		},
+		{
+			name: "pattern",
+			env:  HostEnv{Env: []string{"GITHUB_*"}},
+			want: `{"GITHUB_TOKEN": "a", "GITHUB_API_URL": "b"}`,
+		},
+		{
+			name: "secret",
+			env:  HostEnv{Secrets: map[string]string{"TOKEN": secret}},
+			want: `{"TOKEN": "s3cret"}`,
+		},
+		{
+			name:    "missing secret",
+			env:     HostEnv{Secrets: map[string]string{"TOKEN": secret + ".missing"}},
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			if got := envToStarlarkDict(tt.giveEnv); !reflect.DeepEqual(got, tt.wantDict) {
-				t.Errorf("OsEnvToStarlarkDict() = %v, want %v", got, tt.wantDict)
+			got, err := tt.env.dict(environ)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("dict() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("dict() = %s, want %s", got, tt.want)
 			}
 		})
 	}
@@ -138,3 +208,205 @@ func TestAsStringSlice(t *testing.T) {
 		})
 	}
 }
+
+func TestArgsToKwargs(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		giveArgs map[string]any
+		want     string
+		wantErr  bool
+	}{
+		{
+			name: "toml",
+			giveArgs: map[string]any{
+				"org":    "acme",
+				"count":  int64(2),
+				"ratio":  0.5,
+				"labels": []any{"a", "b"},
+				"table":  []map[string]any{{"on": true}},
+			},
+			want: `[("count", 2) ("labels", ["a", "b"]) ("org", "acme") ("ratio", 0.5) ("table", [{"on": True}])]`,
+		},
+		{
+			name:     "json number",
+			giveArgs: map[string]any{"a": json.Number("1"), "b": json.Number("1.5")},
+			want:     `[("a", 1) ("b", 1.5)]`,
+		},
+		{
+			name:     "reserved",
+			giveArgs: map[string]any{"pr_options": "x"},
+			wantErr:  true,
+		},
+		{
+			name:     "not an identifier",
+			giveArgs: map[string]any{"target-org": "x"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := argsToKwargs(tt.giveArgs, PostHookKwargs...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("argsToKwargs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if s := fmt.Sprint(got); s != tt.want {
+				t.Errorf("argsToKwargs() = %s, want %s", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunMain_Limits(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	loop := `
+def main():
+    for i in range(1000000000):
+        pass
+`
+
+	hosts := []string{srv.Listener.Addr().String()}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		script string
+		limits Limits
+		hosts  []string
+		want   error
+	}{
+		{
+			name:   "max steps",
+			script: loop,
+			limits: Limits{MaxSteps: 1000},
+			want:   ErrMaxSteps,
+		},
+		{
+			name:   "timeout",
+			script: loop,
+			limits: Limits{Timeout: 50 * time.Millisecond},
+			want:   ErrTimeout,
+		},
+		{
+			name:   "canceled",
+			ctx:    canceled,
+			script: loop,
+			want:   context.Canceled,
+		},
+		{
+			name: "http timeout",
+			script: fmt.Sprintf(`
+load("http.star", "http")
+def main():
+    http.get(%q)
+`, srv.URL),
+			limits: Limits{HTTPTimeout: 50 * time.Millisecond},
+			hosts:  hosts,
+			want:   ErrHTTPTimeout,
+		},
+		{
+			name: "http canceled by timeout",
+			script: fmt.Sprintf(`
+load("http.star", "http")
+def main():
+    http.get(%q)
+`, srv.URL),
+			limits: Limits{Timeout: 50 * time.Millisecond},
+			hosts:  hosts,
+			want:   ErrTimeout,
+		},
+		{
+			name: "egress denied",
+			script: fmt.Sprintf(`
+load("http.star", "http")
+def main():
+    http.get(%q)
+`, srv.URL),
+			hosts: []string{"127.0.0.1"},
+			want:  ErrEgressDenied,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			_, err := runMain(WithLimits(ctx, tt.limits), defaultThread("test"), "test", []byte(tt.script), nil, nil, nil, nil, HostEnv{Hosts: tt.hosts})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("runMain() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestRunMain_Transport(t *testing.T) {
+	t.Parallel()
+
+	rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		rec := httptest.NewRecorder()
+		rec.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(rec, "%s %s", r.Method, r.URL)
+		res := rec.Result()
+		res.Request = r
+		return res, nil
+	})
+
+	script := []byte(`
+load("http.star", "http")
+def main():
+    res = http.post("https://api.example.com/pulls")
+    return "%d %s" % (res.status_code, res.body())
+`)
+
+	tests := []struct {
+		name    string
+		hosts   []string
+		want    starlark.Value
+		wantErr error
+	}{
+		{
+			name:  "mocked",
+			hosts: []string{"api.example.com"},
+			want:  starlark.String("201 POST https://api.example.com/pulls"),
+		},
+		{
+			name:    "egress denied",
+			hosts:   []string{"example.com"},
+			wantErr: ErrEgressDenied,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := runMain(WithTransport(context.Background(), rt), defaultThread("test"), "test", script, nil, nil, nil, nil, HostEnv{Hosts: tt.hosts})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("runMain() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("runMain() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
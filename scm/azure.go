@@ -0,0 +1,86 @@
+package scm
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// azure devops services and server. The owner is the organization or
+// collection, followed by the project. Personal access tokens are sent with
+// basic auth, the username may be empty. Reviewers and team reviewers are
+// identity ids. Auto merge is auto complete, set by the creator of the pull
+// request.
+type azure struct{ client }
+
+// the merge strategies of azure devops, by merge method.
+var azureMergeStrategies = map[string]string{
+	MergeMethodMerge:  "noFastForward",
+	MergeMethodSquash: "squash",
+	MergeMethodRebase: "rebase",
+}
+
+func (p *azure) CreatePullRequest(ctx context.Context, repo Repo, pr PullRequest) (Created, error) {
+	if err := CheckOptions(ProviderAzure, pr.Options); err != nil {
+		return Created{}, err
+	}
+
+	req := http.Request{Header: http.Header{}}
+	if p.token != "" {
+		req.SetBasicAuth(p.username, p.token)
+	}
+
+	labels := make([]map[string]string, 0, len(pr.Labels))
+	for _, l := range pr.Labels {
+		labels = append(labels, map[string]string{"name": l})
+	}
+
+	reviewers := make([]map[string]string, 0, len(pr.Reviewers)+len(pr.TeamReviewers))
+	for _, r := range append(append([]string{}, pr.Reviewers...), pr.TeamReviewers...) {
+		reviewers = append(reviewers, map[string]string{"id": r})
+	}
+
+	body := map[string]any{
+		"sourceRefName": "refs/heads/" + pr.Head,
+		"targetRefName": "refs/heads/" + pr.Base,
+		"title":         pr.Title,
+		"description":   pr.Body,
+		"isDraft":       pr.Draft,
+		"labels":        labels,
+		"reviewers":     reviewers,
+	}
+
+	var res struct {
+		PullRequestID int `json:"pullRequestId"`
+		CreatedBy     struct {
+			ID string `json:"id"`
+		} `json:"createdBy"`
+		Repository struct {
+			WebURL string `json:"webUrl"`
+		} `json:"repository"`
+	}
+
+	api := p.base("https://"+repo.Host) + "/" + escapePath(repo.Owner) +
+		"/_apis/git/repositories/" + escapePath(repo.Name) + "/pullrequests"
+	if err := p.post(ctx, api+"?api-version=7.0", req.Header, body, &res); err != nil {
+		return Created{}, err
+	}
+
+	created := Created{
+		Number: res.PullRequestID,
+		URL:    res.Repository.WebURL + "/pullrequest/" + strconv.Itoa(res.PullRequestID),
+	}
+
+	if pr.AutoMerge != "" {
+		body := map[string]any{
+			"autoCompleteSetBy": map[string]string{"id": res.CreatedBy.ID},
+			"completionOptions": map[string]string{"mergeStrategy": azureMergeStrategies[pr.AutoMerge]},
+		}
+		url := api + "/" + strconv.Itoa(res.PullRequestID) + "?api-version=7.0"
+		if err := p.do(ctx, http.MethodPatch, url, req.Header, body, http.StatusOK, nil); err != nil {
+			return created, err
+		}
+	}
+
+	return created, nil
+}
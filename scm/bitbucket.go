@@ -0,0 +1,63 @@
+package scm
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// bitbucket cloud. The owner is the workspace. Reviewers are account ids, or
+// uuids in curly braces. Bitbucket data center has a different api, and is not
+// supported.
+type bitbucket struct{ client }
+
+type bitbucketBranch struct {
+	Branch struct {
+		Name string `json:"name"`
+	} `json:"branch"`
+}
+
+func (p *bitbucket) CreatePullRequest(ctx context.Context, repo Repo, pr PullRequest) (Created, error) {
+	if err := CheckOptions(ProviderBitbucket, pr.Options); err != nil {
+		return Created{}, err
+	}
+
+	header := http.Header{}
+	p.basicOrBearer(header)
+
+	reviewers := make([]map[string]string, 0, len(pr.Reviewers))
+	for _, r := range pr.Reviewers {
+		if strings.HasPrefix(r, "{") {
+			reviewers = append(reviewers, map[string]string{"uuid": r})
+		} else {
+			reviewers = append(reviewers, map[string]string{"account_id": r})
+		}
+	}
+
+	body := struct {
+		Title       string              `json:"title"`
+		Description string              `json:"description"`
+		Source      bitbucketBranch     `json:"source"`
+		Destination bitbucketBranch     `json:"destination"`
+		Reviewers   []map[string]string `json:"reviewers"`
+		Draft       bool                `json:"draft"`
+	}{Title: pr.Title, Description: pr.Body, Reviewers: reviewers, Draft: pr.Draft}
+	body.Source.Branch.Name = pr.Head
+	body.Destination.Branch.Name = pr.Base
+
+	var res struct {
+		ID    int `json:"id"`
+		Links struct {
+			HTML struct {
+				Href string `json:"href"`
+			} `json:"html"`
+		} `json:"links"`
+	}
+
+	url := p.base("https://api.bitbucket.org/2.0") + "/repositories/" + escapePath(repo.Path()) + "/pullrequests"
+	if err := p.post(ctx, url, header, body, &res); err != nil {
+		return Created{}, err
+	}
+
+	return Created{Number: res.ID, URL: res.Links.HTML.Href}, nil
+}
@@ -0,0 +1,96 @@
+package scm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// gitea, including forgejo. Labels are referenced by id, so their names are
+// resolved first. Drafts are marked by their title.
+type gitea struct{ client }
+
+func (p *gitea) CreatePullRequest(ctx context.Context, repo Repo, pr PullRequest) (Created, error) {
+	if err := CheckOptions(ProviderGitea, pr.Options); err != nil {
+		return Created{}, err
+	}
+
+	header := http.Header{}
+	if p.token != "" {
+		header.Set("Authorization", "token "+p.token)
+	}
+
+	api := p.base("https://"+repo.Host+"/api/v1") + "/repos/" + escapePath(repo.Path())
+
+	title := pr.Title
+	if pr.Draft {
+		title = "WIP: " + title
+	}
+
+	body := map[string]any{"title": title, "body": pr.Body, "head": pr.Head, "base": pr.Base}
+
+	if len(pr.Labels) > 0 {
+		ids, err := p.labelIDs(ctx, api, header, pr.Labels)
+		if err != nil {
+			return Created{}, err
+		}
+		body["labels"] = ids
+	}
+
+	var res struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+
+	if err := p.post(ctx, api+"/pulls", header, body, &res); err != nil {
+		return Created{}, err
+	}
+
+	created := Created{Number: res.Number, URL: res.HTMLURL}
+	pull := api + "/pulls/" + strconv.Itoa(res.Number)
+
+	if len(pr.Reviewers) > 0 || len(pr.TeamReviewers) > 0 {
+		body := map[string]any{"reviewers": nonNil(pr.Reviewers), "team_reviewers": nonNil(pr.TeamReviewers)}
+		if err := p.post(ctx, pull+"/requested_reviewers", header, body, nil); err != nil {
+			return created, err
+		}
+	}
+
+	if pr.AutoMerge != "" {
+		body := map[string]any{"Do": pr.AutoMerge, "merge_when_checks_succeed": true}
+		if err := p.do(ctx, http.MethodPost, pull+"/merge", header, body, http.StatusOK, nil); err != nil {
+			return created, err
+		}
+	}
+
+	return created, nil
+}
+
+// resolve the label names to ids.
+func (p *gitea) labelIDs(ctx context.Context, api string, header http.Header, names []string) ([]int, error) {
+	var labels []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	if err := p.do(ctx, http.MethodGet, api+"/labels?limit=100", header, nil, http.StatusOK, &labels); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(names))
+	for _, name := range names {
+		id := -1
+		for _, l := range labels {
+			if l.Name == name {
+				id = l.ID
+			}
+		}
+		if id < 0 {
+			return nil, fmt.Errorf("label %q not found", name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,88 @@
+package scm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// github.com is served from api.github.com, and github enterprise server from
+// the /api/v3 path of its host. Auto merge is only available via graphql,
+// which is served next to the rest api.
+type gitHub struct{ client }
+
+func (p *gitHub) CreatePullRequest(ctx context.Context, repo Repo, pr PullRequest) (Created, error) {
+	if err := CheckOptions(ProviderGitHub, pr.Options); err != nil {
+		return Created{}, err
+	}
+
+	def := "https://" + repo.Host + "/api/v3"
+	if repo.Host == "github.com" {
+		def = "https://api.github.com"
+	}
+
+	var (
+		base   = p.base(def)
+		api    = base + "/repos/" + escapePath(repo.Path())
+		header = http.Header{}
+	)
+
+	header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if p.token != "" {
+		header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	body := map[string]any{"title": pr.Title, "body": pr.Body, "head": pr.Head, "base": pr.Base, "draft": pr.Draft}
+
+	var res struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+		NodeID  string `json:"node_id"`
+	}
+
+	if err := p.post(ctx, api+"/pulls", header, body, &res); err != nil {
+		return Created{}, err
+	}
+
+	created := Created{Number: res.Number, URL: res.HTMLURL}
+	issue := strconv.Itoa(res.Number)
+
+	if len(pr.Labels) > 0 {
+		body := map[string]any{"labels": pr.Labels}
+		if err := p.do(ctx, http.MethodPost, api+"/issues/"+issue+"/labels", header, body, http.StatusOK, nil); err != nil {
+			return created, err
+		}
+	}
+
+	if len(pr.Reviewers) > 0 || len(pr.TeamReviewers) > 0 {
+		body := map[string]any{"reviewers": nonNil(pr.Reviewers), "team_reviewers": nonNil(pr.TeamReviewers)}
+		if err := p.post(ctx, api+"/pulls/"+issue+"/requested_reviewers", header, body, nil); err != nil {
+			return created, err
+		}
+	}
+
+	if pr.AutoMerge != "" {
+		body := map[string]any{
+			"query": `mutation($id: ID!, $method: PullRequestMergeMethod!) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $id, mergeMethod: $method}) { clientMutationId }
+}`,
+			"variables": map[string]string{"id": res.NodeID, "method": strings.ToUpper(pr.AutoMerge)},
+		}
+		var gql struct {
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		url := strings.TrimSuffix(base, "/v3") + "/graphql"
+		if err := p.do(ctx, http.MethodPost, url, header, body, http.StatusOK, &gql); err != nil {
+			return created, err
+		}
+		if len(gql.Errors) > 0 {
+			return created, fmt.Errorf("enable auto merge: %s", gql.Errors[0].Message)
+		}
+	}
+
+	return created, nil
+}
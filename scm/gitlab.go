@@ -0,0 +1,80 @@
+package scm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// gitlab identifies projects by their full path, including nested groups, as
+// single url encoded path segment. Reviewers are user ids. Drafts are marked by
+// their title, and auto merge is merge when pipeline succeeds.
+type gitLab struct{ client }
+
+func (p *gitLab) CreatePullRequest(ctx context.Context, repo Repo, pr PullRequest) (Created, error) {
+	if err := CheckOptions(ProviderGitLab, pr.Options); err != nil {
+		return Created{}, err
+	}
+
+	reviewers := make([]int, 0, len(pr.Reviewers))
+	for _, r := range pr.Reviewers {
+		id, err := strconv.Atoi(r)
+		if err != nil {
+			return Created{}, fmt.Errorf("%w: gitlab reviewers must be user ids, got %q", ErrUnsupported, r)
+		}
+		reviewers = append(reviewers, id)
+	}
+
+	header := http.Header{}
+	if p.token != "" {
+		header.Set("PRIVATE-TOKEN", p.token)
+	}
+
+	title := pr.Title
+	if pr.Draft {
+		title = "Draft: " + title
+	}
+
+	body := map[string]any{
+		"title":         title,
+		"description":   pr.Body,
+		"source_branch": pr.Head,
+		"target_branch": pr.Base,
+	}
+
+	if len(pr.Labels) > 0 {
+		body["labels"] = strings.Join(pr.Labels, ",")
+	}
+
+	if len(reviewers) > 0 {
+		body["reviewer_ids"] = reviewers
+	}
+
+	if pr.AutoMerge == MergeMethodSquash {
+		body["squash"] = true
+	}
+
+	var res struct {
+		IID    int    `json:"iid"`
+		WebURL string `json:"web_url"`
+	}
+
+	api := p.base("https://"+repo.Host+"/api/v4") + "/projects/" + url.PathEscape(repo.Path()) + "/merge_requests"
+	if err := p.post(ctx, api, header, body, &res); err != nil {
+		return Created{}, err
+	}
+
+	created := Created{Number: res.IID, URL: res.WebURL}
+
+	if pr.AutoMerge != "" {
+		body := map[string]any{"merge_when_pipeline_succeeds": true, "squash": pr.AutoMerge == MergeMethodSquash}
+		if err := p.do(ctx, http.MethodPut, api+"/"+strconv.Itoa(res.IID)+"/merge", header, body, http.StatusOK, nil); err != nil {
+			return created, err
+		}
+	}
+
+	return created, nil
+}
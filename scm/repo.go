@@ -0,0 +1,102 @@
+package scm
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// a repo is the location of a git repo on a forge, derived from its clone url.
+// The owner is everything between the host and the name of the repo. It may
+// have multiple segments, such as nested gitlab groups, or the organization
+// and project on azure devops.
+type Repo struct {
+	Host  string
+	Owner string
+	Name  string
+}
+
+// the owner and name, separated by a slash.
+func (r Repo) Path() string {
+	return r.Owner + "/" + r.Name
+}
+
+// parse the clone url of a repo, as used in the repo part of a package uri.
+// Both urls, i.e. https://host:port/owner/name.git or ssh://git@host:port/...,
+// and the scp like syntax, i.e. git@host:owner/name.git, are supported. The
+// port and user info are dropped, since the api is not served on the ssh port.
+func ParseRepo(s string) (Repo, error) {
+	var host, path string
+
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return Repo{}, fmt.Errorf("parse repo %q: %w", s, err)
+		}
+		host, path = u.Hostname(), u.Path
+	} else if h, p, ok := strings.Cut(s, ":"); ok {
+		if i := strings.LastIndex(h, "@"); i >= 0 {
+			h = h[i+1:]
+		}
+		host, path = h, p
+	}
+
+	if host == "" {
+		return Repo{}, fmt.Errorf("parse repo %q: no host", s)
+	}
+
+	var segments []string
+	for _, seg := range strings.Split(strings.TrimSuffix(strings.Trim(path, "/"), ".git"), "/") {
+		// Azure devops puts _git between the project and the repo name.
+		if seg != "" && seg != "_git" {
+			segments = append(segments, seg)
+		}
+	}
+
+	// The ssh urls of azure devops, are prefixed with the api version, and use
+	// a dedicated host.
+	if host == "ssh.dev.azure.com" || host == "vs-ssh.visualstudio.com" {
+		host = "dev.azure.com"
+		if len(segments) > 0 && segments[0] == "v3" {
+			segments = segments[1:]
+		}
+	}
+
+	if len(segments) < 2 {
+		return Repo{}, fmt.Errorf("parse repo %q: expected owner and name", s)
+	}
+
+	return Repo{
+		Host:  host,
+		Owner: strings.Join(segments[:len(segments)-1], "/"),
+		Name:  segments[len(segments)-1],
+	}, nil
+}
+
+// detect the provider from well known hosts. Returns an empty string, if the
+// host is not known, i.e. self hosted instances.
+func DetectProvider(host string) string {
+	switch {
+	case host == "github.com":
+		return ProviderGitHub
+	case host == "gitlab.com":
+		return ProviderGitLab
+	case host == "gitea.com", host == "codeberg.org":
+		return ProviderGitea
+	case host == "bitbucket.org":
+		return ProviderBitbucket
+	case host == "dev.azure.com", strings.HasSuffix(host, ".visualstudio.com"):
+		return ProviderAzure
+	default:
+		return ""
+	}
+}
+
+// escape each segment of the path, but keep the slashes.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,70 @@
+package scm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRepo(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		give    string
+		want    Repo
+		wantErr bool
+	}{
+		{
+			name: "scp",
+			give: "git@github.com:bluebrown/kobold.git",
+			want: Repo{Host: "github.com", Owner: "bluebrown", Name: "kobold"},
+		},
+		{
+			name: "https",
+			give: "https://github.com/bluebrown/kobold",
+			want: Repo{Host: "github.com", Owner: "bluebrown", Name: "kobold"},
+		},
+		{
+			name: "ssh with port",
+			give: "ssh://git@git.example.com:2222/team/kobold.git",
+			want: Repo{Host: "git.example.com", Owner: "team", Name: "kobold"},
+		},
+		{
+			name: "nested groups",
+			give: "https://user@gitlab.example.com:8443/org/sub/team/kobold.git",
+			want: Repo{Host: "gitlab.example.com", Owner: "org/sub/team", Name: "kobold"},
+		},
+		{
+			name: "azure ssh",
+			give: "git@ssh.dev.azure.com:v3/myorg/myproject/kobold",
+			want: Repo{Host: "dev.azure.com", Owner: "myorg/myproject", Name: "kobold"},
+		},
+		{
+			name: "azure https",
+			give: "https://myorg@dev.azure.com/myorg/myproject/_git/kobold",
+			want: Repo{Host: "dev.azure.com", Owner: "myorg/myproject", Name: "kobold"},
+		},
+		{
+			name:    "local",
+			give:    "file:///tmp/kobold.git",
+			wantErr: true,
+		},
+		{
+			name:    "no owner",
+			give:    "git@github.com:kobold.git",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseRepo(tt.give)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRepo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRepo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
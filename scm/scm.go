@@ -0,0 +1,219 @@
+// package scm opens pull requests on git forges, using their rest apis. The
+// api endpoints are derived from the clone url of the repo, unless an api url
+// is configured, i.e. for self hosted instances behind a different host.
+package scm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ProviderGitHub    = "github"
+	ProviderGitLab    = "gitlab"
+	ProviderGitea     = "gitea"
+	ProviderBitbucket = "bitbucket"
+	ProviderAzure     = "azure"
+)
+
+var ErrUnknownProvider = fmt.Errorf("unknown scm provider")
+
+const (
+	MergeMethodMerge  = "merge"
+	MergeMethodSquash = "squash"
+	MergeMethodRebase = "rebase"
+)
+
+var ErrUnsupported = fmt.Errorf("unsupported pull request option")
+
+// the pull request to open. Head is the branch with the changes, and base the
+// branch they should be merged into.
+type PullRequest struct {
+	Title string
+	Body  string
+	Head  string
+	Base  string
+	Options
+}
+
+// the options of a pull request. Reviewers and labels are names, unless the
+// provider only accepts ids. Auto merge is the merge method, that is used once
+// the checks of the pull request succeeded. It is disabled, if empty.
+type Options struct {
+	Labels        []string
+	Reviewers     []string
+	TeamReviewers []string
+	Draft         bool
+	AutoMerge     string
+}
+
+// the pull request, as opened by the provider.
+type Created struct {
+	Number int
+	URL    string
+}
+
+type Provider interface {
+	CreatePullRequest(ctx context.Context, repo Repo, pr PullRequest) (Created, error)
+}
+
+// the config of a provider. The token is used as bearer token or private
+// token, depending on the provider. Bitbucket and azure devops use basic auth,
+// if a username is set.
+type Config struct {
+	Provider   string
+	APIURL     string
+	Username   string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func New(cfg Config) (Provider, error) {
+	c := client{
+		apiURL:   strings.TrimSuffix(cfg.APIURL, "/"),
+		username: cfg.Username,
+		token:    cfg.Token,
+		http:     cfg.HTTPClient,
+	}
+
+	if c.http == nil {
+		c.http = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	switch cfg.Provider {
+	case ProviderGitHub:
+		return &gitHub{c}, nil
+	case ProviderGitLab:
+		return &gitLab{c}, nil
+	case ProviderGitea:
+		return &gitea{c}, nil
+	case ProviderBitbucket:
+		return &bitbucket{c}, nil
+	case ProviderAzure:
+		return &azure{c}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, cfg.Provider)
+	}
+}
+
+type client struct {
+	apiURL   string
+	username string
+	token    string
+	http     *http.Client
+}
+
+// return the configured api url, or the given default.
+func (c *client) base(def string) string {
+	if c.apiURL != "" {
+		return c.apiURL
+	}
+	return def
+}
+
+// post the body as json, and decode the response into out. See do.
+func (c *client) post(ctx context.Context, url string, header http.Header, body, out any) error {
+	return c.do(ctx, http.MethodPost, url, header, body, http.StatusCreated, out)
+}
+
+// send the body as json, and decode the response into out, if not nil. Any
+// status other than want is an error, which includes the start of the response
+// body, since forges put the reason there, i.e. that a pull request exists
+// already.
+func (c *client) do(ctx context.Context, method, url string, header http.Header, body any, want int, out any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return err
+	}
+
+	req.Header = header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != want {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", strings.ToLower(method), req.URL.Redacted(), res.Status, bytes.TrimSpace(msg))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	return nil
+}
+
+// set basic auth, if there is a username, otherwise use the token as bearer.
+func (c *client) basicOrBearer(h http.Header) {
+	if c.username != "" {
+		req := http.Request{Header: h}
+		req.SetBasicAuth(c.username, c.token)
+	} else if c.token != "" {
+		h.Set("Authorization", "Bearer "+c.token)
+	}
+}
+
+// return an empty list, if the list is nil, so that it is encoded as json array.
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+// the options each provider does not support. Options that are not listed, are
+// supported by the provider.
+var unsupported = map[string][]string{
+	ProviderGitLab:    {"team_reviewers", "auto_merge=" + MergeMethodRebase},
+	ProviderBitbucket: {"labels", "team_reviewers", "auto_merge"},
+}
+
+// check if the provider supports the options. It is used to validate the
+// options, before opening a pull request.
+func CheckOptions(provider string, opts Options) error {
+	used := map[string]bool{
+		"labels":                       len(opts.Labels) > 0,
+		"reviewers":                    len(opts.Reviewers) > 0,
+		"team_reviewers":               len(opts.TeamReviewers) > 0,
+		"auto_merge":                   opts.AutoMerge != "",
+		"auto_merge=" + opts.AutoMerge: opts.AutoMerge != "",
+	}
+
+	switch opts.AutoMerge {
+	case "", MergeMethodMerge, MergeMethodSquash, MergeMethodRebase:
+	default:
+		return fmt.Errorf("%w: unknown merge method %q", ErrUnsupported, opts.AutoMerge)
+	}
+
+	for _, opt := range unsupported[provider] {
+		if used[opt] {
+			return fmt.Errorf("%w: %s is not supported by %s", ErrUnsupported, opt, provider)
+		}
+	}
+
+	return nil
+}
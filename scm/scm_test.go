@@ -0,0 +1,316 @@
+package scm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProvider_CreatePullRequest(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		provider   string
+		username   string
+		repo       Repo
+		wantPath   string
+		wantAuth   string
+		wantHeader string
+		wantBody   map[string]any
+		response   string
+		want       Created
+	}{
+		{
+			name:     "github",
+			provider: ProviderGitHub,
+			repo:     Repo{Host: "github.com", Owner: "acme", Name: "app"},
+			wantPath: "/repos/acme/app/pulls",
+			wantAuth: "Bearer secret",
+			wantBody: map[string]any{"title": "t", "body": "b", "head": "kobold", "base": "main", "draft": false},
+			response: `{"number": 7, "html_url": "https://github.com/acme/app/pull/7"}`,
+			want:     Created{Number: 7, URL: "https://github.com/acme/app/pull/7"},
+		},
+		{
+			name:       "gitlab nested groups",
+			provider:   ProviderGitLab,
+			repo:       Repo{Host: "gitlab.example.com", Owner: "org/team", Name: "app"},
+			wantPath:   "/projects/org%2Fteam%2Fapp/merge_requests",
+			wantHeader: "secret",
+			wantBody:   map[string]any{"title": "t", "description": "b", "source_branch": "kobold", "target_branch": "main"},
+			response:   `{"iid": 3, "web_url": "https://gitlab.example.com/org/team/app/-/merge_requests/3"}`,
+			want:       Created{Number: 3, URL: "https://gitlab.example.com/org/team/app/-/merge_requests/3"},
+		},
+		{
+			name:     "gitea",
+			provider: ProviderGitea,
+			repo:     Repo{Host: "gitea.example.com", Owner: "acme", Name: "app"},
+			wantPath: "/repos/acme/app/pulls",
+			wantAuth: "token secret",
+			wantBody: map[string]any{"title": "t", "body": "b", "head": "kobold", "base": "main"},
+			response: `{"number": 2, "html_url": "https://gitea.example.com/acme/app/pulls/2"}`,
+			want:     Created{Number: 2, URL: "https://gitea.example.com/acme/app/pulls/2"},
+		},
+		{
+			name:     "bitbucket",
+			provider: ProviderBitbucket,
+			username: "kobold",
+			repo:     Repo{Host: "bitbucket.org", Owner: "acme", Name: "app"},
+			wantPath: "/repositories/acme/app/pullrequests",
+			wantAuth: "Basic a29ib2xkOnNlY3JldA==",
+			wantBody: map[string]any{
+				"title":       "t",
+				"description": "b",
+				"source":      map[string]any{"branch": map[string]any{"name": "kobold"}},
+				"destination": map[string]any{"branch": map[string]any{"name": "main"}},
+				"reviewers":   []any{},
+				"draft":       false,
+			},
+			response: `{"id": 5, "links": {"html": {"href": "https://bitbucket.org/acme/app/pull-requests/5"}}}`,
+			want:     Created{Number: 5, URL: "https://bitbucket.org/acme/app/pull-requests/5"},
+		},
+		{
+			name:     "azure",
+			provider: ProviderAzure,
+			repo:     Repo{Host: "dev.azure.com", Owner: "org/project", Name: "app"},
+			wantPath: "/org/project/_apis/git/repositories/app/pullrequests",
+			wantAuth: "Basic OnNlY3JldA==",
+			wantBody: map[string]any{
+				"title":         "t",
+				"description":   "b",
+				"sourceRefName": "refs/heads/kobold",
+				"targetRefName": "refs/heads/main",
+				"isDraft":       false,
+				"labels":        []any{},
+				"reviewers":     []any{},
+			},
+			response: `{"pullRequestId": 9, "repository": {"webUrl": "https://dev.azure.com/org/project/_git/app"}}`,
+			want:     Created{Number: 9, URL: "https://dev.azure.com/org/project/_git/app/pullrequest/9"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.URL.EscapedPath(); got != tt.wantPath {
+					t.Errorf("path = %q, want %q", got, tt.wantPath)
+				}
+				if got := r.Header.Get("Authorization"); got != tt.wantAuth {
+					t.Errorf("authorization = %q, want %q", got, tt.wantAuth)
+				}
+				if got := r.Header.Get("PRIVATE-TOKEN"); got != tt.wantHeader {
+					t.Errorf("private token = %q, want %q", got, tt.wantHeader)
+				}
+				var body map[string]any
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Error(err)
+				}
+				if !reflect.DeepEqual(body, tt.wantBody) {
+					t.Errorf("body = %v, want %v", body, tt.wantBody)
+				}
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer srv.Close()
+
+			p, err := New(Config{Provider: tt.provider, APIURL: srv.URL, Username: tt.username, Token: "secret"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := p.CreatePullRequest(context.Background(), tt.repo, PullRequest{Title: "t", Body: "b", Head: "kobold", Base: "main"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("CreatePullRequest() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProvider_CreatePullRequestError(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"message": "a pull request already exists"}`))
+	}))
+	defer srv.Close()
+
+	p, err := New(Config{Provider: ProviderGitHub, APIURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.CreatePullRequest(context.Background(), Repo{Host: "github.com", Owner: "acme", Name: "app"}, PullRequest{})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestProvider_CreatePullRequestOptions(t *testing.T) {
+	t.Parallel()
+
+	opts := Options{
+		Labels:        []string{"kobold"},
+		Reviewers:     []string{"7"},
+		TeamReviewers: []string{"platform"},
+		Draft:         true,
+		AutoMerge:     MergeMethodSquash,
+	}
+
+	tests := []struct {
+		name     string
+		provider string
+		opts     Options
+		repo     Repo
+		want     map[string]any
+		wantErr  bool
+	}{
+		{
+			name:     "github",
+			provider: ProviderGitHub,
+			opts:     opts,
+			repo:     Repo{Host: "github.com", Owner: "acme", Name: "app"},
+			want: map[string]any{
+				"POST /repos/acme/app/pulls": map[string]any{
+					"title": "t", "body": "b", "head": "kobold", "base": "main", "draft": true,
+				},
+				"POST /repos/acme/app/issues/1/labels": map[string]any{"labels": []any{"kobold"}},
+				"POST /repos/acme/app/pulls/1/requested_reviewers": map[string]any{
+					"reviewers": []any{"7"}, "team_reviewers": []any{"platform"},
+				},
+				"POST /graphql": "SQUASH",
+			},
+		},
+		{
+			name:     "gitlab",
+			provider: ProviderGitLab,
+			opts:     Options{Labels: opts.Labels, Reviewers: opts.Reviewers, Draft: true, AutoMerge: MergeMethodSquash},
+			repo:     Repo{Host: "gitlab.com", Owner: "acme", Name: "app"},
+			want: map[string]any{
+				"POST /projects/acme%2Fapp/merge_requests": map[string]any{
+					"title": "Draft: t", "description": "b", "source_branch": "kobold", "target_branch": "main",
+					"labels": "kobold", "reviewer_ids": []any{float64(7)}, "squash": true,
+				},
+				"PUT /projects/acme%2Fapp/merge_requests/1/merge": map[string]any{
+					"merge_when_pipeline_succeeds": true, "squash": true,
+				},
+			},
+		},
+		{
+			name:     "gitlab team reviewers",
+			provider: ProviderGitLab,
+			opts:     opts,
+			repo:     Repo{Host: "gitlab.com", Owner: "acme", Name: "app"},
+			wantErr:  true,
+		},
+		{
+			name:     "gitea",
+			provider: ProviderGitea,
+			opts:     opts,
+			repo:     Repo{Host: "gitea.com", Owner: "acme", Name: "app"},
+			want: map[string]any{
+				"GET /repos/acme/app/labels": nil,
+				"POST /repos/acme/app/pulls": map[string]any{
+					"title": "WIP: t", "body": "b", "head": "kobold", "base": "main", "labels": []any{float64(3)},
+				},
+				"POST /repos/acme/app/pulls/1/requested_reviewers": map[string]any{
+					"reviewers": []any{"7"}, "team_reviewers": []any{"platform"},
+				},
+				"POST /repos/acme/app/pulls/1/merge": map[string]any{"Do": "squash", "merge_when_checks_succeed": true},
+			},
+		},
+		{
+			name:     "bitbucket auto merge",
+			provider: ProviderBitbucket,
+			opts:     Options{AutoMerge: MergeMethodMerge},
+			repo:     Repo{Host: "bitbucket.org", Owner: "acme", Name: "app"},
+			wantErr:  true,
+		},
+		{
+			name:     "azure",
+			provider: ProviderAzure,
+			opts:     opts,
+			repo:     Repo{Host: "dev.azure.com", Owner: "org/project", Name: "app"},
+			want: map[string]any{
+				"POST /org/project/_apis/git/repositories/app/pullrequests": map[string]any{
+					"title": "t", "description": "b",
+					"sourceRefName": "refs/heads/kobold", "targetRefName": "refs/heads/main",
+					"isDraft": true, "labels": []any{map[string]any{"name": "kobold"}},
+					"reviewers": []any{map[string]any{"id": "7"}, map[string]any{"id": "platform"}},
+				},
+				"PATCH /org/project/_apis/git/repositories/app/pullrequests/1": map[string]any{
+					"autoCompleteSetBy": map[string]any{"id": "creator"},
+					"completionOptions": map[string]any{"mergeStrategy": "squash"},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := map[string]any{}
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]any
+				if r.Method != http.MethodGet {
+					if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+						t.Error(err)
+					}
+				}
+				key := r.Method + " " + r.URL.EscapedPath()
+				switch {
+				case key == "POST /graphql":
+					got[key] = body["variables"].(map[string]any)["method"]
+					_, _ = w.Write([]byte(`{"data": {}}`))
+				case r.Method == http.MethodGet:
+					got[key] = nil
+					_, _ = w.Write([]byte(`[{"id": 2, "name": "other"}, {"id": 3, "name": "kobold"}]`))
+				case strings.HasSuffix(key, "/pulls"), strings.HasSuffix(key, "/merge_requests"), strings.HasSuffix(key, "/pullrequests"):
+					got[key] = body
+					w.WriteHeader(http.StatusCreated)
+					_, _ = w.Write([]byte(`{"number": 1, "iid": 1, "id": 1, "pullRequestId": 1, "createdBy": {"id": "creator"}}`))
+				case strings.HasSuffix(key, "/requested_reviewers"):
+					got[key] = body
+					w.WriteHeader(http.StatusCreated)
+					_, _ = w.Write([]byte(`{}`))
+				default:
+					got[key] = body
+					_, _ = w.Write([]byte(`{}`))
+				}
+			}))
+			defer srv.Close()
+
+			p, err := New(Config{Provider: tt.provider, APIURL: srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pr := PullRequest{Title: "t", Body: "b", Head: "kobold", Base: "main", Options: tt.opts}
+			if _, err := p.CreatePullRequest(context.Background(), tt.repo, pr); (err != nil) != tt.wantErr {
+				t.Fatalf("CreatePullRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if len(got) > 0 {
+					t.Errorf("expected no requests, got %v", got)
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requests = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// this is a json object of arbitrary values. It is used to store the arguments
+// that are passed to scripts as keyword arguments. Numbers are scanned as
+// json.Number, so that integers do not turn into floats.
+type Args map[string]any
+
+func (a Args) Value() (driver.Value, error) {
+	if len(a) == 0 {
+		return "", nil
+	}
+	return json.Marshal(a)
+}
+
+func (a *Args) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	var b []byte
+
+	switch v := value.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("store: cannot convert %T to Args", value)
+	}
+
+	if len(b) == 0 {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	if err := dec.Decode(a); err != nil {
+		return fmt.Errorf("store: unmarshal Args: %w", err)
+	}
+
+	return nil
+}
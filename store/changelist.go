@@ -0,0 +1,47 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bluebrown/kobold/krm"
+)
+
+// this is a json array of krm changes. It is used to keep the changes of a
+// run, so that its post hook can be retried later.
+type ChangeList []krm.Change
+
+func (c ChangeList) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return "", nil
+	}
+	return json.Marshal(c)
+}
+
+func (c *ChangeList) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	var b []byte
+
+	switch v := value.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("store: cannot convert %T to ChangeList", value)
+	}
+
+	if len(b) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(b, c); err != nil {
+		return fmt.Errorf("store: unmarshal ChangeList: %w", err)
+	}
+
+	return nil
+}
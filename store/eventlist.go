@@ -0,0 +1,72 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// the action of an event, that updates image refs. Events with other actions,
+// such as delete, are skipped.
+const ActionPush = "push"
+
+// an image ref, as returned by a decoder, together with the action and labels
+// of the event, it has been decoded from.
+type Event struct {
+	Ref    string            `json:"ref"`
+	Action string            `json:"action"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// this is a json array of events. Like the FlatList, it flattens the input up
+// to 1 level deep, when scanning, so that the events of accumulated views can
+// be retrieved.
+type EventList []Event
+
+func (e EventList) Value() (driver.Value, error) {
+	if len(e) == 0 {
+		return "", nil
+	}
+	return json.Marshal(e)
+}
+
+func (e *EventList) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	var b []byte
+
+	switch v := value.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("store: cannot convert %T to EventList", value)
+	}
+
+	if len(b) == 0 {
+		return nil
+	}
+
+	var iterm []json.RawMessage
+	if err := json.Unmarshal(b, &iterm); err != nil {
+		return fmt.Errorf("store: unmarshal EventList: %w", err)
+	}
+
+	for _, item := range iterm {
+		var list []Event
+		if err := json.Unmarshal(item, &list); err == nil {
+			*e = append(*e, list...)
+			continue
+		}
+		var ev Event
+		if err := json.Unmarshal(item, &ev); err != nil {
+			return fmt.Errorf("store: unmarshal EventList: %w", err)
+		}
+		*e = append(*e, ev)
+	}
+
+	return nil
+}
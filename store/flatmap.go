@@ -0,0 +1,45 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// this is a json object of strings. It is used to store the structured
+// outputs of post hooks, i.e. the url of a pull request.
+type FlatMap map[string]string
+
+func (m FlatMap) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return "", nil
+	}
+	return json.Marshal(m)
+}
+
+func (m *FlatMap) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	var b []byte
+
+	switch v := value.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("store: cannot convert %T to FlatMap", value)
+	}
+
+	if len(b) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(b, m); err != nil {
+		return fmt.Errorf("store: unmarshal FlatMap: %w", err)
+	}
+
+	return nil
+}
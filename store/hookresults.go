@@ -0,0 +1,57 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// the result of a single post hook of a run. The status is success, failure or
+// skipped, if the status of the run did not match the on condition of the
+// hook. The position is the index of the hook in the chain.
+type HookResult struct {
+	Position int               `json:"position"`
+	Name     string            `json:"name"`
+	On       string            `json:"on"`
+	Status   string            `json:"status"`
+	Error    string            `json:"error,omitempty"`
+	Outputs  map[string]string `json:"outputs,omitempty"`
+}
+
+// this is a json array of hook results. It is used to record the result of
+// each post hook of a run, in the order they ran.
+type HookResults []HookResult
+
+func (r HookResults) Value() (driver.Value, error) {
+	if len(r) == 0 {
+		return "", nil
+	}
+	return json.Marshal(r)
+}
+
+func (r *HookResults) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	var b []byte
+
+	switch v := value.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("store: cannot convert %T to HookResults", value)
+	}
+
+	if len(b) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(b, r); err != nil {
+		return fmt.Errorf("store: unmarshal HookResults: %w", err)
+	}
+
+	return nil
+}
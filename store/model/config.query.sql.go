@@ -9,107 +9,287 @@ import (
 	"context"
 
 	git "github.com/bluebrown/kobold/git"
+	store "github.com/bluebrown/kobold/store"
 	null "github.com/volatiletech/null/v8"
 )
 
 const channelPut = `-- name: ChannelPut :exec
-insert into channel(name, decoder_name) values (?, ?)
-on conflict(name) do update set decoder_name = excluded.decoder_name
+insert into channel(name, decoder_name, decoder_args) values (?, ?, ?)
+on conflict(name) do update set decoder_name = excluded.decoder_name, decoder_args = excluded.decoder_args
 `
 
 type ChannelPutParams struct {
 	Name        string      `json:"name"`
 	DecoderName null.String `json:"decoder_name"`
+	DecoderArgs store.Args  `json:"decoder_args"`
 }
 
 // ChannelPut
 //
-//	insert into channel(name, decoder_name) values (?, ?)
-//	on conflict(name) do update set decoder_name = excluded.decoder_name
+//	insert into channel(name, decoder_name, decoder_args) values (?, ?, ?)
+//	on conflict(name) do update set decoder_name = excluded.decoder_name, decoder_args = excluded.decoder_args
 func (q *Queries) ChannelPut(ctx context.Context, arg ChannelPutParams) error {
-	_, err := q.db.ExecContext(ctx, channelPut, arg.Name, arg.DecoderName)
+	_, err := q.db.ExecContext(ctx, channelPut, arg.Name, arg.DecoderName, arg.DecoderArgs)
+	return err
+}
+
+const credentialPut = `-- name: CredentialPut :exec
+insert into credential(name, ssh_key_file, ssh_known_hosts_file, username, password_file) values (?, ?, ?, ?, ?)
+on conflict(name) do update set ssh_key_file = excluded.ssh_key_file, ssh_known_hosts_file = excluded.ssh_known_hosts_file, username = excluded.username, password_file = excluded.password_file
+`
+
+type CredentialPutParams struct {
+	Name              string      `json:"name"`
+	SshKeyFile        null.String `json:"ssh_key_file"`
+	SshKnownHostsFile null.String `json:"ssh_known_hosts_file"`
+	Username          null.String `json:"username"`
+	PasswordFile      null.String `json:"password_file"`
+}
+
+// CredentialPut
+//
+//	insert into credential(name, ssh_key_file, ssh_known_hosts_file, username, password_file) values (?, ?, ?, ?, ?)
+//	on conflict(name) do update set ssh_key_file = excluded.ssh_key_file, ssh_known_hosts_file = excluded.ssh_known_hosts_file, username = excluded.username, password_file = excluded.password_file
+func (q *Queries) CredentialPut(ctx context.Context, arg CredentialPutParams) error {
+	_, err := q.db.ExecContext(ctx, credentialPut,
+		arg.Name,
+		arg.SshKeyFile,
+		arg.SshKnownHostsFile,
+		arg.Username,
+		arg.PasswordFile,
+	)
 	return err
 }
 
 const decoderPut = `-- name: DecoderPut :exec
-insert into decoder(name, script) values (?, ?)
-on conflict(name) do update set script = excluded.script
+insert into decoder(name, script, env, secrets, hosts) values (?, ?, ?, ?, ?)
+on conflict(name) do update set script = excluded.script, env = excluded.env, secrets = excluded.secrets, hosts = excluded.hosts
 `
 
 type DecoderPutParams struct {
+	Name    string         `json:"name"`
+	Script  []byte         `json:"script"`
+	Env     store.FlatList `json:"env"`
+	Secrets store.FlatMap  `json:"secrets"`
+	Hosts   store.FlatList `json:"hosts"`
+}
+
+// DecoderPut
+//
+//	insert into decoder(name, script, env, secrets, hosts) values (?, ?, ?, ?, ?)
+//	on conflict(name) do update set script = excluded.script, env = excluded.env, secrets = excluded.secrets, hosts = excluded.hosts
+func (q *Queries) DecoderPut(ctx context.Context, arg DecoderPutParams) error {
+	_, err := q.db.ExecContext(ctx, decoderPut,
+		arg.Name,
+		arg.Script,
+		arg.Env,
+		arg.Secrets,
+		arg.Hosts,
+	)
+	return err
+}
+
+const identityPut = `-- name: IdentityPut :exec
+insert into identity(name, author_name, author_email, committer_name, committer_email, signing_format, signing_key_file) values (?, ?, ?, ?, ?, ?, ?)
+on conflict(name) do update set author_name = excluded.author_name, author_email = excluded.author_email, committer_name = excluded.committer_name, committer_email = excluded.committer_email, signing_format = excluded.signing_format, signing_key_file = excluded.signing_key_file
+`
+
+type IdentityPutParams struct {
+	Name           string      `json:"name"`
+	AuthorName     null.String `json:"author_name"`
+	AuthorEmail    null.String `json:"author_email"`
+	CommitterName  null.String `json:"committer_name"`
+	CommitterEmail null.String `json:"committer_email"`
+	SigningFormat  null.String `json:"signing_format"`
+	SigningKeyFile null.String `json:"signing_key_file"`
+}
+
+// IdentityPut
+//
+//	insert into identity(name, author_name, author_email, committer_name, committer_email, signing_format, signing_key_file) values (?, ?, ?, ?, ?, ?, ?)
+//	on conflict(name) do update set author_name = excluded.author_name, author_email = excluded.author_email, committer_name = excluded.committer_name, committer_email = excluded.committer_email, signing_format = excluded.signing_format, signing_key_file = excluded.signing_key_file
+func (q *Queries) IdentityPut(ctx context.Context, arg IdentityPutParams) error {
+	_, err := q.db.ExecContext(ctx, identityPut,
+		arg.Name,
+		arg.AuthorName,
+		arg.AuthorEmail,
+		arg.CommitterName,
+		arg.CommitterEmail,
+		arg.SigningFormat,
+		arg.SigningKeyFile,
+	)
+	return err
+}
+
+const pipelinePostHookPut = `-- name: PipelinePostHookPut :exec
+insert into pipeline_post_hook(pipeline_name, position, post_hook_name, run_on, args) values (?, ?, ?, ?, ?)
+on conflict(pipeline_name, position) do update set post_hook_name = excluded.post_hook_name, run_on = excluded.run_on, args = excluded.args
+`
+
+type PipelinePostHookPutParams struct {
+	PipelineName string     `json:"pipeline_name"`
+	Position     int64      `json:"position"`
+	PostHookName string     `json:"post_hook_name"`
+	RunOn        string     `json:"run_on"`
+	Args         store.Args `json:"args"`
+}
+
+// PipelinePostHookPut
+//
+//	insert into pipeline_post_hook(pipeline_name, position, post_hook_name, run_on, args) values (?, ?, ?, ?, ?)
+//	on conflict(pipeline_name, position) do update set post_hook_name = excluded.post_hook_name, run_on = excluded.run_on, args = excluded.args
+func (q *Queries) PipelinePostHookPut(ctx context.Context, arg PipelinePostHookPutParams) error {
+	_, err := q.db.ExecContext(ctx, pipelinePostHookPut,
+		arg.PipelineName,
+		arg.Position,
+		arg.PostHookName,
+		arg.RunOn,
+		arg.Args,
+	)
+	return err
+}
+
+const libraryPut = `-- name: LibraryPut :exec
+insert into library(name, script) values (?, ?)
+on conflict(name) do update set script = excluded.script
+`
+
+type LibraryPutParams struct {
 	Name   string `json:"name"`
 	Script []byte `json:"script"`
 }
 
-// DecoderPut
+// LibraryPut
 //
-//	insert into decoder(name, script) values (?, ?)
+//	insert into library(name, script) values (?, ?)
 //	on conflict(name) do update set script = excluded.script
-func (q *Queries) DecoderPut(ctx context.Context, arg DecoderPutParams) error {
-	_, err := q.db.ExecContext(ctx, decoderPut, arg.Name, arg.Script)
+func (q *Queries) LibraryPut(ctx context.Context, arg LibraryPutParams) error {
+	_, err := q.db.ExecContext(ctx, libraryPut, arg.Name, arg.Script)
 	return err
 }
 
 const pipelinePut = `-- name: PipelinePut :exec
-insert into pipeline(name, repo_uri, dest_branch, post_hook_name) values (?, ?, ?, ?)
-on conflict(name) do update set repo_uri = excluded.repo_uri, dest_branch = excluded.dest_branch, post_hook_name = excluded.post_hook_name
+insert into pipeline(name, repo_uri, dest_branch, credential_name, identity_name, commit_title, commit_body, pr_provider, pr_api_url, pr_credential_name, pr_labels, pr_reviewers, pr_team_reviewers, pr_draft, pr_auto_merge, pre_commit_name) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+on conflict(name) do update set repo_uri = excluded.repo_uri, dest_branch = excluded.dest_branch, credential_name = excluded.credential_name, identity_name = excluded.identity_name, commit_title = excluded.commit_title, commit_body = excluded.commit_body, pr_provider = excluded.pr_provider, pr_api_url = excluded.pr_api_url, pr_credential_name = excluded.pr_credential_name, pr_labels = excluded.pr_labels, pr_reviewers = excluded.pr_reviewers, pr_team_reviewers = excluded.pr_team_reviewers, pr_draft = excluded.pr_draft, pr_auto_merge = excluded.pr_auto_merge, pre_commit_name = excluded.pre_commit_name
 `
 
 type PipelinePutParams struct {
-	Name         string         `json:"name"`
-	RepoUri      git.PackageURI `json:"repo_uri"`
-	DestBranch   null.String    `json:"dest_branch"`
-	PostHookName null.String    `json:"post_hook_name"`
+	Name             string         `json:"name"`
+	RepoUri          git.PackageURI `json:"repo_uri"`
+	DestBranch       null.String    `json:"dest_branch"`
+	CredentialName   null.String    `json:"credential_name"`
+	IdentityName     null.String    `json:"identity_name"`
+	CommitTitle      null.String    `json:"commit_title"`
+	CommitBody       null.String    `json:"commit_body"`
+	PrProvider       null.String    `json:"pr_provider"`
+	PrApiUrl         null.String    `json:"pr_api_url"`
+	PrCredentialName null.String    `json:"pr_credential_name"`
+	PrLabels         store.FlatList `json:"pr_labels"`
+	PrReviewers      store.FlatList `json:"pr_reviewers"`
+	PrTeamReviewers  store.FlatList `json:"pr_team_reviewers"`
+	PrDraft          null.Bool      `json:"pr_draft"`
+	PrAutoMerge      null.String    `json:"pr_auto_merge"`
+	PreCommitName    null.String    `json:"pre_commit_name"`
 }
 
 // PipelinePut
 //
-//	insert into pipeline(name, repo_uri, dest_branch, post_hook_name) values (?, ?, ?, ?)
-//	on conflict(name) do update set repo_uri = excluded.repo_uri, dest_branch = excluded.dest_branch, post_hook_name = excluded.post_hook_name
+//	insert into pipeline(name, repo_uri, dest_branch, credential_name, identity_name, commit_title, commit_body, pr_provider, pr_api_url, pr_credential_name, pr_labels, pr_reviewers, pr_team_reviewers, pr_draft, pr_auto_merge, pre_commit_name) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+//	on conflict(name) do update set repo_uri = excluded.repo_uri, dest_branch = excluded.dest_branch, credential_name = excluded.credential_name, identity_name = excluded.identity_name, commit_title = excluded.commit_title, commit_body = excluded.commit_body, pr_provider = excluded.pr_provider, pr_api_url = excluded.pr_api_url, pr_credential_name = excluded.pr_credential_name, pr_labels = excluded.pr_labels, pr_reviewers = excluded.pr_reviewers, pr_team_reviewers = excluded.pr_team_reviewers, pr_draft = excluded.pr_draft, pr_auto_merge = excluded.pr_auto_merge, pre_commit_name = excluded.pre_commit_name
 func (q *Queries) PipelinePut(ctx context.Context, arg PipelinePutParams) error {
 	_, err := q.db.ExecContext(ctx, pipelinePut,
 		arg.Name,
 		arg.RepoUri,
 		arg.DestBranch,
-		arg.PostHookName,
+		arg.CredentialName,
+		arg.IdentityName,
+		arg.CommitTitle,
+		arg.CommitBody,
+		arg.PrProvider,
+		arg.PrApiUrl,
+		arg.PrCredentialName,
+		arg.PrLabels,
+		arg.PrReviewers,
+		arg.PrTeamReviewers,
+		arg.PrDraft,
+		arg.PrAutoMerge,
+		arg.PreCommitName,
 	)
 	return err
 }
 
 const postHookPut = `-- name: PostHookPut :exec
-insert into post_hook(name, script) values (?, ?)
-on conflict(name) do update set script = excluded.script
+insert into post_hook(name, script, env, secrets, hosts) values (?, ?, ?, ?, ?)
+on conflict(name) do update set script = excluded.script, env = excluded.env, secrets = excluded.secrets, hosts = excluded.hosts
 `
 
 type PostHookPutParams struct {
-	Name   string `json:"name"`
-	Script []byte `json:"script"`
+	Name    string         `json:"name"`
+	Script  []byte         `json:"script"`
+	Env     store.FlatList `json:"env"`
+	Secrets store.FlatMap  `json:"secrets"`
+	Hosts   store.FlatList `json:"hosts"`
 }
 
 // PostHookPut
 //
-//	insert into post_hook(name, script) values (?, ?)
-//	on conflict(name) do update set script = excluded.script
+//	insert into post_hook(name, script, env, secrets, hosts) values (?, ?, ?, ?, ?)
+//	on conflict(name) do update set script = excluded.script, env = excluded.env, secrets = excluded.secrets, hosts = excluded.hosts
 func (q *Queries) PostHookPut(ctx context.Context, arg PostHookPutParams) error {
-	_, err := q.db.ExecContext(ctx, postHookPut, arg.Name, arg.Script)
+	_, err := q.db.ExecContext(ctx, postHookPut,
+		arg.Name,
+		arg.Script,
+		arg.Env,
+		arg.Secrets,
+		arg.Hosts,
+	)
+	return err
+}
+
+const preCommitPut = `-- name: PreCommitPut :exec
+insert into pre_commit(name, script, env, secrets, hosts) values (?, ?, ?, ?, ?)
+on conflict(name) do update set script = excluded.script, env = excluded.env, secrets = excluded.secrets, hosts = excluded.hosts
+`
+
+type PreCommitPutParams struct {
+	Name    string         `json:"name"`
+	Script  []byte         `json:"script"`
+	Env     store.FlatList `json:"env"`
+	Secrets store.FlatMap  `json:"secrets"`
+	Hosts   store.FlatList `json:"hosts"`
+}
+
+// PreCommitPut
+//
+//	insert into pre_commit(name, script, env, secrets, hosts) values (?, ?, ?, ?, ?)
+//	on conflict(name) do update set script = excluded.script, env = excluded.env, secrets = excluded.secrets, hosts = excluded.hosts
+func (q *Queries) PreCommitPut(ctx context.Context, arg PreCommitPutParams) error {
+	_, err := q.db.ExecContext(ctx, preCommitPut,
+		arg.Name,
+		arg.Script,
+		arg.Env,
+		arg.Secrets,
+		arg.Hosts,
+	)
 	return err
 }
 
 const subscriptionPut = `-- name: SubscriptionPut :exec
-insert into subscription(pipeline_name, channel_name) values (?, ?)
-on conflict(pipeline_name, channel_name) do nothing
+insert into subscription(pipeline_name, channel_name, label_selector) values (?, ?, ?)
+on conflict(pipeline_name, channel_name) do update set label_selector = excluded.label_selector
 `
 
 type SubscriptionPutParams struct {
-	PipelineName string `json:"pipeline_name"`
-	ChannelName  string `json:"channel_name"`
+	PipelineName  string        `json:"pipeline_name"`
+	ChannelName   string        `json:"channel_name"`
+	LabelSelector store.FlatMap `json:"label_selector"`
 }
 
 // SubscriptionPut
 //
-//	insert into subscription(pipeline_name, channel_name) values (?, ?)
-//	on conflict(pipeline_name, channel_name) do nothing
+//	insert into subscription(pipeline_name, channel_name, label_selector) values (?, ?, ?)
+//	on conflict(pipeline_name, channel_name) do update set label_selector = excluded.label_selector
 func (q *Queries) SubscriptionPut(ctx context.Context, arg SubscriptionPutParams) error {
-	_, err := q.db.ExecContext(ctx, subscriptionPut, arg.PipelineName, arg.ChannelName)
+	_, err := q.db.ExecContext(ctx, subscriptionPut, arg.PipelineName, arg.ChannelName, arg.LabelSelector)
 	return err
 }
@@ -13,68 +13,187 @@ import (
 type Channel struct {
 	Name        string      `json:"name"`
 	DecoderName null.String `json:"decoder_name"`
+	DecoderArgs store.Args  `json:"decoder_args"`
+}
+
+type Credential struct {
+	Name              string      `json:"name"`
+	SshKeyFile        null.String `json:"ssh_key_file"`
+	SshKnownHostsFile null.String `json:"ssh_known_hosts_file"`
+	Username          null.String `json:"username"`
+	PasswordFile      null.String `json:"password_file"`
 }
 
 type Decoder struct {
+	Name    string         `json:"name"`
+	Script  []byte         `json:"script"`
+	Env     store.FlatList `json:"env"`
+	Secrets store.FlatMap  `json:"secrets"`
+	Hosts   store.FlatList `json:"hosts"`
+}
+
+type Identity struct {
+	Name           string      `json:"name"`
+	AuthorName     null.String `json:"author_name"`
+	AuthorEmail    null.String `json:"author_email"`
+	CommitterName  null.String `json:"committer_name"`
+	CommitterEmail null.String `json:"committer_email"`
+	SigningFormat  null.String `json:"signing_format"`
+	SigningKeyFile null.String `json:"signing_key_file"`
+}
+
+type Library struct {
 	Name   string `json:"name"`
 	Script []byte `json:"script"`
 }
 
 type Pipeline struct {
-	Name         string         `json:"name"`
-	RepoUri      git.PackageURI `json:"repo_uri"`
-	DestBranch   null.String    `json:"dest_branch"`
-	PostHookName null.String    `json:"post_hook_name"`
+	Name             string         `json:"name"`
+	RepoUri          git.PackageURI `json:"repo_uri"`
+	DestBranch       null.String    `json:"dest_branch"`
+	PostHookName     null.String    `json:"post_hook_name"`
+	CredentialName   null.String    `json:"credential_name"`
+	IdentityName     null.String    `json:"identity_name"`
+	CommitTitle      null.String    `json:"commit_title"`
+	CommitBody       null.String    `json:"commit_body"`
+	PrProvider       null.String    `json:"pr_provider"`
+	PrApiUrl         null.String    `json:"pr_api_url"`
+	PrCredentialName null.String    `json:"pr_credential_name"`
+	PrLabels         store.FlatList `json:"pr_labels"`
+	PrReviewers      store.FlatList `json:"pr_reviewers"`
+	PrTeamReviewers  store.FlatList `json:"pr_team_reviewers"`
+	PrDraft          null.Bool      `json:"pr_draft"`
+	PrAutoMerge      null.String    `json:"pr_auto_merge"`
+	PostHookArgs     store.Args     `json:"post_hook_args"`
+	PreCommitName    null.String    `json:"pre_commit_name"`
 }
 
 type PipelineListItem struct {
-	Name         string         `json:"name"`
-	RepoUri      git.PackageURI `json:"repo_uri"`
-	DestBranch   null.String    `json:"dest_branch"`
-	PostHookName null.String    `json:"post_hook_name"`
-	Channels     store.FlatList `json:"channels"`
+	Name             string         `json:"name"`
+	RepoUri          git.PackageURI `json:"repo_uri"`
+	DestBranch       null.String    `json:"dest_branch"`
+	PostHookName     null.String    `json:"post_hook_name"`
+	CredentialName   null.String    `json:"credential_name"`
+	IdentityName     null.String    `json:"identity_name"`
+	CommitTitle      null.String    `json:"commit_title"`
+	CommitBody       null.String    `json:"commit_body"`
+	PrProvider       null.String    `json:"pr_provider"`
+	PrApiUrl         null.String    `json:"pr_api_url"`
+	PrCredentialName null.String    `json:"pr_credential_name"`
+	PrLabels         store.FlatList `json:"pr_labels"`
+	PrReviewers      store.FlatList `json:"pr_reviewers"`
+	PrTeamReviewers  store.FlatList `json:"pr_team_reviewers"`
+	PrDraft          null.Bool      `json:"pr_draft"`
+	PrAutoMerge      null.String    `json:"pr_auto_merge"`
+	PostHookArgs     store.Args     `json:"post_hook_args"`
+	PreCommitName    null.String    `json:"pre_commit_name"`
+	Channels         store.FlatList `json:"channels"`
+}
+
+type PipelinePostHook struct {
+	PipelineName string     `json:"pipeline_name"`
+	Position     int64      `json:"position"`
+	PostHookName string     `json:"post_hook_name"`
+	RunOn        string     `json:"run_on"`
+	Args         store.Args `json:"args"`
 }
 
 type PostHook struct {
-	Name   string `json:"name"`
-	Script []byte `json:"script"`
+	Name    string         `json:"name"`
+	Script  []byte         `json:"script"`
+	Env     store.FlatList `json:"env"`
+	Secrets store.FlatMap  `json:"secrets"`
+	Hosts   store.FlatList `json:"hosts"`
+}
+
+type PreCommit struct {
+	Name    string         `json:"name"`
+	Script  []byte         `json:"script"`
+	Env     store.FlatList `json:"env"`
+	Secrets store.FlatMap  `json:"secrets"`
+	Hosts   store.FlatList `json:"hosts"`
 }
 
 type Run struct {
-	Fingerprint string         `json:"fingerprint"`
-	RepoUri     git.PackageURI `json:"repo_uri"`
-	DestBranch  null.String    `json:"dest_branch"`
-	PostHook    null.String    `json:"post_hook"`
-	Status      string         `json:"status"`
-	Timestamp   interface{}    `json:"timestamp"`
-	Warnings    store.FlatList `json:"warnings"`
-	Error       interface{}    `json:"error"`
-	Msgs        store.FlatList `json:"msgs"`
+	Fingerprint           string            `json:"fingerprint"`
+	RepoUri               git.PackageURI    `json:"repo_uri"`
+	DestBranch            null.String       `json:"dest_branch"`
+	PostHook              null.String       `json:"post_hook"`
+	Status                string            `json:"status"`
+	Timestamp             interface{}       `json:"timestamp"`
+	Warnings              store.FlatList    `json:"warnings"`
+	Error                 interface{}       `json:"error"`
+	SigningKeyFingerprint interface{}       `json:"signing_key_fingerprint"`
+	CommitSha             interface{}       `json:"commit_sha"`
+	PushedBranch          interface{}       `json:"pushed_branch"`
+	HookOutputs           store.FlatMap     `json:"hook_outputs"`
+	HookStatus            interface{}       `json:"hook_status"`
+	HookError             interface{}       `json:"hook_error"`
+	HookAttempts          interface{}       `json:"hook_attempts"`
+	HookResults           store.HookResults `json:"hook_results"`
+	Msgs                  store.FlatList    `json:"msgs"`
 }
 
 type Subscription struct {
-	PipelineName string `json:"pipeline_name"`
-	ChannelName  string `json:"channel_name"`
+	PipelineName  string        `json:"pipeline_name"`
+	ChannelName   string        `json:"channel_name"`
+	LabelSelector store.FlatMap `json:"label_selector"`
 }
 
 type Task struct {
-	ID                   string         `json:"id"`
-	Msgs                 store.FlatList `json:"msgs"`
-	RepoUri              git.PackageURI `json:"repo_uri"`
-	DestBranch           null.String    `json:"dest_branch"`
-	PostHookName         null.String    `json:"post_hook_name"`
-	Status               string         `json:"status"`
-	Timestamp            string         `json:"timestamp"`
-	Warnings             store.FlatList `json:"warnings"`
-	FailureReason        null.String    `json:"failure_reason"`
-	TaskGroupFingerprint null.String    `json:"task_group_fingerprint"`
+	ID                    string            `json:"id"`
+	Msgs                  store.FlatList    `json:"msgs"`
+	RepoUri               git.PackageURI    `json:"repo_uri"`
+	DestBranch            null.String       `json:"dest_branch"`
+	PostHookName          null.String       `json:"post_hook_name"`
+	Status                string            `json:"status"`
+	Timestamp             string            `json:"timestamp"`
+	Warnings              store.FlatList    `json:"warnings"`
+	FailureReason         null.String       `json:"failure_reason"`
+	TaskGroupFingerprint  null.String       `json:"task_group_fingerprint"`
+	CredentialName        null.String       `json:"credential_name"`
+	IdentityName          null.String       `json:"identity_name"`
+	SigningKeyFingerprint null.String       `json:"signing_key_fingerprint"`
+	PipelineName          null.String       `json:"pipeline_name"`
+	CommitSha             null.String       `json:"commit_sha"`
+	PushedBranch          null.String       `json:"pushed_branch"`
+	HookOutputs           store.FlatMap     `json:"hook_outputs"`
+	CommitMsg             null.String       `json:"commit_msg"`
+	Changes               store.ChangeList  `json:"changes"`
+	HookStatus            null.String       `json:"hook_status"`
+	HookError             null.String       `json:"hook_error"`
+	HookAttempts          int64             `json:"hook_attempts"`
+	HookResults           store.HookResults `json:"hook_results"`
+	Events                store.EventList   `json:"events"`
 }
 
 type TaskGroup struct {
-	Fingerprint string         `json:"fingerprint"`
-	RepoUri     git.PackageURI `json:"repo_uri"`
-	DestBranch  null.String    `json:"dest_branch"`
-	PostHook    []byte         `json:"post_hook"`
-	TaskIds     store.FlatList `json:"task_ids"`
-	Msgs        store.FlatList `json:"msgs"`
+	Fingerprint      string          `json:"fingerprint"`
+	RepoUri          git.PackageURI  `json:"repo_uri"`
+	DestBranch       null.String     `json:"dest_branch"`
+	PostHook         []byte          `json:"post_hook"`
+	PostHookArgs     store.Args      `json:"post_hook_args"`
+	PostHookEnv      store.FlatList  `json:"post_hook_env"`
+	PostHookSecrets  store.FlatMap   `json:"post_hook_secrets"`
+	PostHookHosts    store.FlatList  `json:"post_hook_hosts"`
+	PreCommit        []byte          `json:"pre_commit"`
+	PreCommitEnv     store.FlatList  `json:"pre_commit_env"`
+	PreCommitSecrets store.FlatMap   `json:"pre_commit_secrets"`
+	PreCommitHosts   store.FlatList  `json:"pre_commit_hosts"`
+	CredentialName   null.String     `json:"credential_name"`
+	IdentityName     null.String     `json:"identity_name"`
+	PipelineName     null.String     `json:"pipeline_name"`
+	CommitTitle      null.String     `json:"commit_title"`
+	CommitBody       null.String     `json:"commit_body"`
+	PrProvider       null.String     `json:"pr_provider"`
+	PrApiUrl         null.String     `json:"pr_api_url"`
+	PrCredentialName null.String     `json:"pr_credential_name"`
+	PrLabels         store.FlatList  `json:"pr_labels"`
+	PrReviewers      store.FlatList  `json:"pr_reviewers"`
+	PrTeamReviewers  store.FlatList  `json:"pr_team_reviewers"`
+	PrDraft          null.Bool       `json:"pr_draft"`
+	PrAutoMerge      null.String     `json:"pr_auto_merge"`
+	TaskIds          store.FlatList  `json:"task_ids"`
+	Msgs             store.FlatList  `json:"msgs"`
+	Events           store.EventList `json:"events"`
 }
@@ -15,26 +15,26 @@ import (
 )
 
 const channelGet = `-- name: ChannelGet :one
-select name, decoder_name from channel where name = ?
+select name, decoder_name, decoder_args from channel where name = ?
 `
 
 // ChannelGet
 //
-//	select name, decoder_name from channel where name = ?
+//	select name, decoder_name, decoder_args from channel where name = ?
 func (q *Queries) ChannelGet(ctx context.Context, name string) (Channel, error) {
 	row := q.db.QueryRowContext(ctx, channelGet, name)
 	var i Channel
-	err := row.Scan(&i.Name, &i.DecoderName)
+	err := row.Scan(&i.Name, &i.DecoderName, &i.DecoderArgs)
 	return i, err
 }
 
 const channelList = `-- name: ChannelList :many
-select name, decoder_name from channel
+select name, decoder_name, decoder_args from channel
 `
 
 // ChannelList
 //
-//	select name, decoder_name from channel
+//	select name, decoder_name, decoder_args from channel
 func (q *Queries) ChannelList(ctx context.Context) ([]Channel, error) {
 	rows, err := q.db.QueryContext(ctx, channelList)
 	if err != nil {
@@ -44,7 +44,7 @@ func (q *Queries) ChannelList(ctx context.Context) ([]Channel, error) {
 	items := []Channel{}
 	for rows.Next() {
 		var i Channel
-		if err := rows.Scan(&i.Name, &i.DecoderName); err != nil {
+		if err := rows.Scan(&i.Name, &i.DecoderName, &i.DecoderArgs); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -58,27 +58,53 @@ func (q *Queries) ChannelList(ctx context.Context) ([]Channel, error) {
 	return items, nil
 }
 
+const credentialGet = `-- name: CredentialGet :one
+select name, ssh_key_file, ssh_known_hosts_file, username, password_file from credential where name = ?
+`
+
+// CredentialGet
+//
+//	select name, ssh_key_file, ssh_known_hosts_file, username, password_file from credential where name = ?
+func (q *Queries) CredentialGet(ctx context.Context, name string) (Credential, error) {
+	row := q.db.QueryRowContext(ctx, credentialGet, name)
+	var i Credential
+	err := row.Scan(
+		&i.Name,
+		&i.SshKeyFile,
+		&i.SshKnownHostsFile,
+		&i.Username,
+		&i.PasswordFile,
+	)
+	return i, err
+}
+
 const decoderGet = `-- name: DecoderGet :one
-select name, script from decoder where name = ?
+select name, script, env, secrets, hosts from decoder where name = ?
 `
 
 // DecoderGet
 //
-//	select name, script from decoder where name = ?
+//	select name, script, env, secrets, hosts from decoder where name = ?
 func (q *Queries) DecoderGet(ctx context.Context, name string) (Decoder, error) {
 	row := q.db.QueryRowContext(ctx, decoderGet, name)
 	var i Decoder
-	err := row.Scan(&i.Name, &i.Script)
+	err := row.Scan(
+		&i.Name,
+		&i.Script,
+		&i.Env,
+		&i.Secrets,
+		&i.Hosts,
+	)
 	return i, err
 }
 
 const decoderList = `-- name: DecoderList :many
-select name, script from decoder
+select name, script, env, secrets, hosts from decoder
 `
 
 // DecoderList
 //
-//	select name, script from decoder
+//	select name, script, env, secrets, hosts from decoder
 func (q *Queries) DecoderList(ctx context.Context) ([]Decoder, error) {
 	rows, err := q.db.QueryContext(ctx, decoderList)
 	if err != nil {
@@ -88,7 +114,13 @@ func (q *Queries) DecoderList(ctx context.Context) ([]Decoder, error) {
 	items := []Decoder{}
 	for rows.Next() {
 		var i Decoder
-		if err := rows.Scan(&i.Name, &i.Script); err != nil {
+		if err := rows.Scan(
+			&i.Name,
+			&i.Script,
+			&i.Env,
+			&i.Secrets,
+			&i.Hosts,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -102,13 +134,35 @@ func (q *Queries) DecoderList(ctx context.Context) ([]Decoder, error) {
 	return items, nil
 }
 
+const identityGet = `-- name: IdentityGet :one
+select name, author_name, author_email, committer_name, committer_email, signing_format, signing_key_file from identity where name = ?
+`
+
+// IdentityGet
+//
+//	select name, author_name, author_email, committer_name, committer_email, signing_format, signing_key_file from identity where name = ?
+func (q *Queries) IdentityGet(ctx context.Context, name string) (Identity, error) {
+	row := q.db.QueryRowContext(ctx, identityGet, name)
+	var i Identity
+	err := row.Scan(
+		&i.Name,
+		&i.AuthorName,
+		&i.AuthorEmail,
+		&i.CommitterName,
+		&i.CommitterEmail,
+		&i.SigningFormat,
+		&i.SigningKeyFile,
+	)
+	return i, err
+}
+
 const pipelineGet = `-- name: PipelineGet :one
-select name, repo_uri, dest_branch, post_hook_name, channels from pipeline_list_item where name = ?
+select name, repo_uri, dest_branch, post_hook_name, credential_name, identity_name, commit_title, commit_body, pr_provider, pr_api_url, pr_credential_name, pr_labels, pr_reviewers, pr_team_reviewers, pr_draft, pr_auto_merge, post_hook_args, pre_commit_name, channels from pipeline_list_item where name = ?
 `
 
 // PipelineGet
 //
-//	select name, repo_uri, dest_branch, post_hook_name, channels from pipeline_list_item where name = ?
+//	select name, repo_uri, dest_branch, post_hook_name, credential_name, identity_name, commit_title, commit_body, pr_provider, pr_api_url, pr_credential_name, pr_labels, pr_reviewers, pr_team_reviewers, pr_draft, pr_auto_merge, post_hook_args, pre_commit_name, channels from pipeline_list_item where name = ?
 func (q *Queries) PipelineGet(ctx context.Context, name string) (PipelineListItem, error) {
 	row := q.db.QueryRowContext(ctx, pipelineGet, name)
 	var i PipelineListItem
@@ -117,18 +171,32 @@ func (q *Queries) PipelineGet(ctx context.Context, name string) (PipelineListIte
 		&i.RepoUri,
 		&i.DestBranch,
 		&i.PostHookName,
+		&i.CredentialName,
+		&i.IdentityName,
+		&i.CommitTitle,
+		&i.CommitBody,
+		&i.PrProvider,
+		&i.PrApiUrl,
+		&i.PrCredentialName,
+		&i.PrLabels,
+		&i.PrReviewers,
+		&i.PrTeamReviewers,
+		&i.PrDraft,
+		&i.PrAutoMerge,
+		&i.PostHookArgs,
+		&i.PreCommitName,
 		&i.Channels,
 	)
 	return i, err
 }
 
 const pipelineList = `-- name: PipelineList :many
-select name, repo_uri, dest_branch, post_hook_name, channels from pipeline_list_item
+select name, repo_uri, dest_branch, post_hook_name, credential_name, identity_name, commit_title, commit_body, pr_provider, pr_api_url, pr_credential_name, pr_labels, pr_reviewers, pr_team_reviewers, pr_draft, pr_auto_merge, post_hook_args, pre_commit_name, channels from pipeline_list_item
 `
 
 // PipelineList
 //
-//	select name, repo_uri, dest_branch, post_hook_name, channels from pipeline_list_item
+//	select name, repo_uri, dest_branch, post_hook_name, credential_name, identity_name, commit_title, commit_body, pr_provider, pr_api_url, pr_credential_name, pr_labels, pr_reviewers, pr_team_reviewers, pr_draft, pr_auto_merge, post_hook_args, pre_commit_name, channels from pipeline_list_item
 func (q *Queries) PipelineList(ctx context.Context) ([]PipelineListItem, error) {
 	rows, err := q.db.QueryContext(ctx, pipelineList)
 	if err != nil {
@@ -143,6 +211,20 @@ func (q *Queries) PipelineList(ctx context.Context) ([]PipelineListItem, error)
 			&i.RepoUri,
 			&i.DestBranch,
 			&i.PostHookName,
+			&i.CredentialName,
+			&i.IdentityName,
+			&i.CommitTitle,
+			&i.CommitBody,
+			&i.PrProvider,
+			&i.PrApiUrl,
+			&i.PrCredentialName,
+			&i.PrLabels,
+			&i.PrReviewers,
+			&i.PrTeamReviewers,
+			&i.PrDraft,
+			&i.PrAutoMerge,
+			&i.PostHookArgs,
+			&i.PreCommitName,
 			&i.Channels,
 		); err != nil {
 			return nil, err
@@ -159,7 +241,7 @@ func (q *Queries) PipelineList(ctx context.Context) ([]PipelineListItem, error)
 }
 
 const pipelineRunList = `-- name: PipelineRunList :many
-select p.name, r.fingerprint, r.repo_uri, r.dest_branch, r.post_hook, r.status, r.timestamp, r.warnings, r.error, r.msgs from run r
+select p.name, r.fingerprint, r.repo_uri, r.dest_branch, r.post_hook, r.status, r.timestamp, r.warnings, r.error, r.signing_key_fingerprint, r.commit_sha, r.pushed_branch, r.hook_outputs, r.hook_status, r.hook_error, r.hook_attempts, r.hook_results, r.msgs from run r
 left join pipeline p on r.repo_uri = p.repo_uri and ifnull(r.dest_branch, '') = ifnull(p.dest_branch, '')
 where p.name = ?
 and r.status in (/*SLICE:status*/?)
@@ -174,21 +256,29 @@ type PipelineRunListParams struct {
 }
 
 type PipelineRunListRow struct {
-	Name        null.String    `json:"name"`
-	Fingerprint string         `json:"fingerprint"`
-	RepoUri     git.PackageURI `json:"repo_uri"`
-	DestBranch  null.String    `json:"dest_branch"`
-	PostHook    null.String    `json:"post_hook"`
-	Status      string         `json:"status"`
-	Timestamp   interface{}    `json:"timestamp"`
-	Warnings    store.FlatList `json:"warnings"`
-	Error       interface{}    `json:"error"`
-	Msgs        store.FlatList `json:"msgs"`
+	Name                  null.String       `json:"name"`
+	Fingerprint           string            `json:"fingerprint"`
+	RepoUri               git.PackageURI    `json:"repo_uri"`
+	DestBranch            null.String       `json:"dest_branch"`
+	PostHook              null.String       `json:"post_hook"`
+	Status                string            `json:"status"`
+	Timestamp             interface{}       `json:"timestamp"`
+	Warnings              store.FlatList    `json:"warnings"`
+	Error                 interface{}       `json:"error"`
+	SigningKeyFingerprint interface{}       `json:"signing_key_fingerprint"`
+	CommitSha             interface{}       `json:"commit_sha"`
+	PushedBranch          interface{}       `json:"pushed_branch"`
+	HookOutputs           store.FlatMap     `json:"hook_outputs"`
+	HookStatus            interface{}       `json:"hook_status"`
+	HookError             interface{}       `json:"hook_error"`
+	HookAttempts          interface{}       `json:"hook_attempts"`
+	HookResults           store.HookResults `json:"hook_results"`
+	Msgs                  store.FlatList    `json:"msgs"`
 }
 
 // PipelineRunList
 //
-//	select p.name, r.fingerprint, r.repo_uri, r.dest_branch, r.post_hook, r.status, r.timestamp, r.warnings, r.error, r.msgs from run r
+//	select p.name, r.fingerprint, r.repo_uri, r.dest_branch, r.post_hook, r.status, r.timestamp, r.warnings, r.error, r.signing_key_fingerprint, r.commit_sha, r.pushed_branch, r.hook_outputs, r.hook_status, r.hook_error, r.hook_attempts, r.hook_results, r.msgs from run r
 //	left join pipeline p on r.repo_uri = p.repo_uri and ifnull(r.dest_branch, '') = ifnull(p.dest_branch, '')
 //	where p.name = ?
 //	and r.status in (/*SLICE:status*/?)
@@ -225,6 +315,14 @@ func (q *Queries) PipelineRunList(ctx context.Context, arg PipelineRunListParams
 			&i.Timestamp,
 			&i.Warnings,
 			&i.Error,
+			&i.SigningKeyFingerprint,
+			&i.CommitSha,
+			&i.PushedBranch,
+			&i.HookOutputs,
+			&i.HookStatus,
+			&i.HookError,
+			&i.HookAttempts,
+			&i.HookResults,
 			&i.Msgs,
 		); err != nil {
 			return nil, err
@@ -241,26 +339,32 @@ func (q *Queries) PipelineRunList(ctx context.Context, arg PipelineRunListParams
 }
 
 const postHookGet = `-- name: PostHookGet :one
-select name, script from post_hook where name = ?
+select name, script, env, secrets, hosts from post_hook where name = ?
 `
 
 // PostHookGet
 //
-//	select name, script from post_hook where name = ?
+//	select name, script, env, secrets, hosts from post_hook where name = ?
 func (q *Queries) PostHookGet(ctx context.Context, name string) (PostHook, error) {
 	row := q.db.QueryRowContext(ctx, postHookGet, name)
 	var i PostHook
-	err := row.Scan(&i.Name, &i.Script)
+	err := row.Scan(
+		&i.Name,
+		&i.Script,
+		&i.Env,
+		&i.Secrets,
+		&i.Hosts,
+	)
 	return i, err
 }
 
 const postHookList = `-- name: PostHookList :many
-select name, script from post_hook
+select name, script, env, secrets, hosts from post_hook
 `
 
 // PostHookList
 //
-//	select name, script from post_hook
+//	select name, script, env, secrets, hosts from post_hook
 func (q *Queries) PostHookList(ctx context.Context) ([]PostHook, error) {
 	rows, err := q.db.QueryContext(ctx, postHookList)
 	if err != nil {
@@ -270,7 +374,13 @@ func (q *Queries) PostHookList(ctx context.Context) ([]PostHook, error) {
 	items := []PostHook{}
 	for rows.Next() {
 		var i PostHook
-		if err := rows.Scan(&i.Name, &i.Script); err != nil {
+		if err := rows.Scan(
+			&i.Name,
+			&i.Script,
+			&i.Env,
+			&i.Secrets,
+			&i.Hosts,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -285,13 +395,13 @@ func (q *Queries) PostHookList(ctx context.Context) ([]PostHook, error) {
 }
 
 const runGet = `-- name: RunGet :one
-select fingerprint, repo_uri, dest_branch, post_hook, status, timestamp, warnings, error, msgs from run
+select fingerprint, repo_uri, dest_branch, post_hook, status, timestamp, warnings, error, signing_key_fingerprint, commit_sha, pushed_branch, hook_outputs, hook_status, hook_error, hook_attempts, hook_results, msgs from run
 where fingerprint = ?
 `
 
 // RunGet
 //
-//	select fingerprint, repo_uri, dest_branch, post_hook, status, timestamp, warnings, error, msgs from run
+//	select fingerprint, repo_uri, dest_branch, post_hook, status, timestamp, warnings, error, signing_key_fingerprint, commit_sha, pushed_branch, hook_outputs, hook_status, hook_error, hook_attempts, hook_results, msgs from run
 //	where fingerprint = ?
 func (q *Queries) RunGet(ctx context.Context, fingerprint string) (Run, error) {
 	row := q.db.QueryRowContext(ctx, runGet, fingerprint)
@@ -305,13 +415,21 @@ func (q *Queries) RunGet(ctx context.Context, fingerprint string) (Run, error) {
 		&i.Timestamp,
 		&i.Warnings,
 		&i.Error,
+		&i.SigningKeyFingerprint,
+		&i.CommitSha,
+		&i.PushedBranch,
+		&i.HookOutputs,
+		&i.HookStatus,
+		&i.HookError,
+		&i.HookAttempts,
+		&i.HookResults,
 		&i.Msgs,
 	)
 	return i, err
 }
 
 const runList = `-- name: RunList :many
-select fingerprint, repo_uri, dest_branch, post_hook, status, timestamp, warnings, error, msgs from run
+select fingerprint, repo_uri, dest_branch, post_hook, status, timestamp, warnings, error, signing_key_fingerprint, commit_sha, pushed_branch, hook_outputs, hook_status, hook_error, hook_attempts, hook_results, msgs from run
 where status in (/*SLICE:status*/?)
 limit ? offset ?
 `
@@ -324,7 +442,7 @@ type RunListParams struct {
 
 // RunList
 //
-//	select fingerprint, repo_uri, dest_branch, post_hook, status, timestamp, warnings, error, msgs from run
+//	select fingerprint, repo_uri, dest_branch, post_hook, status, timestamp, warnings, error, signing_key_fingerprint, commit_sha, pushed_branch, hook_outputs, hook_status, hook_error, hook_attempts, hook_results, msgs from run
 //	where status in (/*SLICE:status*/?)
 //	limit ? offset ?
 func (q *Queries) RunList(ctx context.Context, arg RunListParams) ([]Run, error) {
@@ -357,6 +475,14 @@ func (q *Queries) RunList(ctx context.Context, arg RunListParams) ([]Run, error)
 			&i.Timestamp,
 			&i.Warnings,
 			&i.Error,
+			&i.SigningKeyFingerprint,
+			&i.CommitSha,
+			&i.PushedBranch,
+			&i.HookOutputs,
+			&i.HookStatus,
+			&i.HookError,
+			&i.HookAttempts,
+			&i.HookResults,
 			&i.Msgs,
 		); err != nil {
 			return nil, err
@@ -372,13 +498,69 @@ func (q *Queries) RunList(ctx context.Context, arg RunListParams) ([]Run, error)
 	return items, nil
 }
 
+const preCommitGet = `-- name: PreCommitGet :one
+select name, script, env, secrets, hosts from pre_commit where name = ?
+`
+
+// PreCommitGet
+//
+//	select name, script, env, secrets, hosts from pre_commit where name = ?
+func (q *Queries) PreCommitGet(ctx context.Context, name string) (PreCommit, error) {
+	row := q.db.QueryRowContext(ctx, preCommitGet, name)
+	var i PreCommit
+	err := row.Scan(
+		&i.Name,
+		&i.Script,
+		&i.Env,
+		&i.Secrets,
+		&i.Hosts,
+	)
+	return i, err
+}
+
+const preCommitList = `-- name: PreCommitList :many
+select name, script, env, secrets, hosts from pre_commit
+`
+
+// PreCommitList
+//
+//	select name, script, env, secrets, hosts from pre_commit
+func (q *Queries) PreCommitList(ctx context.Context) ([]PreCommit, error) {
+	rows, err := q.db.QueryContext(ctx, preCommitList)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []PreCommit{}
+	for rows.Next() {
+		var i PreCommit
+		if err := rows.Scan(
+			&i.Name,
+			&i.Script,
+			&i.Env,
+			&i.Secrets,
+			&i.Hosts,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const taskGet = `-- name: TaskGet :one
-select id, msgs, repo_uri, dest_branch, post_hook_name, status, timestamp, warnings, failure_reason, task_group_fingerprint from task where id = ?
+select id, msgs, repo_uri, dest_branch, post_hook_name, status, timestamp, warnings, failure_reason, task_group_fingerprint, credential_name, identity_name, signing_key_fingerprint, pipeline_name, commit_sha, pushed_branch, hook_outputs, commit_msg, changes, hook_status, hook_error, hook_attempts, hook_results, events from task where id = ?
 `
 
 // TaskGet
 //
-//	select id, msgs, repo_uri, dest_branch, post_hook_name, status, timestamp, warnings, failure_reason, task_group_fingerprint from task where id = ?
+//	select id, msgs, repo_uri, dest_branch, post_hook_name, status, timestamp, warnings, failure_reason, task_group_fingerprint, credential_name, identity_name, signing_key_fingerprint, pipeline_name, commit_sha, pushed_branch, hook_outputs, commit_msg, changes, hook_status, hook_error, hook_attempts, hook_results, events from task where id = ?
 func (q *Queries) TaskGet(ctx context.Context, id string) (Task, error) {
 	row := q.db.QueryRowContext(ctx, taskGet, id)
 	var i Task
@@ -393,12 +575,26 @@ func (q *Queries) TaskGet(ctx context.Context, id string) (Task, error) {
 		&i.Warnings,
 		&i.FailureReason,
 		&i.TaskGroupFingerprint,
+		&i.CredentialName,
+		&i.IdentityName,
+		&i.SigningKeyFingerprint,
+		&i.PipelineName,
+		&i.CommitSha,
+		&i.PushedBranch,
+		&i.HookOutputs,
+		&i.CommitMsg,
+		&i.Changes,
+		&i.HookStatus,
+		&i.HookError,
+		&i.HookAttempts,
+		&i.HookResults,
+		&i.Events,
 	)
 	return i, err
 }
 
 const taskList = `-- name: TaskList :many
-select id, msgs, repo_uri, dest_branch, post_hook_name, status, timestamp, warnings, failure_reason, task_group_fingerprint from task
+select id, msgs, repo_uri, dest_branch, post_hook_name, status, timestamp, warnings, failure_reason, task_group_fingerprint, credential_name, identity_name, signing_key_fingerprint, pipeline_name, commit_sha, pushed_branch, hook_outputs, commit_msg, changes, hook_status, hook_error, hook_attempts, hook_results, events from task
 where status in (/*SLICE:status*/?)
 order by timestamp desc
 limit ? offset ?
@@ -412,7 +608,7 @@ type TaskListParams struct {
 
 // TaskList
 //
-//	select id, msgs, repo_uri, dest_branch, post_hook_name, status, timestamp, warnings, failure_reason, task_group_fingerprint from task
+//	select id, msgs, repo_uri, dest_branch, post_hook_name, status, timestamp, warnings, failure_reason, task_group_fingerprint, credential_name, identity_name, signing_key_fingerprint, pipeline_name, commit_sha, pushed_branch, hook_outputs, commit_msg, changes, hook_status, hook_error, hook_attempts, hook_results, events from task
 //	where status in (/*SLICE:status*/?)
 //	order by timestamp desc
 //	limit ? offset ?
@@ -448,6 +644,20 @@ func (q *Queries) TaskList(ctx context.Context, arg TaskListParams) ([]Task, err
 			&i.Warnings,
 			&i.FailureReason,
 			&i.TaskGroupFingerprint,
+			&i.CredentialName,
+			&i.IdentityName,
+			&i.SigningKeyFingerprint,
+			&i.PipelineName,
+			&i.CommitSha,
+			&i.PushedBranch,
+			&i.HookOutputs,
+			&i.CommitMsg,
+			&i.Changes,
+			&i.HookStatus,
+			&i.HookError,
+			&i.HookAttempts,
+			&i.HookResults,
+			&i.Events,
 		); err != nil {
 			return nil, err
 		}
@@ -9,31 +9,339 @@ import (
 	"context"
 	"strings"
 
+	git "github.com/bluebrown/kobold/git"
 	store "github.com/bluebrown/kobold/store"
 	null "github.com/volatiletech/null/v8"
 )
 
 const channelDecoderGet = `-- name: ChannelDecoderGet :one
-select d.script from channel c left join decoder d on c.decoder_name = d.name where c.name = ?
+select c.decoder_name, d.script, c.decoder_args, d.env, d.secrets, d.hosts from channel c left join decoder d on c.decoder_name = d.name where c.name = ?
 `
 
+type ChannelDecoderGetRow struct {
+	DecoderName null.String    `json:"decoder_name"`
+	Script      []byte         `json:"script"`
+	DecoderArgs store.Args     `json:"decoder_args"`
+	Env         store.FlatList `json:"env"`
+	Secrets     store.FlatMap  `json:"secrets"`
+	Hosts       store.FlatList `json:"hosts"`
+}
+
 // ChannelDecoderGet
 //
-//	select d.script from channel c left join decoder d on c.decoder_name = d.name where c.name = ?
-func (q *Queries) ChannelDecoderGet(ctx context.Context, name string) ([]byte, error) {
+//	select c.decoder_name, d.script, c.decoder_args, d.env, d.secrets, d.hosts from channel c left join decoder d on c.decoder_name = d.name where c.name = ?
+func (q *Queries) ChannelDecoderGet(ctx context.Context, name string) (ChannelDecoderGetRow, error) {
 	row := q.db.QueryRowContext(ctx, channelDecoderGet, name)
+	var i ChannelDecoderGetRow
+	err := row.Scan(
+		&i.DecoderName,
+		&i.Script,
+		&i.DecoderArgs,
+		&i.Env,
+		&i.Secrets,
+		&i.Hosts,
+	)
+	return i, err
+}
+
+const libraryGet = `-- name: LibraryGet :one
+select script from library where name = ?
+`
+
+// get the script of a library module
+//
+//	select script from library where name = ?
+func (q *Queries) LibraryGet(ctx context.Context, name string) ([]byte, error) {
+	row := q.db.QueryRowContext(ctx, libraryGet, name)
 	var script []byte
 	err := row.Scan(&script)
 	return script, err
 }
 
+const pipelinePostHookList = `-- name: PipelinePostHookList :many
+select pph.post_hook_name, pph.run_on, pph.args, ph.script, ph.env, ph.secrets, ph.hosts
+from pipeline_post_hook pph
+left join post_hook ph on pph.post_hook_name = ph.name
+where pph.pipeline_name = ?
+order by pph.position
+`
+
+type PipelinePostHookListRow struct {
+	PostHookName string         `json:"post_hook_name"`
+	RunOn        string         `json:"run_on"`
+	Args         store.Args     `json:"args"`
+	Script       []byte         `json:"script"`
+	Env          store.FlatList `json:"env"`
+	Secrets      store.FlatMap  `json:"secrets"`
+	Hosts        store.FlatList `json:"hosts"`
+}
+
+// list the post hooks of a pipeline, in the order they run. the script is null,
+// if the post hook does not exist
+//
+//	select pph.post_hook_name, pph.run_on, pph.args, ph.script, ph.env, ph.secrets, ph.hosts
+//	from pipeline_post_hook pph
+//	left join post_hook ph on pph.post_hook_name = ph.name
+//	where pph.pipeline_name = ?
+//	order by pph.position
+func (q *Queries) PipelinePostHookList(ctx context.Context, pipelineName string) ([]PipelinePostHookListRow, error) {
+	rows, err := q.db.QueryContext(ctx, pipelinePostHookList, pipelineName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []PipelinePostHookListRow{}
+	for rows.Next() {
+		var i PipelinePostHookListRow
+		if err := rows.Scan(
+			&i.PostHookName,
+			&i.RunOn,
+			&i.Args,
+			&i.Script,
+			&i.Env,
+			&i.Secrets,
+			&i.Hosts,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const pipelineRepoList = `-- name: PipelineRepoList :many
+select distinct repo_uri from pipeline
+`
+
+// list the distinct repo uris of all pipelines. This is used to determine which
+// repos are still required by the repo cache
+//
+//	select distinct repo_uri from pipeline
+func (q *Queries) PipelineRepoList(ctx context.Context) ([]git.PackageURI, error) {
+	rows, err := q.db.QueryContext(ctx, pipelineRepoList)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []git.PackageURI{}
+	for rows.Next() {
+		var repo_uri git.PackageURI
+		if err := rows.Scan(&repo_uri); err != nil {
+			return nil, err
+		}
+		items = append(items, repo_uri)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const runHookGet = `-- name: RunHookGet :one
+select
+  t.task_group_fingerprint as fingerprint,
+  t.repo_uri,
+  t.pushed_branch,
+  t.pipeline_name,
+  t.credential_name,
+  p.pr_provider,
+  p.pr_api_url,
+  p.pr_credential_name,
+  p.pr_labels,
+  p.pr_reviewers,
+  p.pr_team_reviewers,
+  p.pr_draft,
+  p.pr_auto_merge,
+  t.status,
+  t.failure_reason,
+  t.hook_status,
+  t.hook_outputs,
+  t.hook_results,
+  t.commit_msg,
+  t.commit_sha,
+  t.changes,
+  t.warnings,
+  json_group_array(t.id) as task_ids,
+  json_group_array(json(ifnull(nullif(t.events, ''), '[]'))) as events
+from task t
+left join pipeline p on t.pipeline_name = p.name
+where t.task_group_fingerprint = ?
+group by t.task_group_fingerprint
+`
+
+type RunHookGetRow struct {
+	Fingerprint      string            `json:"fingerprint"`
+	RepoUri          git.PackageURI    `json:"repo_uri"`
+	PushedBranch     null.String       `json:"pushed_branch"`
+	PipelineName     null.String       `json:"pipeline_name"`
+	CredentialName   null.String       `json:"credential_name"`
+	PrProvider       null.String       `json:"pr_provider"`
+	PrApiUrl         null.String       `json:"pr_api_url"`
+	PrCredentialName null.String       `json:"pr_credential_name"`
+	PrLabels         store.FlatList    `json:"pr_labels"`
+	PrReviewers      store.FlatList    `json:"pr_reviewers"`
+	PrTeamReviewers  store.FlatList    `json:"pr_team_reviewers"`
+	PrDraft          null.Bool         `json:"pr_draft"`
+	PrAutoMerge      null.String       `json:"pr_auto_merge"`
+	Status           string            `json:"status"`
+	FailureReason    null.String       `json:"failure_reason"`
+	HookStatus       null.String       `json:"hook_status"`
+	HookOutputs      store.FlatMap     `json:"hook_outputs"`
+	HookResults      store.HookResults `json:"hook_results"`
+	CommitMsg        null.String       `json:"commit_msg"`
+	CommitSha        null.String       `json:"commit_sha"`
+	Changes          store.ChangeList  `json:"changes"`
+	Warnings         store.FlatList    `json:"warnings"`
+	TaskIds          store.FlatList    `json:"task_ids"`
+	Events           store.EventList   `json:"events"`
+}
+
+// get the hook stage of a run, along with its inputs, so that it can be retried
+//
+//	select
+//	  t.task_group_fingerprint as fingerprint,
+//	  t.repo_uri,
+//	  t.pushed_branch,
+//	  t.pipeline_name,
+//	  t.credential_name,
+//	  p.pr_provider,
+//	  p.pr_api_url,
+//	  p.pr_credential_name,
+//	  p.pr_labels,
+//	  p.pr_reviewers,
+//	  p.pr_team_reviewers,
+//	  p.pr_draft,
+//	  p.pr_auto_merge,
+//	  t.status,
+//	  t.failure_reason,
+//	  t.hook_status,
+//	  t.hook_outputs,
+//	  t.hook_results,
+//	  t.commit_msg,
+//	  t.commit_sha,
+//	  t.changes,
+//	  t.warnings,
+//	  json_group_array(t.id) as task_ids,
+//	  json_group_array(json(ifnull(nullif(t.events, ''), '[]'))) as events
+//	from task t
+//	left join pipeline p on t.pipeline_name = p.name
+//	where t.task_group_fingerprint = ?
+//	group by t.task_group_fingerprint
+func (q *Queries) RunHookGet(ctx context.Context, taskGroupFingerprint null.String) (RunHookGetRow, error) {
+	row := q.db.QueryRowContext(ctx, runHookGet, taskGroupFingerprint)
+	var i RunHookGetRow
+	err := row.Scan(
+		&i.Fingerprint,
+		&i.RepoUri,
+		&i.PushedBranch,
+		&i.PipelineName,
+		&i.CredentialName,
+		&i.PrProvider,
+		&i.PrApiUrl,
+		&i.PrCredentialName,
+		&i.PrLabels,
+		&i.PrReviewers,
+		&i.PrTeamReviewers,
+		&i.PrDraft,
+		&i.PrAutoMerge,
+		&i.Status,
+		&i.FailureReason,
+		&i.HookStatus,
+		&i.HookOutputs,
+		&i.HookResults,
+		&i.CommitMsg,
+		&i.CommitSha,
+		&i.Changes,
+		&i.Warnings,
+		&i.TaskIds,
+		&i.Events,
+	)
+	return i, err
+}
+
+const runHookStatusCompSwap = `-- name: RunHookStatusCompSwap :many
+update task
+set
+  hook_status = ?,
+  hook_error = ?,
+  hook_outputs = ?,
+  hook_results = ?,
+  hook_attempts = hook_attempts + ?5
+where task_group_fingerprint = ?6
+and hook_status = ?7
+returning id
+`
+
+type RunHookStatusCompSwapParams struct {
+	HookStatus    null.String       `json:"hook_status"`
+	HookError     null.String       `json:"hook_error"`
+	HookOutputs   store.FlatMap     `json:"hook_outputs"`
+	HookResults   store.HookResults `json:"hook_results"`
+	Attempts      int64             `json:"attempts"`
+	Fingerprint   null.String       `json:"fingerprint"`
+	ReqHookStatus null.String       `json:"req_hook_status"`
+}
+
+// set the hook status of all tasks of a run, where the hook status matches the
+// req_hook_status. returns the ids of the tasks that were updated
+//
+//	update task
+//	set
+//	  hook_status = ?,
+//	  hook_error = ?,
+//	  hook_outputs = ?,
+//	  hook_results = ?,
+//	  hook_attempts = hook_attempts + ?5
+//	where task_group_fingerprint = ?6
+//	and hook_status = ?7
+//	returning id
+func (q *Queries) RunHookStatusCompSwap(ctx context.Context, arg RunHookStatusCompSwapParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, runHookStatusCompSwap,
+		arg.HookStatus,
+		arg.HookError,
+		arg.HookOutputs,
+		arg.HookResults,
+		arg.Attempts,
+		arg.Fingerprint,
+		arg.ReqHookStatus,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const taskGroupsListPending = `-- name: TaskGroupsListPending :many
-select fingerprint, repo_uri, dest_branch, post_hook, task_ids, msgs from task_group
+select fingerprint, repo_uri, dest_branch, post_hook, post_hook_args, post_hook_env, post_hook_secrets, post_hook_hosts, pre_commit, pre_commit_env, pre_commit_secrets, pre_commit_hosts, credential_name, identity_name, pipeline_name, commit_title, commit_body, pr_provider, pr_api_url, pr_credential_name, pr_labels, pr_reviewers, pr_team_reviewers, pr_draft, pr_auto_merge, task_ids, msgs, events from task_group
 `
 
 // TaskGroupsListPending
 //
-//	select fingerprint, repo_uri, dest_branch, post_hook, task_ids, msgs from task_group
+//	select fingerprint, repo_uri, dest_branch, post_hook, post_hook_args, post_hook_env, post_hook_secrets, post_hook_hosts, pre_commit, pre_commit_env, pre_commit_secrets, pre_commit_hosts, credential_name, identity_name, pipeline_name, commit_title, commit_body, pr_provider, pr_api_url, pr_credential_name, pr_labels, pr_reviewers, pr_team_reviewers, pr_draft, pr_auto_merge, task_ids, msgs, events from task_group
 func (q *Queries) TaskGroupsListPending(ctx context.Context) ([]TaskGroup, error) {
 	rows, err := q.db.QueryContext(ctx, taskGroupsListPending)
 	if err != nil {
@@ -48,8 +356,30 @@ func (q *Queries) TaskGroupsListPending(ctx context.Context) ([]TaskGroup, error
 			&i.RepoUri,
 			&i.DestBranch,
 			&i.PostHook,
+			&i.PostHookArgs,
+			&i.PostHookEnv,
+			&i.PostHookSecrets,
+			&i.PostHookHosts,
+			&i.PreCommit,
+			&i.PreCommitEnv,
+			&i.PreCommitSecrets,
+			&i.PreCommitHosts,
+			&i.CredentialName,
+			&i.IdentityName,
+			&i.PipelineName,
+			&i.CommitTitle,
+			&i.CommitBody,
+			&i.PrProvider,
+			&i.PrApiUrl,
+			&i.PrCredentialName,
+			&i.PrLabels,
+			&i.PrReviewers,
+			&i.PrTeamReviewers,
+			&i.PrDraft,
+			&i.PrAutoMerge,
 			&i.TaskIds,
 			&i.Msgs,
+			&i.Events,
 		); err != nil {
 			return nil, err
 		}
@@ -70,19 +400,33 @@ set
   task_group_fingerprint = ?,
   status = ?,
   warnings = ?,
-  failure_reason = ?
-WHERE status = ?5
+  failure_reason = ?,
+  signing_key_fingerprint = ?,
+  commit_sha = ?,
+  pushed_branch = ?,
+  hook_outputs = ?,
+  commit_msg = ?,
+  changes = ?,
+  hook_status = ?
+WHERE status = ?12
 and id IN (/*SLICE:ids*/?)
 returning id
 `
 
 type TaskGroupsStatusCompSwapParams struct {
-	TaskGroupFingerprint null.String    `json:"task_group_fingerprint"`
-	Status               string         `json:"status"`
-	Warnings             store.FlatList `json:"warnings"`
-	FailureReason        null.String    `json:"failure_reason"`
-	ReqStatus            string         `json:"req_status"`
-	Ids                  []string       `json:"ids"`
+	TaskGroupFingerprint  null.String      `json:"task_group_fingerprint"`
+	Status                string           `json:"status"`
+	Warnings              store.FlatList   `json:"warnings"`
+	FailureReason         null.String      `json:"failure_reason"`
+	SigningKeyFingerprint null.String      `json:"signing_key_fingerprint"`
+	CommitSha             null.String      `json:"commit_sha"`
+	PushedBranch          null.String      `json:"pushed_branch"`
+	HookOutputs           store.FlatMap    `json:"hook_outputs"`
+	CommitMsg             null.String      `json:"commit_msg"`
+	Changes               store.ChangeList `json:"changes"`
+	HookStatus            null.String      `json:"hook_status"`
+	ReqStatus             string           `json:"req_status"`
+	Ids                   []string         `json:"ids"`
 }
 
 // set the status of all tasks in a group where the status matches the
@@ -93,8 +437,15 @@ type TaskGroupsStatusCompSwapParams struct {
 //	  task_group_fingerprint = ?,
 //	  status = ?,
 //	  warnings = ?,
-//	  failure_reason = ?
-//	WHERE status = ?5
+//	  failure_reason = ?,
+//	  signing_key_fingerprint = ?,
+//	  commit_sha = ?,
+//	  pushed_branch = ?,
+//	  hook_outputs = ?,
+//	  commit_msg = ?,
+//	  changes = ?,
+//	  hook_status = ?
+//	WHERE status = ?12
 //	and id IN (/*SLICE:ids*/?)
 //	returning id
 func (q *Queries) TaskGroupsStatusCompSwap(ctx context.Context, arg TaskGroupsStatusCompSwapParams) ([]string, error) {
@@ -104,6 +455,13 @@ func (q *Queries) TaskGroupsStatusCompSwap(ctx context.Context, arg TaskGroupsSt
 	queryParams = append(queryParams, arg.Status)
 	queryParams = append(queryParams, arg.Warnings)
 	queryParams = append(queryParams, arg.FailureReason)
+	queryParams = append(queryParams, arg.SigningKeyFingerprint)
+	queryParams = append(queryParams, arg.CommitSha)
+	queryParams = append(queryParams, arg.PushedBranch)
+	queryParams = append(queryParams, arg.HookOutputs)
+	queryParams = append(queryParams, arg.CommitMsg)
+	queryParams = append(queryParams, arg.Changes)
+	queryParams = append(queryParams, arg.HookStatus)
 	queryParams = append(queryParams, arg.ReqStatus)
 	if len(arg.Ids) > 0 {
 		for _, v := range arg.Ids {
@@ -136,47 +494,70 @@ func (q *Queries) TaskGroupsStatusCompSwap(ctx context.Context, arg TaskGroupsSt
 }
 
 const tasksAppend = `-- name: TasksAppend :many
-insert into task (msgs, repo_uri, dest_branch, post_hook_name, status, timestamp)
+-- insert a task for each pipeline subscribed to the channel, with the events
+-- that match the label selector of the subscription. pipelines without any
+-- matching event get no task
+insert into task (msgs, events, pipeline_name, repo_uri, dest_branch, credential_name, identity_name, status, timestamp)
 select
-  ?,
+  json_group_array(json_extract(e.value, '$.ref')),
+  json_group_array(json(e.value)),
+  p.name,
   p.repo_uri,
   p.dest_branch,
-  ph.name,
+  p.credential_name,
+  p.identity_name,
   'pending',
   datetime('now')
 from pipeline p
   join subscription s on p.name = s.pipeline_name
   join channel c on s.channel_name = c.name
-  -- join the post_hook if it exists but don't fail if it doesn't
-  left join post_hook ph on p.post_hook_name = ph.name
+  join json_each(?) e
 where c.name = ?
+  -- every label of the selector must be set to the same value on the event
+  and not exists (
+    select 1 from json_each(nullif(s.label_selector, '')) l
+    where (select v.value from json_each(e.value, '$.labels') v where v.key = l.key) is not l.value
+  )
+group by p.name
 returning id
 `
 
 type TasksAppendParams struct {
-	Msgs store.FlatList `json:"msgs"`
-	Name string         `json:"name"`
+	Events store.EventList `json:"events"`
+	Name   string          `json:"name"`
 }
 
 // TasksAppend
 //
-//	insert into task (msgs, repo_uri, dest_branch, post_hook_name, status, timestamp)
+// insert a task for each pipeline subscribed to the channel, with the events
+// that match the label selector of the subscription. pipelines without any
+// matching event get no task
+//
+//	insert into task (msgs, events, pipeline_name, repo_uri, dest_branch, credential_name, identity_name, status, timestamp)
 //	select
-//	  ?,
+//	  json_group_array(json_extract(e.value, '$.ref')),
+//	  json_group_array(json(e.value)),
+//	  p.name,
 //	  p.repo_uri,
 //	  p.dest_branch,
-//	  ph.name,
+//	  p.credential_name,
+//	  p.identity_name,
 //	  'pending',
 //	  datetime('now')
 //	from pipeline p
 //	  join subscription s on p.name = s.pipeline_name
 //	  join channel c on s.channel_name = c.name
-//	  -- join the post_hook if it exists but don't fail if it doesn't
-//	  left join post_hook ph on p.post_hook_name = ph.name
+//	  join json_each(?) e
 //	where c.name = ?
+//	  -- every label of the selector must be set to the same value on the event
+//	  and not exists (
+//	    select 1 from json_each(nullif(s.label_selector, '')) l
+//	    where (select v.value from json_each(e.value, '$.labels') v where v.key = l.key) is not l.value
+//	  )
+//	group by p.name
 //	returning id
 func (q *Queries) TasksAppend(ctx context.Context, arg TasksAppendParams) ([]string, error) {
-	rows, err := q.db.QueryContext(ctx, tasksAppend, arg.Msgs, arg.Name)
+	rows, err := q.db.QueryContext(ctx, tasksAppend, arg.Events, arg.Name)
 	if err != nil {
 		return nil, err
 	}
@@ -1,5 +1,10 @@
 delete from channel;
 delete from pipeline;
 delete from subscription;
+delete from pipeline_post_hook;
 delete from decoder;
 delete from post_hook;
+delete from pre_commit;
+delete from library;
+delete from credential;
+delete from identity;
@@ -1,19 +1,39 @@
 -- name: ChannelPut :exec
-insert into channel(name, decoder_name) values (?, ?)
-on conflict(name) do update set decoder_name = excluded.decoder_name;
+insert into channel(name, decoder_name, decoder_args) values (?, ?, ?)
+on conflict(name) do update set decoder_name = excluded.decoder_name, decoder_args = excluded.decoder_args;
 
 -- name: DecoderPut :exec
-insert into decoder(name, script) values (?, ?)
-on conflict(name) do update set script = excluded.script;
+insert into decoder(name, script, env, secrets, hosts) values (?, ?, ?, ?, ?)
+on conflict(name) do update set script = excluded.script, env = excluded.env, secrets = excluded.secrets, hosts = excluded.hosts;
 
 -- name: PipelinePut :exec
-insert into pipeline(name, repo_uri, dest_branch, post_hook_name) values (?, ?, ?, ?)
-on conflict(name) do update set repo_uri = excluded.repo_uri, dest_branch = excluded.dest_branch, post_hook_name = excluded.post_hook_name;
+insert into pipeline(name, repo_uri, dest_branch, credential_name, identity_name, commit_title, commit_body, pr_provider, pr_api_url, pr_credential_name, pr_labels, pr_reviewers, pr_team_reviewers, pr_draft, pr_auto_merge, pre_commit_name) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+on conflict(name) do update set repo_uri = excluded.repo_uri, dest_branch = excluded.dest_branch, credential_name = excluded.credential_name, identity_name = excluded.identity_name, commit_title = excluded.commit_title, commit_body = excluded.commit_body, pr_provider = excluded.pr_provider, pr_api_url = excluded.pr_api_url, pr_credential_name = excluded.pr_credential_name, pr_labels = excluded.pr_labels, pr_reviewers = excluded.pr_reviewers, pr_team_reviewers = excluded.pr_team_reviewers, pr_draft = excluded.pr_draft, pr_auto_merge = excluded.pr_auto_merge, pre_commit_name = excluded.pre_commit_name;
+
+-- name: PipelinePostHookPut :exec
+insert into pipeline_post_hook(pipeline_name, position, post_hook_name, run_on, args) values (?, ?, ?, ?, ?)
+on conflict(pipeline_name, position) do update set post_hook_name = excluded.post_hook_name, run_on = excluded.run_on, args = excluded.args;
+
+-- name: CredentialPut :exec
+insert into credential(name, ssh_key_file, ssh_known_hosts_file, username, password_file) values (?, ?, ?, ?, ?)
+on conflict(name) do update set ssh_key_file = excluded.ssh_key_file, ssh_known_hosts_file = excluded.ssh_known_hosts_file, username = excluded.username, password_file = excluded.password_file;
+
+-- name: IdentityPut :exec
+insert into identity(name, author_name, author_email, committer_name, committer_email, signing_format, signing_key_file) values (?, ?, ?, ?, ?, ?, ?)
+on conflict(name) do update set author_name = excluded.author_name, author_email = excluded.author_email, committer_name = excluded.committer_name, committer_email = excluded.committer_email, signing_format = excluded.signing_format, signing_key_file = excluded.signing_key_file;
 
 -- name: SubscriptionPut :exec
-insert into subscription(pipeline_name, channel_name) values (?, ?)
-on conflict(pipeline_name, channel_name) do nothing;
+insert into subscription(pipeline_name, channel_name, label_selector) values (?, ?, ?)
+on conflict(pipeline_name, channel_name) do update set label_selector = excluded.label_selector;
 
 -- name: PostHookPut :exec
-insert into post_hook(name, script) values (?, ?)
-on conflict(name) do update set script = excluded.script;
\ No newline at end of file
+insert into post_hook(name, script, env, secrets, hosts) values (?, ?, ?, ?, ?)
+on conflict(name) do update set script = excluded.script, env = excluded.env, secrets = excluded.secrets, hosts = excluded.hosts;
+
+-- name: PreCommitPut :exec
+insert into pre_commit(name, script, env, secrets, hosts) values (?, ?, ?, ?, ?)
+on conflict(name) do update set script = excluded.script, env = excluded.env, secrets = excluded.secrets, hosts = excluded.hosts;
+
+-- name: LibraryPut :exec
+insert into library(name, script) values (?, ?)
+on conflict(name) do update set script = excluded.script;
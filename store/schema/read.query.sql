@@ -4,12 +4,18 @@ select * from channel where name = ?;
 -- name: ChannelList :many
 select * from channel;
 
+-- name: CredentialGet :one
+select * from credential where name = ?;
+
 -- name: DecoderGet :one
 select * from decoder where name = ?;
 
 -- name: DecoderList :many
 select * from decoder;
 
+-- name: IdentityGet :one
+select * from identity where name = ?;
+
 -- name: PipelineGet :one
 select * from pipeline_list_item where name = ?;
 
@@ -22,6 +28,12 @@ select * from post_hook where name = ?;
 -- name: PostHookList :many
 select * from post_hook;
 
+-- name: PreCommitGet :one
+select * from pre_commit where name = ?;
+
+-- name: PreCommitList :many
+select * from pre_commit;
+
 -- name: TaskGet :one
 select * from task where id = ?;
 
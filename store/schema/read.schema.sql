@@ -23,6 +23,14 @@ select
   max(timestamp) as timestamp,
   max(warnings) as warnings,
   max(failure_reason) as error,
+  max(signing_key_fingerprint) as signing_key_fingerprint,
+  max(commit_sha) as commit_sha,
+  max(pushed_branch) as pushed_branch,
+  max(hook_outputs) as hook_outputs,
+  max(hook_status) as hook_status,
+  max(hook_error) as hook_error,
+  max(hook_attempts) as hook_attempts,
+  max(hook_results) as hook_results,
   json_group_array(json(msgs)) as msgs
 from task
 group by
@@ -1,24 +1,53 @@
 -- name: ChannelDecoderGet :one
-select d.script from channel c left join decoder d on c.decoder_name = d.name where c.name = ?;
+select c.decoder_name, d.script, c.decoder_args, d.env, d.secrets, d.hosts from channel c left join decoder d on c.decoder_name = d.name where c.name = ?;
+
+-- name: LibraryGet :one
+-- get the script of a library module
+select script from library where name = ?;
+
+-- name: PipelinePostHookList :many
+-- list the post hooks of a pipeline, in the order they run. the script is null,
+-- if the post hook does not exist
+select pph.post_hook_name, pph.run_on, pph.args, ph.script, ph.env, ph.secrets, ph.hosts
+from pipeline_post_hook pph
+left join post_hook ph on pph.post_hook_name = ph.name
+where pph.pipeline_name = ?
+order by pph.position;
+
+-- name: PipelineRepoList :many
+-- list the distinct repo uris of all pipelines. This is used to determine which
+-- repos are still required by the repo cache
+select distinct repo_uri from pipeline;
 
 -- name: TaskGroupsListPending :many
 select * from task_group;
 
 -- name: TasksAppend :many
-insert into task (msgs, repo_uri, dest_branch, post_hook_name, status, timestamp)
+-- insert a task for each pipeline subscribed to the channel, with the events
+-- that match the label selector of the subscription. pipelines without any
+-- matching event get no task
+insert into task (msgs, events, pipeline_name, repo_uri, dest_branch, credential_name, identity_name, status, timestamp)
 select
-  ?,
+  json_group_array(json_extract(e.value, '$.ref')),
+  json_group_array(json(e.value)),
+  p.name,
   p.repo_uri,
   p.dest_branch,
-  ph.name,
+  p.credential_name,
+  p.identity_name,
   'pending',
   datetime('now')
 from pipeline p
   join subscription s on p.name = s.pipeline_name
   join channel c on s.channel_name = c.name
-  -- join the post_hook if it exists but don't fail if it doesn't
-  left join post_hook ph on p.post_hook_name = ph.name
+  join json_each(?) e
 where c.name = ?
+  -- every label of the selector must be set to the same value on the event
+  and not exists (
+    select 1 from json_each(nullif(s.label_selector, '')) l
+    where (select v.value from json_each(e.value, '$.labels') v where v.key = l.key) is not l.value
+  )
+group by p.name
 returning id;
 
 
@@ -30,7 +59,60 @@ set
   task_group_fingerprint = ?,
   status = ?,
   warnings = ?,
-  failure_reason = ?
+  failure_reason = ?,
+  signing_key_fingerprint = ?,
+  commit_sha = ?,
+  pushed_branch = ?,
+  hook_outputs = ?,
+  commit_msg = ?,
+  changes = ?,
+  hook_status = ?
 WHERE status = sqlc.arg(req_status)
 and id IN (sqlc.slice('ids'))
 returning id;
+
+-- name: RunHookGet :one
+-- get the hook stage of a run, along with its inputs, so that it can be retried
+select
+  t.task_group_fingerprint as fingerprint,
+  t.repo_uri,
+  t.pushed_branch,
+  t.pipeline_name,
+  t.credential_name,
+  p.pr_provider,
+  p.pr_api_url,
+  p.pr_credential_name,
+  p.pr_labels,
+  p.pr_reviewers,
+  p.pr_team_reviewers,
+  p.pr_draft,
+  p.pr_auto_merge,
+  t.status,
+  t.failure_reason,
+  t.hook_status,
+  t.hook_outputs,
+  t.hook_results,
+  t.commit_msg,
+  t.commit_sha,
+  t.changes,
+  t.warnings,
+  json_group_array(t.id) as task_ids,
+  json_group_array(json(ifnull(nullif(t.events, ''), '[]'))) as events
+from task t
+left join pipeline p on t.pipeline_name = p.name
+where t.task_group_fingerprint = ?
+group by t.task_group_fingerprint;
+
+-- name: RunHookStatusCompSwap :many
+-- set the hook status of all tasks of a run, where the hook status matches the
+-- req_hook_status. returns the ids of the tasks that were updated
+update task
+set
+  hook_status = ?,
+  hook_error = ?,
+  hook_outputs = ?,
+  hook_results = ?,
+  hook_attempts = hook_attempts + sqlc.arg(attempts)
+where task_group_fingerprint = sqlc.arg(fingerprint)
+and hook_status = sqlc.arg(req_hook_status)
+returning id;
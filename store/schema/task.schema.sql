@@ -1,15 +1,23 @@
 -- a channel gives a name to an incoming data stream. if a decoder is provded,
--- it will be used before the data is stored
+-- it will be used before the data is stored. the decoder args are passed to the
+-- decoder as keyword arguments
 create table if not exists channel (
   name    text not null primary key,
-  decoder_name text
+  decoder_name text,
+  decoder_args text
 );
 
 -- a decoder is a starlark script that should normalize the incoming data into a
--- format that can be used by the pipeline
+-- format that can be used by the pipeline. scripts see only the host env
+-- variables listed in env, and the secrets, which map a name to a file, whose
+-- content is read when the script runs. they may only reach the listed hosts
+-- over http
 create table if not exists decoder (
   name text not null primary key,
-  script blob
+  script blob,
+  env text,
+  secrets text,
+  hosts text
 );
 
 -- a post hook is a starlark script that will be run after a pipeline has been
@@ -17,29 +25,111 @@ create table if not exists decoder (
 -- request
 create table if not exists post_hook (
   name text not null primary key,
-  script blob
+  script blob,
+  env text,
+  secrets text,
+  hosts text
+);
+
+-- a pre commit hook is a starlark script that runs before the changes of a
+-- pipeline are committed. it can reject the run, or drop individual changes
+create table if not exists pre_commit (
+  name text not null primary key,
+  script blob,
+  env text,
+  secrets text,
+  hosts text
+);
+
+-- a library is a starlark module, that scripts can load as lib/<name>, so that
+-- common helpers can be shared across them
+create table if not exists library (
+  name text not null primary key,
+  script blob not null
+);
+
+-- a credential is used to authenticate against the git remote of a pipeline.
+-- only file paths are stored, the secrets themselves never enter the database
+create table if not exists credential (
+  name                 text not null primary key,
+  ssh_key_file         text,
+  ssh_known_hosts_file text,
+  username             text,
+  password_file        text
+);
+
+-- an identity is used to author, commit and optionally sign the commits of a
+-- pipeline. the signing key is referenced by file, like the credential secrets
+create table if not exists identity (
+  name             text not null primary key,
+  author_name      text,
+  author_email     text,
+  committer_name   text,
+  committer_email  text,
+  signing_format   text check (signing_format in ('ssh', 'openpgp')),
+  signing_key_file text
 );
 
 -- a pipeline respresents a set of mutations against a git repository it a
--- function over input data
+-- function over input data. the commit title and body are go templates. if a
+-- pr provider is set, a pull request is opened natively, after the push. the
+-- pr options apply to the native pull request and are passed to post hooks.
+-- the pre commit hook runs before the changes are committed. the post hook
+-- name and args are no longer written. the post hooks of a pipeline, including
+-- the legacy post hook, are in pipeline_post_hook
 create table if not exists pipeline (
   name        text not null primary key,
   repo_uri    text not null,
   dest_branch text,
-  post_hook_name text
+  post_hook_name text,
+  credential_name text,
+  identity_name text,
+  commit_title text,
+  commit_body text,
+  pr_provider text check (pr_provider in ('github', 'gitlab', 'gitea', 'bitbucket', 'azure')),
+  pr_api_url text,
+  pr_credential_name text,
+  pr_labels text,
+  pr_reviewers text,
+  pr_team_reviewers text,
+  pr_draft boolean,
+  pr_auto_merge text check (pr_auto_merge in ('merge', 'squash', 'rebase')),
+  post_hook_args text,
+  pre_commit_name text
+);
+
+-- the post hooks of a pipeline run as a chain, in the order of their position.
+-- run_on is the status, the run must have, for the hook to run. a failing hook
+-- turns the status to failure, so that the following success hooks are
+-- skipped, while failure and always hooks still run
+create table if not exists pipeline_post_hook (
+  pipeline_name  text not null,
+  position       integer not null,
+  post_hook_name text not null,
+  run_on         text not null check (run_on in ('success', 'failure', 'always')) default 'success',
+  args           text,
+  primary key (pipeline_name, position)
 );
 
 -- the subscription links a pipeline to a channel- The intention is that
 -- everytime a message is received on the channel, the pipeline will be run with
--- the decoded message as input
+-- the decoded message as input. the label selector is a json object. if set,
+-- only events with all of its labels are passed to the pipeline
 create table if not exists subscription (
   pipeline_name text not null,
   channel_name  text not null,
+  label_selector text,
   primary key (pipeline_name, channel_name)
 );
 
 -- a task represents a single mutation against a git repository it is the
--- combination of a pipeline and concrete input data
+-- combination of a pipeline and concrete input data. the post hook is a
+-- separate stage, that runs after the push, or after a failure. its status is
+-- null, if there is no hook to run. the hook results are the result of each
+-- hook of the chain. the commit message and changes are kept as input for
+-- retries. the events are the decoded msgs, along with their action and labels.
+-- the post hook name is no longer written, the hooks are taken from the chain of
+-- the pipeline
 create table if not exists task (
   id             text not null primary key default (uuid()),
   msgs           text not null,
@@ -50,7 +140,21 @@ create table if not exists task (
   timestamp      text not null,
   warnings       text,
   failure_reason text,
-  task_group_fingerprint text check (status == 'pending' or task_group_fingerprint is not null)
+  task_group_fingerprint text check (status == 'pending' or task_group_fingerprint is not null),
+  credential_name text,
+  identity_name text,
+  signing_key_fingerprint text,
+  pipeline_name text,
+  commit_sha text,
+  pushed_branch text,
+  hook_outputs text,
+  commit_msg text,
+  changes text,
+  hook_status text check (hook_status in ('pending', 'running', 'success', 'failure')),
+  hook_error text,
+  hook_attempts integer not null default 0,
+  hook_results text,
+  events text
 );
 
 -- task groups are used to coordinate the execution of tasks. since pipelines
@@ -61,13 +165,38 @@ create table if not exists task (
 -- all tasks with the same fingerprint, have been executed as group called a run
 create view if not exists task_group as
 select
-  sha1(group_concat(id)) as fingerprint,
-  repo_uri,
-  dest_branch,
-  ph.script as post_hook,
-  json_group_array(id) as task_ids,
-  json_group_array(json(msgs)) as msgs
-from task
-left join post_hook ph on task.post_hook_name = ph.name
-where status = 'pending'
-group by repo_uri, dest_branch, post_hook_name;
+  sha1(group_concat(t.id)) as fingerprint,
+  t.repo_uri,
+  t.dest_branch,
+  -- the post hooks are the chain of the pipeline. these columns are set for
+  -- each hook of the chain, when it runs
+  null as post_hook,
+  null as post_hook_args,
+  null as post_hook_env,
+  null as post_hook_secrets,
+  null as post_hook_hosts,
+  pc.script as pre_commit,
+  pc.env as pre_commit_env,
+  pc.secrets as pre_commit_secrets,
+  pc.hosts as pre_commit_hosts,
+  t.credential_name,
+  t.identity_name,
+  t.pipeline_name,
+  p.commit_title,
+  p.commit_body,
+  p.pr_provider,
+  p.pr_api_url,
+  p.pr_credential_name,
+  p.pr_labels,
+  p.pr_reviewers,
+  p.pr_team_reviewers,
+  p.pr_draft,
+  p.pr_auto_merge,
+  json_group_array(t.id) as task_ids,
+  json_group_array(json(t.msgs)) as msgs,
+  json_group_array(json(ifnull(nullif(t.events, ''), '[]'))) as events
+from task t
+left join pipeline p on t.pipeline_name = p.name
+left join pre_commit pc on p.pre_commit_name = pc.name
+where t.status = 'pending'
+group by t.repo_uri, t.dest_branch, t.credential_name, t.identity_name, t.pipeline_name;
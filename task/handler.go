@@ -6,107 +6,241 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+	"text/template"
+	"unicode"
 
 	"github.com/bluebrown/kobold/git"
 	"github.com/bluebrown/kobold/krm"
+	"github.com/bluebrown/kobold/plugin"
 	"github.com/bluebrown/kobold/store/model"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 // the task handler is the final point of execution. After decoding, debouncing
 // and aggregating the events, this handler is responsible for the actual work.
-func KoboldHandler(ctx context.Context, cache string, g model.TaskGroup, runner HookRunner) ([]string, error) {
+// The post hook is not part of it, it is run by the pool, as separate stage.
+// The cache path is a worktree, already checked out at the groups ref. The
+// commit is authored and signed by the git identity carried by ctx, if any.
+func KoboldHandler(ctx context.Context, cache string, g model.TaskGroup) (Result, error) {
 	var (
 		changes  []krm.Change
 		warnings []string
 		msg      string
 	)
 
-	if err := git.Switch(ctx, cache, g.RepoUri.Ref); err != nil {
-		return nil, fmt.Errorf("git switch: %#q => %#q: %w", g.RepoUri.Repo, g.RepoUri.Ref, err)
+	pkg := filepath.Join(cache, g.RepoUri.Pkg)
+
+	keep, err := preCommit(ctx, pkg, g)
+	if err != nil {
+		return Result{}, fmt.Errorf("pre commit: %w", err)
 	}
 
-	changes, warnings, err := krm.Pipeline(ctx, filepath.Join(cache, g.RepoUri.Pkg), g.Msgs...)
+	changes, warnings, err = krm.PipelineKeep(ctx, pkg, keep, g.Msgs...)
 	if err != nil {
-		return nil, fmt.Errorf("krm pipeline: %w", err)
+		return Result{}, fmt.Errorf("krm pipeline: %w", err)
 	}
 
 	if len(changes) < 1 {
-		return nil, nil
+		return Result{}, nil
 	}
 
 	if g.DestBranch.Valid {
 		g.DestBranch.String = g.DestBranch.String + "-" + g.Fingerprint
 		if err := git.CheckoutB(ctx, cache, g.DestBranch.String); err != nil {
-			return nil, fmt.Errorf("git checkout -b: %w", err)
+			return Result{}, fmt.Errorf("git checkout -b: %w", err)
 		}
 	} else {
 		g.DestBranch.String = g.RepoUri.Ref
 		g.DestBranch.Valid = true
 	}
 
-	msg, err = commitMessage(changes)
+	msg, err = commitMessage(g, changes)
 	if err != nil {
-		return nil, fmt.Errorf("get commit message: %w", err)
+		return Result{}, fmt.Errorf("get commit message: %w", err)
 	}
 
-	if err := git.Publish(ctx, cache, g.DestBranch.String, msg); err != nil {
-		return nil, fmt.Errorf("git publish: %w", err)
+	pushed, err := git.Publish(ctx, cache, g.DestBranch.String, msg)
+	if err != nil {
+		return Result{}, fmt.Errorf("git publish: %w", err)
 	}
 
 	metricGitPush.With(prometheus.Labels{"repo": g.RepoUri.Repo}).Inc()
 
-	if runner == nil || len(changes) == 0 {
-		return warnings, nil
+	return Result{
+		Warnings:              warnings,
+		SigningKeyFingerprint: pushed.SigningKeyFingerprint,
+		CommitSHA:             pushed.SHA,
+		Branch:                g.DestBranch.String,
+		Message:               msg,
+		Changes:               changes,
+	}, nil
+}
+
+// run the pre commit hook of the group, if any, against the changes the krm
+// pipeline would make. Returns a function reporting, which changes to keep, or
+// nil to keep all changes. If the hook rejects the run, the error wraps
+// plugin.ErrRejected.
+func preCommit(ctx context.Context, pkg string, g model.TaskGroup) (func(krm.Change) bool, error) {
+	if g.PreCommit == nil {
+		return nil, nil
+	}
+
+	planned, _, err := krm.Plan(ctx, pkg, g.Msgs...)
+	if err != nil {
+		return nil, fmt.Errorf("krm plan: %w", err)
+	}
+
+	if len(planned) == 0 {
+		return nil, nil
+	}
+
+	kept, err := plugin.NewPreCommitRunner().Run(ctx, g, pkg, planned)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := runner.Run(g, msg, changes, warnings); err != nil {
-		return warnings, fmt.Errorf("hook: %w", err)
+	set := make(map[krm.Change]bool, len(kept))
+	for _, c := range kept {
+		set[c] = true
 	}
 
-	return warnings, nil
+	return func(c krm.Change) bool { return set[c] }, nil
+}
+
+// the default templates produce the same message kobold has always used. The
+// body lists the first change of each repo. Without custom templates, it
+// follows the title directly, without a blank line.
+const (
+	defaultCommitTitle = `chore(kobold): Update image refs`
+	defaultCommitBody  = `{{ range .Changes }} * {{ .Repo }}: {{ .Description }}
+{{ end }}`
+)
+
+// the data passed to the commit title and body templates of a pipeline.
+type commitData struct {
+	Pipeline    string
+	Fingerprint string
+	TaskIDs     []string
+	Changes     []krm.Change
 }
 
-func commitMessage(changes []krm.Change) (string, error) {
-	seen := make(map[string]struct{})
+// render the commit message of the task group from the templates of its
+// pipeline. Title and body are separated by a blank line, so that trailers
+// at the end of the body are recognized by git.
+func commitMessage(g model.TaskGroup, changes []krm.Change) (string, error) {
+	data := commitData{
+		Pipeline:    g.PipelineName.String,
+		Fingerprint: g.Fingerprint,
+		TaskIDs:     g.TaskIds,
+		Changes:     uniqueChanges(changes),
+	}
+
+	title, err := renderTemplate("title", g.CommitTitle.String, defaultCommitTitle, data)
+	if err != nil {
+		return "", err
+	}
+
+	title = strings.TrimSpace(title)
+	if title == "" || strings.Contains(title, "\n") {
+		return "", fmt.Errorf("commit title must be a single non empty line, got %q", title)
+	}
 
-	msg := strings.Builder{}
-	if _, err := msg.WriteString("chore(kobold): Update image refs\n"); err != nil {
-		return "", fmt.Errorf("write header: %w", err)
+	bodyData := data
+	if g.CommitBody.String == "" {
+		bodyData.Changes = firstChangePerRepo(data.Changes)
 	}
 
-	for _, change := range changes {
-		if _, ok := seen[change.Repo]; ok {
+	body, err := renderTemplate("body", g.CommitBody.String, defaultCommitBody, bodyData)
+	if err != nil {
+		return "", err
+	}
+
+	// Only trim leading newlines, since the body may be indented.
+	if body = strings.TrimRightFunc(strings.TrimLeft(body, "\n"), unicode.IsSpace); body == "" {
+		return title, nil
+	}
+
+	if g.CommitTitle.String == "" && g.CommitBody.String == "" {
+		return title + "\n" + body, nil
+	}
+
+	return title + "\n\n" + body, nil
+}
+
+// parse a commit title or body template. Next to the builtin functions of
+// text/template, join(sep, list) is available.
+func ParseCommitTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).
+		Funcs(template.FuncMap{"join": func(sep string, s []string) string { return strings.Join(s, sep) }}).
+		Parse(text)
+}
+
+func renderTemplate(name, text, fallback string, data any) (string, error) {
+	if text == "" {
+		text = fallback
+	}
+
+	tpl, err := ParseCommitTemplate(name, text)
+	if err != nil {
+		return "", fmt.Errorf("parse commit %s template: %w", name, err)
+	}
+
+	var sb strings.Builder
+	if err := tpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("execute commit %s template: %w", name, err)
+	}
+
+	return sb.String(), nil
+}
+
+// keep only the first change of each repo, while keeping the order.
+func firstChangePerRepo(changes []krm.Change) []krm.Change {
+	seen := make(map[string]struct{}, len(changes))
+	out := make([]krm.Change, 0, len(changes))
+	for _, c := range changes {
+		if _, ok := seen[c.Repo]; ok {
 			continue
 		}
+		seen[c.Repo] = struct{}{}
+		out = append(out, c)
+	}
+	return out
+}
 
-		if _, err := msg.WriteString(fmt.Sprintf(" * %s: %s\n", change.Repo, change.Description)); err != nil {
-			return "", fmt.Errorf("write change: %w", err)
+// remove identical changes, i.e. the same image updated twice in one file,
+// while keeping the order. The path within the file is ignored.
+func uniqueChanges(changes []krm.Change) []krm.Change {
+	seen := make(map[krm.Change]struct{}, len(changes))
+	out := make([]krm.Change, 0, len(changes))
+	for _, c := range changes {
+		key := c
+		key.Path = ""
+		if _, ok := seen[key]; ok {
+			continue
 		}
-
-		seen[change.Repo] = struct{}{}
+		seen[key] = struct{}{}
+		out = append(out, c)
 	}
-
-	return msg.String()[:msg.Len()-1], nil
+	return out
 }
 
 var _ Handler = KoboldHandler
 
-func PrintHandler(_ context.Context, _ string, g model.TaskGroup, _ HookRunner) ([]string, error) {
+func PrintHandler(_ context.Context, _ string, g model.TaskGroup) (Result, error) {
 	b, err := json.MarshalIndent(g, "", "  ")
 	if err != nil {
-		return nil, fmt.Errorf("marshal task group: %w", err)
+		return Result{}, fmt.Errorf("marshal task group: %w", err)
 	}
 
 	fmt.Println(string(b))
 
-	return nil, nil
+	return Result{}, nil
 }
 
 var _ Handler = PrintHandler
 
-func ThrowHandler(_ context.Context, _ string, _ model.TaskGroup, _ HookRunner) ([]string, error) {
-	return nil, fmt.Errorf("throw handler error")
+func ThrowHandler(_ context.Context, _ string, _ model.TaskGroup) (Result, error) {
+	return Result{}, fmt.Errorf("throw handler error")
 }
 
 var _ Handler = ThrowHandler
@@ -4,10 +4,13 @@ import (
 	"testing"
 
 	"github.com/bluebrown/kobold/krm"
+	"github.com/bluebrown/kobold/store/model"
+	"github.com/volatiletech/null/v8"
 )
 
 func TestGetCommitMessage(t *testing.T) {
 	type args struct {
+		group   model.TaskGroup
 		changes []krm.Change
 	}
 	tests := []struct {
@@ -63,10 +66,109 @@ func TestGetCommitMessage(t *testing.T) {
 			want:    "chore(kobold): Update image refs\n * busybox: busybox:1.0.0 -> busybox:1.0.1",
 			wantErr: false,
 		},
+		{
+			name: "same image twice in one file",
+			args: args{
+				changes: []krm.Change{
+					{
+						Description: "busybox:1.0.0 -> busybox:1.0.1",
+						Repo:        "busybox",
+						File:        "pod.yaml",
+						Path:        "spec.containers[0].image",
+					},
+					{
+						Description: "busybox:1.0.0 -> busybox:1.0.1",
+						Repo:        "busybox",
+						File:        "pod.yaml",
+						Path:        "spec.initContainers[0].image",
+					},
+				},
+			},
+			want:    "chore(kobold): Update image refs\n * busybox: busybox:1.0.0 -> busybox:1.0.1",
+			wantErr: false,
+		},
+		{
+			name: "same image in different files is listed once",
+			args: args{
+				changes: []krm.Change{
+					{
+						Description: "busybox:1.0.0 -> busybox:1.0.1",
+						Repo:        "busybox",
+						File:        "stage/pod.yaml",
+					},
+					{
+						Description: "busybox:1.0.0 -> busybox:1.0.1",
+						Repo:        "busybox",
+						File:        "prod/pod.yaml",
+					},
+				},
+			},
+			want:    "chore(kobold): Update image refs\n * busybox: busybox:1.0.0 -> busybox:1.0.1",
+			wantErr: false,
+		},
+		{
+			name: "custom title with default body",
+			args: args{
+				group: model.TaskGroup{
+					CommitTitle: null.StringFrom("chore: bump images"),
+				},
+				changes: []krm.Change{
+					{Description: "busybox:1.0.0 -> busybox:1.0.1", Repo: "busybox", File: "stage/pod.yaml"},
+					{Description: "busybox:1.0.0 -> busybox:1.0.1", Repo: "busybox", File: "prod/pod.yaml"},
+				},
+			},
+			want:    "chore: bump images\n\n * busybox: busybox:1.0.0 -> busybox:1.0.1",
+			wantErr: false,
+		},
+		{
+			name: "no changes",
+			want: "chore(kobold): Update image refs",
+		},
+		{
+			name: "custom template with trailers",
+			args: args{
+				group: model.TaskGroup{
+					Fingerprint:  "abc",
+					PipelineName: null.StringFrom("stage"),
+					TaskIds:      []string{"1", "2"},
+					CommitTitle:  null.StringFrom("chore({{ .Pipeline }}): bump {{ len .Changes }} image(s) [skip ci]"),
+					CommitBody:   null.StringFrom("{{ range .Changes }}- {{ .Registry }}/{{ .Repo }}\n{{ end }}\nKobold-Run: {{ .Fingerprint }}\nKobold-Tasks: {{ join \",\" .TaskIDs }}"),
+				},
+				changes: []krm.Change{
+					{
+						Description: "busybox:1.0.0 -> busybox:1.0.1",
+						Registry:    "index.docker.io",
+						Repo:        "library/busybox",
+					},
+				},
+			},
+			want:    "chore(stage): bump 1 image(s) [skip ci]\n\n- index.docker.io/library/busybox\n\nKobold-Run: abc\nKobold-Tasks: 1,2",
+			wantErr: false,
+		},
+		{
+			name: "multi line title",
+			args: args{
+				group: model.TaskGroup{
+					CommitTitle: null.StringFrom("one\ntwo"),
+				},
+				changes: []krm.Change{{Description: "a -> b", Repo: "a"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid template",
+			args: args{
+				group: model.TaskGroup{
+					CommitBody: null.StringFrom("{{ .Nope }}"),
+				},
+				changes: []krm.Change{{Description: "a -> b", Repo: "a"}},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := commitMessage(tt.args.changes)
+			got, err := commitMessage(tt.args.group, tt.args.changes)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetCommitMessage() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -14,6 +14,10 @@ var (
 		Name: "kobold_run_status_total",
 		Help: "run status (task groups)",
 	}, []string{"status", "repo"})
+	metricHookStatus = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kobold_hook_status_total",
+		Help: "post hook status (attempts)",
+	}, []string{"status", "repo"})
 	metricMsgRecv = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "kobold_msg_recv_total",
 		Help: "number of messages received",
@@ -22,6 +26,10 @@ var (
 		Name: "kobold_git_fetch_total",
 		Help: "number of git fetches",
 	}, []string{"repo"})
+	metricGitCacheSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kobold_git_cache_size_bytes",
+		Help: "disk size of cached git repos",
+	}, []string{"repo"})
 	metricGitPush = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "kobold_git_push_total",
 		Help: "number of git pushes",
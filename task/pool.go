@@ -8,12 +8,15 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/bluebrown/kobold/git"
+	"github.com/bluebrown/kobold/krm"
 	"github.com/bluebrown/kobold/plugin"
+	"github.com/bluebrown/kobold/scm"
 	"github.com/bluebrown/kobold/store"
 	"github.com/bluebrown/kobold/store/model"
 	"github.com/google/go-containerregistry/pkg/name"
@@ -42,6 +45,7 @@ type Pool struct {
 	cancel     context.CancelFunc
 	size       int
 	cache      *git.RepoCache
+	limits     plugin.Limits
 }
 
 func NewPool(ctx context.Context, size int, queries *model.Queries) *Pool {
@@ -52,6 +56,7 @@ func NewPool(ctx context.Context, size int, queries *model.Queries) *Pool {
 
 	cache := git.NewRepoCache("kobold")
 	cache.SetCounter(metricGitFetch)
+	cache.SetSizeGauge(metricGitCacheSize)
 
 	return &Pool{
 		ctx:        ectx,
@@ -63,6 +68,7 @@ func NewPool(ctx context.Context, size int, queries *model.Queries) *Pool {
 		hookRunner: plugin.NewPostHookRunner(),
 		size:       size,
 		cache:      cache,
+		limits:     plugin.DefaultLimits,
 	}
 }
 
@@ -70,6 +76,33 @@ func (p *Pool) SetHandler(h Handler) {
 	p.handler = h
 }
 
+// set the runner of the starlark decoders. It defaults to the plugin runner.
+func (p *Pool) SetDecoderRunner(d DecoderRunner) {
+	p.decoder = d
+}
+
+// set the runner of the starlark post hooks. It defaults to the plugin runner.
+func (p *Pool) SetHookRunner(h HookRunner) {
+	p.hookRunner = h
+}
+
+// set the execution limits of the decoders and hooks, run by the pool.
+func (p *Pool) SetScriptLimits(l plugin.Limits) {
+	p.limits = l
+}
+
+// the context, the scripts of the pool run with. It carries their limits, and
+// the library modules they may load.
+func (p *Pool) scriptContext(ctx context.Context) context.Context {
+	return plugin.WithLibraries(plugin.WithLimits(ctx, p.limits), p.queries.LibraryGet)
+}
+
+// the repo cache used by the pool. It can be used to configure the cache,
+// before the first dispatch, or to inspect its content.
+func (p *Pool) Cache() *git.RepoCache {
+	return p.cache
+}
+
 // dispatch pending tasks. Will block until all task groups have been dispatched.
 func (p *Pool) Dispatch() error {
 	if err := p.ctx.Err(); err != nil {
@@ -81,12 +114,59 @@ func (p *Pool) Dispatch() error {
 		return err
 	}
 
-	// Fill the cache with all repos that are part of this dispatch call.
-	uris := make([]git.PackageURI, 0, len(taskGroups))
+	// Drop repos from the cache, that are no longer used by any pipeline.
+	pipelineURIs, err := p.queries.PipelineRepoList(p.ctx)
+	if err != nil {
+		return err
+	}
+
+	repos := make([]string, 0, len(pipelineURIs))
+	for _, uri := range pipelineURIs {
+		repos = append(repos, uri.Repo)
+	}
+
+	if err := p.cache.Retain(repos...); err != nil {
+		slog.WarnContext(p.ctx, "retain cache", "error", err)
+	}
+
+	// Fill the cache with only the repos and refs that are part of this
+	// dispatch call. Each repo is fetched with the credential of its pipeline.
+	// The config ensures, that all pipelines of a repo use the same one.
+	// Groups whose credential or identity cannot be resolved, fail without
+	// being handled.
+	var (
+		uris       = make([]git.PackageURI, 0, len(taskGroups))
+		auths      = make(map[string]*git.Auth, len(taskGroups))
+		identities = make(map[string]*git.Identity, len(taskGroups))
+		groupErrs  = make(map[string]error)
+	)
+
 	for _, g := range taskGroups {
+		auth, err := p.auth(p.ctx, g)
+		if errors.Is(err, sql.ErrNoRows) {
+			groupErrs[g.Fingerprint] = fmt.Errorf("credential %q not found", g.CredentialName.String)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		identity, err := p.identity(p.ctx, g)
+		if errors.Is(err, sql.ErrNoRows) {
+			groupErrs[g.Fingerprint] = fmt.Errorf("identity %q not found", g.IdentityName.String)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		auths[g.Fingerprint] = auth
+		identities[g.Fingerprint] = identity
+		p.cache.SetAuth(g.RepoUri.Repo, auth)
 		uris = append(uris, g.RepoUri)
 	}
 
+	// A repo that fails to fetch, does not stop the dispatch. Only the task
+	// groups of that repo fail, since the cache returns the fetch error of
+	// their repo, when they request it.
 	if err := p.cache.Fill(p.ctx, p.size, uris...); err != nil {
 		slog.WarnContext(p.ctx, "fill cache", "error", err)
 	}
@@ -98,7 +178,9 @@ func (p *Pool) Dispatch() error {
 
 	go func() {
 		wg.Wait()
-		if err := p.cache.Purge(ns); err != nil {
+		// Purge even if the pool has been canceled in the meantime, so that
+		// worktrees are not left behind.
+		if err := p.cache.Purge(context.WithoutCancel(p.ctx), ns); err != nil {
 			slog.WarnContext(p.ctx, "purge cache", "error", err)
 		}
 	}()
@@ -144,18 +226,24 @@ func (p *Pool) Dispatch() error {
 			var (
 				status = StatusSuccess
 				reason string
-				warns  []string
+				res    Result
 			)
 
-			if path, err := p.cache.Get(p.ctx, ns, g.RepoUri.Repo); err == nil && p.handler != nil {
-				warns, err = p.handler(p.ctx, path, g, p.hookRunner)
+			if err := groupErrs[g.Fingerprint]; err != nil {
+				status = StatusFailure
+				reason = err.Error()
+				slog.WarnContext(p.ctx, "config error", "fingerprint", g.Fingerprint, "error", err)
+			} else if path, err := p.cache.Get(p.ctx, ns, g.RepoUri); err == nil && p.handler != nil {
+				ctx := git.WithIdentity(git.WithAuth(p.ctx, auths[g.Fingerprint]), identities[g.Fingerprint])
+				ctx = p.scriptContext(ctx)
+				res, err = p.handler(ctx, path, g)
 				if err != nil {
 					status = StatusFailure
 					reason = err.Error()
 					slog.WarnContext(p.ctx, "handler error", "fingerprint", g.Fingerprint, "error", err)
 				}
-				if len(warns) > 0 {
-					slog.WarnContext(p.ctx, "handler warnings", "fingerprint", g.Fingerprint, "warnings", warns)
+				if len(res.Warnings) > 0 {
+					slog.WarnContext(p.ctx, "handler warnings", "fingerprint", g.Fingerprint, "warnings", res.Warnings)
 				}
 			} else if err != nil {
 				status = StatusFailure
@@ -163,13 +251,33 @@ func (p *Pool) Dispatch() error {
 				slog.WarnContext(p.ctx, "cache error", "fingerprint", g.Fingerprint, "error", err)
 			}
 
+			// The pull request and post hooks run, if changes have been pushed,
+			// or the run failed. They are a separate stage, so that a failing
+			// hook does not fail the push, and can be retried without pushing
+			// again.
+			hooks, err := p.queries.PipelinePostHookList(p.ctx, g.PipelineName.String)
+			if err != nil {
+				return err
+			}
+
+			var hookStatus null.String
+			if hookPending(status, len(res.Changes) > 0, g.PrProvider.Valid, hooks) {
+				hookStatus = null.StringFrom(string(StatusPending))
+			}
+
 			swapped, err = p.queries.TaskGroupsStatusCompSwap(p.ctx, model.TaskGroupsStatusCompSwapParams{
-				TaskGroupFingerprint: null.NewString(g.Fingerprint, true),
-				Ids:                  ids,
-				ReqStatus:            string(StatusRunning),
-				Status:               string(status),
-				FailureReason:        null.NewString(reason, reason != ""),
-				Warnings:             store.FlatList(warns),
+				TaskGroupFingerprint:  null.NewString(g.Fingerprint, true),
+				Ids:                   ids,
+				ReqStatus:             string(StatusRunning),
+				Status:                string(status),
+				FailureReason:         null.NewString(reason, reason != ""),
+				Warnings:              store.FlatList(res.Warnings),
+				SigningKeyFingerprint: null.NewString(res.SigningKeyFingerprint, res.SigningKeyFingerprint != ""),
+				CommitSha:             null.NewString(res.CommitSHA, res.CommitSHA != ""),
+				PushedBranch:          null.NewString(res.Branch, res.Branch != ""),
+				CommitMsg:             null.NewString(res.Message, res.Message != ""),
+				Changes:               store.ChangeList(res.Changes),
+				HookStatus:            hookStatus,
 			})
 
 			slog.InfoContext(p.ctx, "task group done", "fingerprint", g.Fingerprint, "status", status)
@@ -185,6 +293,23 @@ func (p *Pool) Dispatch() error {
 					StatusRunning, status, swapped, ids)
 			}
 
+			if hookStatus.Valid {
+				if res.Branch != "" {
+					g.DestBranch = null.StringFrom(res.Branch)
+				}
+				in := hookInput{
+					msg:       res.Message,
+					commitSHA: res.CommitSHA,
+					changes:   res.Changes,
+					warnings:  res.Warnings,
+					status:    status,
+					reason:    reason,
+				}
+				if err := p.runHook(p.ctx, g, hooks, in, StatusPending); err != nil {
+					return err
+				}
+			}
+
 			// Since we used a named return value, to capture the error, make
 			// sure we return nil here, so that no error is returned.
 			return nil
@@ -194,6 +319,385 @@ func (p *Pool) Dispatch() error {
 	return nil
 }
 
+var ErrHookNotRetryable = fmt.Errorf("hook not retryable")
+
+const (
+	// the on condition of a post hook, that runs regardless of the status.
+	hookOnAlways = "always"
+	// the name of the native pull request in the hook results.
+	hookPullRequest = "pull_request"
+	// the status of a post hook, whose on condition did not match.
+	hookSkipped = "skipped"
+)
+
+// the input of the hook stage of a run. It is recorded on the run, so that the
+// hooks can be retried. The outputs and results are those of a previous
+// attempt.
+type hookInput struct {
+	msg       string
+	commitSHA string
+	changes   []krm.Change
+	warnings  []string
+	status    Status
+	reason    string
+	outputs   map[string]string
+	results   store.HookResults
+}
+
+// whether the hook stage of a run is pending. Successful runs only have a hook
+// stage, if they pushed changes. The native pull request runs on success.
+func hookPending(status Status, pushed, pr bool, hooks []model.PipelinePostHookListRow) bool {
+	if status == StatusSuccess && !pushed {
+		return false
+	}
+
+	if status == StatusSuccess && pr {
+		return true
+	}
+
+	for _, h := range hooks {
+		if h.RunOn == hookOnAlways || h.RunOn == string(status) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// run the pull request and post hooks of a run, as its own stage. The hook
+// status is swapped from req to running first, so that the hooks are never run
+// twice at the same time. Only database errors are returned, or
+// ErrHookNotRetryable, if the hook status did not match req.
+//
+// The hooks run as chain, in order, starting with the native pull request. A
+// hook runs, if its on condition matches the status of the chain, which is
+// the status of the run, until a hook fails. From then on, it is failure, so
+// that the remaining success hooks are skipped, while failure and always
+// hooks still run. The result of each hook is recorded on the run, and the
+// hook stage fails, if any hook failed. Hooks that succeeded in a previous
+// attempt of the same chain, are not run again.
+func (p *Pool) runHook(ctx context.Context, g model.TaskGroup, hooks []model.PipelinePostHookListRow, in hookInput, req Status) error {
+	fingerprint := null.StringFrom(g.Fingerprint)
+
+	swapped, err := p.queries.RunHookStatusCompSwap(ctx, model.RunHookStatusCompSwapParams{
+		HookStatus:    null.StringFrom(string(StatusRunning)),
+		HookOutputs:   store.FlatMap(in.outputs),
+		HookResults:   in.results,
+		Fingerprint:   fingerprint,
+		ReqHookStatus: null.StringFrom(string(req)),
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(swapped) == 0 {
+		return fmt.Errorf("%w: run %q has no %q hook", ErrHookNotRetryable, g.Fingerprint, req)
+	}
+
+	chain := plugin.ChainState{Status: string(in.status), Error: in.reason, Outputs: in.outputs}
+	if chain.Outputs == nil {
+		chain.Outputs = make(map[string]string)
+	}
+
+	// the hooks of the chain, in order.
+	type link struct {
+		name, on string
+		run      func() (map[string]string, error)
+	}
+
+	var links []link
+
+	if g.PrProvider.Valid {
+		links = append(links, link{hookPullRequest, string(StatusSuccess), func() (map[string]string, error) {
+			// The pull request may have been created in a previous attempt,
+			// even if setting its options failed. It is not opened again.
+			if chain.Outputs["pr_url"] != "" {
+				return nil, nil
+			}
+			created, err := p.pullRequest(ctx, g, in.msg)
+			if created.URL == "" {
+				return nil, err
+			}
+			slog.InfoContext(ctx, "pull request created", "fingerprint", g.Fingerprint, "url", created.URL)
+			return map[string]string{"pr_url": created.URL, "pr_number": strconv.Itoa(created.Number)}, err
+		}})
+	}
+
+	for _, h := range hooks {
+		h := h
+		links = append(links, link{h.PostHookName, h.RunOn, func() (map[string]string, error) {
+			run := plugin.Run{Message: in.msg, CommitSHA: in.commitSHA, Changes: in.changes, Warnings: in.warnings}
+			if native, ok := plugin.LookupPostHook(h.PostHookName); ok {
+				g.PostHookArgs = h.Args
+				return native(p.scriptContext(ctx), g, run, chain)
+			}
+			if h.Script == nil {
+				return nil, fmt.Errorf("post hook %q not found", h.PostHookName)
+			}
+			g.PostHook, g.PostHookArgs = h.Script, h.Args
+			g.PostHookEnv, g.PostHookSecrets, g.PostHookHosts = h.Env, h.Secrets, h.Hosts
+			return p.hookRunner.Run(p.scriptContext(ctx), g, run, chain)
+		}})
+	}
+
+	// The results of a previous attempt are only kept, if they belong to the
+	// same chain, by position, name and on condition. Otherwise, the chain
+	// has changed since, and all hooks run again.
+	prev := in.results
+	if len(prev) != len(links) {
+		prev = nil
+	}
+	for i, l := range links {
+		if prev != nil && (prev[i].Position != i || prev[i].Name != l.name || prev[i].On != l.on) {
+			prev = nil
+		}
+	}
+	if prev == nil && len(in.results) > 0 {
+		slog.InfoContext(ctx, "hook chain changed", "fingerprint", g.Fingerprint)
+	}
+
+	var (
+		results store.HookResults
+		errs    []string
+	)
+
+	for i, l := range links {
+		if prev != nil && prev[i].Status == string(StatusSuccess) {
+			results = append(results, prev[i])
+			continue
+		}
+
+		if l.on != hookOnAlways && l.on != chain.Status {
+			results = append(results, store.HookResult{Position: i, Name: l.name, On: l.on, Status: hookSkipped})
+			continue
+		}
+
+		outputs, err := l.run()
+		for k, v := range outputs {
+			chain.Outputs[k] = v
+		}
+
+		r := store.HookResult{Position: i, Name: l.name, On: l.on, Status: string(StatusSuccess), Outputs: outputs}
+		if err != nil {
+			r.Status, r.Error = string(StatusFailure), err.Error()
+			errs = append(errs, fmt.Sprintf("%s: %v", l.name, err))
+			if chain.Status == string(StatusSuccess) {
+				chain.Status, chain.Error = string(StatusFailure), errs[len(errs)-1]
+			}
+			slog.WarnContext(ctx, "hook error", "fingerprint", g.Fingerprint, "hook", l.name, "error", err)
+		}
+
+		results = append(results, r)
+	}
+
+	status := StatusSuccess
+	if len(errs) > 0 {
+		status = StatusFailure
+	}
+
+	reason := strings.Join(errs, "; ")
+
+	// The status is written, even if ctx has been cancelled meanwhile, since
+	// a run left in running, can never be retried.
+	_, err = p.queries.RunHookStatusCompSwap(context.WithoutCancel(ctx), model.RunHookStatusCompSwapParams{
+		HookStatus:    null.StringFrom(string(status)),
+		HookError:     null.NewString(reason, reason != ""),
+		HookOutputs:   store.FlatMap(chain.Outputs),
+		HookResults:   results,
+		Attempts:      1,
+		Fingerprint:   fingerprint,
+		ReqHookStatus: null.StringFrom(string(StatusRunning)),
+	})
+
+	slog.InfoContext(ctx, "hook done", "fingerprint", g.Fingerprint, "status", status)
+	metricHookStatus.With(prometheus.Labels{"status": string(status), "repo": g.RepoUri.Repo}).Inc()
+
+	return err
+}
+
+// retry the failed hook stage of a run, without pushing again. The hooks are
+// run with the inputs recorded on the run, but with the current post hooks of
+// the pipeline, so that a broken script can be fixed before retrying.
+func (p *Pool) RetryHook(ctx context.Context, fingerprint string) error {
+	r, err := p.hookRetry(ctx, fingerprint)
+	if err != nil {
+		return err
+	}
+	return p.runHook(ctx, r.g, r.hooks, r.in, StatusFailure)
+}
+
+// the hook stage of a run, to retry.
+type hookRetry struct {
+	g     model.TaskGroup
+	hooks []model.PipelinePostHookListRow
+	in    hookInput
+}
+
+// load the hook stage of a run, and check that it can be retried. Returns
+// ErrHookNotRetryable, if its hook did not fail, or it has no hooks anymore.
+func (p *Pool) hookRetry(ctx context.Context, fingerprint string) (hookRetry, error) {
+	h, err := p.queries.RunHookGet(ctx, null.StringFrom(fingerprint))
+	if err != nil {
+		return hookRetry{}, err
+	}
+
+	if h.HookStatus.String != string(StatusFailure) {
+		return hookRetry{}, fmt.Errorf("%w: run %q has hook status %q", ErrHookNotRetryable, fingerprint, h.HookStatus.String)
+	}
+
+	hooks, err := p.queries.PipelinePostHookList(ctx, h.PipelineName.String)
+	if err != nil {
+		return hookRetry{}, err
+	}
+
+	if len(hooks) == 0 && !h.PrProvider.Valid {
+		return hookRetry{}, fmt.Errorf("%w: post hooks of run %q no longer exist", ErrHookNotRetryable, fingerprint)
+	}
+
+	g := model.TaskGroup{
+		Fingerprint:      h.Fingerprint,
+		RepoUri:          h.RepoUri,
+		DestBranch:       h.PushedBranch,
+		CredentialName:   h.CredentialName,
+		PipelineName:     h.PipelineName,
+		PrProvider:       h.PrProvider,
+		PrApiUrl:         h.PrApiUrl,
+		PrCredentialName: h.PrCredentialName,
+		PrLabels:         h.PrLabels,
+		PrReviewers:      h.PrReviewers,
+		PrTeamReviewers:  h.PrTeamReviewers,
+		PrDraft:          h.PrDraft,
+		PrAutoMerge:      h.PrAutoMerge,
+		TaskIds:          h.TaskIds,
+		Events:           h.Events,
+	}
+
+	in := hookInput{
+		msg:       h.CommitMsg.String,
+		commitSHA: h.CommitSha.String,
+		changes:   h.Changes,
+		warnings:  h.Warnings,
+		status:    Status(h.Status),
+		reason:    h.FailureReason.String,
+		outputs:   h.HookOutputs,
+		results:   h.HookResults,
+	}
+
+	return hookRetry{g, hooks, in}, nil
+}
+
+// run the hooks of a retry on a worker of the pool. Blocks, until a worker is
+// available. A retry that is no longer retryable, i.e. since it has been run
+// by an earlier request meanwhile, is dropped, without stopping the pool.
+func (p *Pool) dispatchHookRetry(r hookRetry) {
+	p.group.Go(func() error {
+		err := p.runHook(p.ctx, r.g, r.hooks, r.in, StatusFailure)
+		if errors.Is(err, ErrHookNotRetryable) {
+			slog.WarnContext(p.ctx, "hook retry dropped", "fingerprint", r.g.Fingerprint, "error", err)
+			return nil
+		}
+		return err
+	})
+}
+
+// open a pull request from the pushed branch of the group into the ref of its
+// repo uri, using the native scm provider of its pipeline. The password file
+// of the pr credential, or else the credential of the group, is the api token.
+func (p *Pool) pullRequest(ctx context.Context, g model.TaskGroup, msg string) (scm.Created, error) {
+	repo, err := scm.ParseRepo(g.RepoUri.Repo)
+	if err != nil {
+		return scm.Created{}, err
+	}
+
+	cfg := scm.Config{Provider: g.PrProvider.String, APIURL: g.PrApiUrl.String}
+
+	credential := g.PrCredentialName
+	if !credential.Valid {
+		credential = g.CredentialName
+	}
+
+	if credential.Valid {
+		c, err := p.queries.CredentialGet(ctx, credential.String)
+		if errors.Is(err, sql.ErrNoRows) {
+			return scm.Created{}, fmt.Errorf("credential %q not found", credential.String)
+		}
+		if err != nil {
+			return scm.Created{}, err
+		}
+		if c.PasswordFile.Valid {
+			b, err := os.ReadFile(c.PasswordFile.String)
+			if err != nil {
+				return scm.Created{}, fmt.Errorf("read token: %w", err)
+			}
+			cfg.Username = c.Username.String
+			cfg.Token = strings.TrimSpace(string(b))
+		}
+	}
+
+	provider, err := scm.New(cfg)
+	if err != nil {
+		return scm.Created{}, err
+	}
+
+	title, body, _ := strings.Cut(msg, "\n")
+
+	return provider.CreatePullRequest(ctx, repo, scm.PullRequest{
+		Title: title,
+		Body:  strings.TrimSpace(body),
+		Head:  g.DestBranch.String,
+		Base:  g.RepoUri.Ref,
+		Options: scm.Options{
+			Labels:        g.PrLabels,
+			Reviewers:     g.PrReviewers,
+			TeamReviewers: g.PrTeamReviewers,
+			Draft:         g.PrDraft.Bool,
+			AutoMerge:     g.PrAutoMerge.String,
+		},
+	})
+}
+
+// resolve the git auth of the task group. Returns nil, if the group does not
+// reference a credential.
+func (p *Pool) auth(ctx context.Context, g model.TaskGroup) (*git.Auth, error) {
+	if !g.CredentialName.Valid {
+		return nil, nil
+	}
+
+	c, err := p.queries.CredentialGet(ctx, g.CredentialName.String)
+	if err != nil {
+		return nil, err
+	}
+
+	return &git.Auth{
+		SSHKeyFile:        c.SshKeyFile.String,
+		SSHKnownHostsFile: c.SshKnownHostsFile.String,
+		Username:          c.Username.String,
+		PasswordFile:      c.PasswordFile.String,
+	}, nil
+}
+
+// resolve the git identity of the task group. Returns nil, if the group does
+// not reference an identity.
+func (p *Pool) identity(ctx context.Context, g model.TaskGroup) (*git.Identity, error) {
+	if !g.IdentityName.Valid {
+		return nil, nil
+	}
+
+	i, err := p.queries.IdentityGet(ctx, g.IdentityName.String)
+	if err != nil {
+		return nil, err
+	}
+
+	return &git.Identity{
+		AuthorName:     i.AuthorName.String,
+		AuthorEmail:    i.AuthorEmail.String,
+		CommitterName:  i.CommitterName.String,
+		CommitterEmail: i.CommitterEmail.String,
+		SigningFormat:  i.SigningFormat.String,
+		SigningKeyFile: i.SigningKeyFile.String,
+	}, nil
+}
+
 func (p *Pool) Done() <-chan struct{} {
 	return p.ctx.Done()
 }
@@ -211,13 +715,17 @@ var (
 	ErrNotDecodable    = fmt.Errorf("not decodable")
 )
 
-func (p *Pool) Queue(ctx context.Context, channel string, msg []byte) (err error) {
-	var dec []byte
+func (p *Pool) Queue(ctx context.Context, channel string, msg []byte, src plugin.Source) (err error) {
+	var (
+		dec     model.ChannelDecoderGetRow
+		skipped int
+	)
 
 	defer func() {
 		slog.InfoContext(ctx, "task queued",
 			"channel", channel,
-			"dec", len(dec) == 0,
+			"dec", len(dec.Script) == 0,
+			"skipped", skipped,
 			"error", err)
 
 		metricMsgRecv.With(prometheus.Labels{
@@ -236,27 +744,53 @@ func (p *Pool) Queue(ctx context.Context, channel string, msg []byte) (err error
 		return errors.Join(err, ErrNotDecodable)
 	}
 
-	var refs []string
+	var decoded []store.Event
 
-	if dec == nil {
-		refs = strings.Split(string(msg), "\n")
-	} else {
-		refs, err = p.decoder.Decode(channel, dec, msg)
+	// Native decoders are looked up by name, since they have no script.
+	switch native, ok := plugin.LookupDecoder(dec.DecoderName.String); {
+	case ok:
+		decoded, err = native(p.scriptContext(ctx), msg, src, dec.DecoderArgs)
+		if err != nil {
+			return errors.Join(ErrNotDecodable, err)
+		}
+	case plugin.IsNative(dec.DecoderName.String):
+		return fmt.Errorf("%w: decoder %q is not registered", ErrNotDecodable, dec.DecoderName.String)
+	case dec.Script == nil:
+		for _, ref := range strings.Split(string(msg), "\n") {
+			decoded = append(decoded, store.Event{Ref: ref, Action: store.ActionPush})
+		}
+	default:
+		decoded, err = p.decoder.Decode(p.scriptContext(ctx), channel, dec.Script, msg, src, dec.DecoderArgs,
+			plugin.HostEnv{Env: dec.Env, Secrets: dec.Secrets, Hosts: dec.Hosts})
 		if err != nil {
 			return errors.Join(ErrNotDecodable, err)
 		}
 	}
 
-	for i := range refs {
-		if r, err := name.ParseReference(refs[i]); err == nil {
+	// Only pushed images are updated. Other events, such as deletes, are
+	// skipped.
+	var events []store.Event
+
+	for _, e := range decoded {
+		if e.Action != store.ActionPush {
+			skipped++
+			continue
+		}
+		events = append(events, e)
+		if r, err := name.ParseReference(e.Ref); err == nil {
 			metricImageSeen.With(prometheus.Labels{"ref": fmt.Sprintf("%s/%s",
 				r.Context().RegistryStr(), r.Context().RepositoryStr())}).Inc()
 		}
 	}
 
+	if len(events) == 0 {
+		return nil
+	}
+
+	// The events are filtered by the label selector of each subscription.
 	_, err = p.queries.TasksAppend(ctx, model.TasksAppendParams{
-		Msgs: store.FlatList(refs),
-		Name: channel,
+		Events: store.EventList(events),
+		Name:   channel,
 	})
 
 	return err
@@ -265,7 +799,7 @@ func (p *Pool) Queue(ctx context.Context, channel string, msg []byte) (err error
 func (p *Pool) QueueReader(ctx context.Context, channel string, r io.Reader) error {
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
-		if err := p.Queue(ctx, channel, scanner.Bytes()); err != nil {
+		if err := p.Queue(ctx, channel, scanner.Bytes(), plugin.Source{}); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,391 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bluebrown/kobold/git"
+	"github.com/bluebrown/kobold/plugin"
+	"github.com/bluebrown/kobold/store"
+	"github.com/bluebrown/kobold/store/model"
+	"github.com/bluebrown/kobold/store/schema"
+	null "github.com/volatiletech/null/v8"
+)
+
+// fakeHooks runs the hooks by script. A script that is not in the map fails.
+type fakeHooks struct {
+	outputs map[string]map[string]string
+	calls   []string
+	runs    []plugin.Run
+}
+
+func (f *fakeHooks) Run(_ context.Context, g model.TaskGroup, run plugin.Run, state plugin.ChainState) (map[string]string, error) {
+	f.calls = append(f.calls, string(g.PostHook)+":"+state.Status)
+	f.runs = append(f.runs, run)
+	if out, ok := f.outputs[string(g.PostHook)]; ok {
+		return out, nil
+	}
+	return nil, fmt.Errorf("boom")
+}
+
+func init() {
+	store.MustMakeUUID()
+	store.MustMakeSha1()
+
+	plugin.RegisterPostHook("go.test-audit@v1", func(_ context.Context, g model.TaskGroup, _ plugin.Run, state plugin.ChainState) (map[string]string, error) {
+		return map[string]string{"audited": fmt.Sprintf("%s:%v", state.Status, g.PostHookArgs["level"])}, nil
+	})
+	plugin.RegisterDecoder("go.test-csv@v1", func(_ context.Context, data []byte, _ plugin.Source, args map[string]any) ([]store.Event, error) {
+		var events []store.Event
+		for _, ref := range strings.Split(string(data), ",") {
+			events = append(events, store.Event{Ref: fmt.Sprint(args["prefix"]) + ref, Action: store.ActionPush})
+		}
+		return events, nil
+	})
+}
+
+// newTestDB opens an in memory database with the task and read schema
+func newTestDB(t *testing.T) (*sql.DB, *model.Queries) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+
+	for _, s := range [][]byte{schema.TaskSchema, schema.ReadSchema} {
+		if _, err := db.Exec(string(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return db, model.New(db)
+}
+
+func TestPool_RetryHook(t *testing.T) {
+	ctx := context.Background()
+
+	db, q := newTestDB(t)
+
+	for i, h := range []struct{ name, on string }{
+		{"pr", "success"},
+		{"fail", "success"},
+		{"deploy", "success"},
+		{"notify", "failure"},
+		{"audit", "always"},
+		{"go.test-audit@v1", "always"},
+	} {
+		if !plugin.IsNative(h.name) {
+			if err := q.PostHookPut(ctx, model.PostHookPutParams{Name: h.name, Script: []byte(h.name)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := q.PipelinePostHookPut(ctx, model.PipelinePostHookPutParams{
+			PipelineName: "app",
+			Position:     int64(i),
+			PostHookName: h.name,
+			RunOn:        h.on,
+			Args:         store.Args{"level": "high"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the previous attempt, where the fail hook failed, so that deploy has been
+	// skipped, and notify has run.
+	prev := store.HookResults{
+		{Position: 0, Name: "pr", On: "success", Status: "success", Outputs: map[string]string{"pr_url": "u"}},
+		{Position: 1, Name: "fail", On: "success", Status: "failure", Error: "boom"},
+		{Position: 2, Name: "deploy", On: "success", Status: "skipped"},
+		{Position: 3, Name: "notify", On: "failure", Status: "success"},
+		{Position: 4, Name: "audit", On: "always", Status: "failure", Error: "boom"},
+		{Position: 5, Name: "go.test-audit@v1", On: "always", Status: "failure", Error: "boom"},
+	}
+
+	if _, err := db.ExecContext(ctx, `insert into task
+		(id, msgs, repo_uri, status, timestamp, task_group_fingerprint, pipeline_name, commit_sha, hook_status, hook_outputs, hook_results)
+		values ('t1', '[]', 'https://example.com/app.git?ref=main', 'success', datetime('now'), 'fp', 'app', 'abc', 'failure', ?, ?)`,
+		store.FlatMap{"pr_url": "u"}, prev); err != nil {
+		t.Fatal(err)
+	}
+
+	hooks := &fakeHooks{outputs: map[string]map[string]string{
+		"fail":   nil,
+		"deploy": {"deployed": "true"},
+		"audit":  nil,
+	}}
+
+	p := &Pool{queries: q, hookRunner: hooks}
+	if err := p.RetryHook(ctx, "fp"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hooks that succeeded before, are not run again. The chain status is taken
+	// from the run, so that deploy runs now.
+	if want := []string{"fail:success", "deploy:success", "audit:success"}; !reflect.DeepEqual(hooks.calls, want) {
+		t.Errorf("calls = %v, want %v", hooks.calls, want)
+	}
+
+	for _, r := range hooks.runs {
+		if r.CommitSHA != "abc" {
+			t.Errorf("commit sha = %q, want abc", r.CommitSHA)
+		}
+	}
+
+	h, err := q.RunHookGet(ctx, null.StringFrom("fp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h.HookStatus.String != "success" {
+		t.Errorf("hook status = %q, want success", h.HookStatus.String)
+	}
+
+	var statuses []string
+	for _, r := range h.HookResults {
+		statuses = append(statuses, r.Name+":"+r.Status)
+	}
+
+	want := []string{"pr:success", "fail:success", "deploy:success", "notify:success", "audit:success", "go.test-audit@v1:success"}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("results = %v, want %v", statuses, want)
+	}
+
+	if got := h.HookOutputs["deployed"]; got != "true" {
+		t.Errorf("deployed output = %q, want true", got)
+	}
+
+	if got := h.HookOutputs["audited"]; got != "success:high" {
+		t.Errorf("audited output = %q, want success:high", got)
+	}
+
+	if err := p.RetryHook(ctx, "fp"); err == nil {
+		t.Error("expected retry of successful hook stage to fail")
+	}
+
+	// The results of a chain, that has changed since, are discarded, so that
+	// all hooks run again. Here, fail has been inserted before deploy.
+	changed := store.HookResults{prev[0], prev[2], prev[3], prev[4], prev[5]}
+	for i := range changed {
+		changed[i].Position, changed[i].Status = i, "success"
+	}
+	changed[4].Status = "failure"
+
+	if _, err := db.ExecContext(ctx, `update task set hook_status = 'failure', hook_results = ? where id = 't1'`, changed); err != nil {
+		t.Fatal(err)
+	}
+
+	hooks.calls = nil
+	hooks.outputs["pr"] = nil
+
+	if err := p.RetryHook(ctx, "fp"); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"pr:success", "fail:success", "deploy:success", "audit:success"}; !reflect.DeepEqual(hooks.calls, want) {
+		t.Errorf("calls of changed chain = %v, want %v", hooks.calls, want)
+	}
+}
+
+func TestPool_DispatchHookRetry(t *testing.T) {
+	ctx := context.Background()
+
+	db, q := newTestDB(t)
+
+	if err := q.PostHookPut(ctx, model.PostHookPutParams{Name: "deploy", Script: []byte("deploy")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.PipelinePostHookPut(ctx, model.PipelinePostHookPutParams{PipelineName: "app", PostHookName: "deploy", RunOn: "success"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.ExecContext(ctx, `insert into task
+		(id, msgs, repo_uri, status, timestamp, task_group_fingerprint, pipeline_name, hook_status)
+		values ('t1', '[]', 'https://example.com/app.git?ref=main', 'success', datetime('now'), 'fp', 'app', 'failure')`); err != nil {
+		t.Fatal(err)
+	}
+
+	hooks := &fakeHooks{outputs: map[string]map[string]string{"deploy": nil}}
+
+	p := NewPool(ctx, 1, q)
+	p.SetHookRunner(hooks)
+
+	// both retries are accepted, but only the first one runs, since the hook
+	// succeeded, once the second one gets a worker.
+	for i := 0; i < 2; i++ {
+		r, err := p.hookRetry(ctx, "fp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.dispatchHookRetry(r)
+	}
+
+	if err := p.Wait(); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	if want := []string{"deploy:success"}; !reflect.DeepEqual(hooks.calls, want) {
+		t.Errorf("calls = %v, want %v", hooks.calls, want)
+	}
+}
+
+func TestPool_QueueNative(t *testing.T) {
+	ctx := context.Background()
+
+	_, q := newTestDB(t)
+
+	for name, decoder := range map[string]string{"csv": "go.test-csv@v1", "missing": "go.test-missing@v1"} {
+		if err := q.ChannelPut(ctx, model.ChannelPutParams{
+			Name:        name,
+			DecoderName: null.StringFrom(decoder),
+			DecoderArgs: store.Args{"prefix": "docker.io/library/"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var uri git.PackageURI
+	uri.MustUnmarshalText("https://example.com/app.git?ref=main")
+
+	if err := q.PipelinePut(ctx, model.PipelinePutParams{Name: "app", RepoUri: uri}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.SubscriptionPut(ctx, model.SubscriptionPutParams{PipelineName: "app", ChannelName: "csv"}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Pool{queries: q}
+
+	if err := p.Queue(ctx, "csv", []byte("busybox:1.0,nginx:1.1"), plugin.Source{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := q.TaskList(ctx, model.TaskListParams{Status: []string{string(StatusPending)}, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tasks) != 1 {
+		t.Fatalf("tasks = %d, want 1", len(tasks))
+	}
+
+	want := store.FlatList{"docker.io/library/busybox:1.0", "docker.io/library/nginx:1.1"}
+	if !reflect.DeepEqual(tasks[0].Msgs, want) {
+		t.Errorf("msgs = %v, want %v", tasks[0].Msgs, want)
+	}
+
+	if err := p.Queue(ctx, "missing", []byte("busybox:1.0"), plugin.Source{}); !errors.Is(err, ErrNotDecodable) {
+		t.Errorf("queue with unregistered decoder: error = %v, want %v", err, ErrNotDecodable)
+	}
+}
+
+func TestPool_QueueLabelSelector(t *testing.T) {
+	ctx := context.Background()
+
+	_, q := newTestDB(t)
+
+	if err := q.DecoderPut(ctx, model.DecoderPutParams{Name: "arch", Script: []byte(`
+def main(input):
+    events = []
+    for line in input.split("\n"):
+        ref, arch = line.split(" ")
+        events.append({"ref": ref, "labels": {"arch": arch}})
+    return events
+`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.ChannelPut(ctx, model.ChannelPutParams{Name: "registry", DecoderName: null.StringFrom("arch")}); err != nil {
+		t.Fatal(err)
+	}
+
+	selectors := map[string]store.FlatMap{
+		"all":   nil,
+		"amd64": {"arch": "amd64"},
+		"linux": {"arch": "amd64", "os": "linux"},
+	}
+
+	for name, selector := range selectors {
+		var uri git.PackageURI
+		uri.MustUnmarshalText("https://example.com/" + name + ".git?ref=main")
+		if err := q.PipelinePut(ctx, model.PipelinePutParams{Name: name, RepoUri: uri}); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.SubscriptionPut(ctx, model.SubscriptionPutParams{PipelineName: name, ChannelName: "registry", LabelSelector: selector}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := &Pool{queries: q, decoder: plugin.NewDecoderRunner()}
+
+	if err := p.Queue(ctx, "registry", []byte("busybox:1.0 amd64\nbusybox:1.0 arm64"), plugin.Source{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := q.TaskList(ctx, model.TaskListParams{Status: []string{string(StatusPending)}, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]store.FlatList, len(tasks))
+	for _, task := range tasks {
+		got[task.PipelineName.String] = task.Msgs
+	}
+
+	want := map[string]store.FlatList{
+		"all":   {"busybox:1.0", "busybox:1.0"},
+		"amd64": {"busybox:1.0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("msgs by pipeline = %v, want %v", got, want)
+	}
+
+	for _, task := range tasks {
+		for _, e := range task.Events {
+			if sel := selectors[task.PipelineName.String]; sel != nil && e.Labels["arch"] != sel["arch"] {
+				t.Errorf("pipeline %q got event %v", task.PipelineName.String, e)
+			}
+		}
+	}
+}
+
+func TestHookPending(t *testing.T) {
+	t.Parallel()
+	onFailure := []model.PipelinePostHookListRow{{PostHookName: "notify", RunOn: "failure"}}
+	onSuccess := []model.PipelinePostHookListRow{{PostHookName: "pr", RunOn: "success"}}
+	onAlways := []model.PipelinePostHookListRow{{PostHookName: "audit", RunOn: "always"}}
+	tests := []struct {
+		name   string
+		status Status
+		pushed bool
+		pr     bool
+		hooks  []model.PipelinePostHookListRow
+		want   bool
+	}{
+		{name: "success pushed", status: StatusSuccess, pushed: true, hooks: onSuccess, want: true},
+		{name: "success not pushed", status: StatusSuccess, hooks: onAlways, want: false},
+		{name: "success native pr", status: StatusSuccess, pushed: true, pr: true, want: true},
+		{name: "success only failure hooks", status: StatusSuccess, pushed: true, hooks: onFailure, want: false},
+		{name: "failure", status: StatusFailure, hooks: onFailure, want: true},
+		{name: "failure always", status: StatusFailure, hooks: onAlways, want: true},
+		{name: "failure only success hooks", status: StatusFailure, pr: true, hooks: onSuccess, want: false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := hookPending(tt.status, tt.pushed, tt.pr, tt.hooks); got != tt.want {
+				t.Errorf("hookPending() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/bluebrown/kobold/git"
+	"github.com/bluebrown/kobold/plugin"
 	"github.com/bluebrown/kobold/store/model"
 )
 
@@ -17,6 +19,7 @@ import (
 // via the pool. New task resets the debounce interval.
 type Scheduler struct {
 	ingress chan *ingress
+	retries chan hookRetry
 	pool    *Pool
 }
 
@@ -25,6 +28,7 @@ func NewScheduler(ctx context.Context, q *model.Queries, size int) *Scheduler {
 		// Buffer incoming events to prevent blocking the caller,
 		// incase the scheduler is currently blocking on pool.Dispatch().
 		ingress: make(chan *ingress, 100),
+		retries: make(chan hookRetry, 100),
 		pool:    NewPool(ctx, size, q),
 	}
 }
@@ -33,6 +37,32 @@ func (s *Scheduler) SetHandler(h Handler) {
 	s.pool.SetHandler(h)
 }
 
+func (s *Scheduler) SetScriptLimits(l plugin.Limits) {
+	s.pool.SetScriptLimits(l)
+}
+
+func (s *Scheduler) Cache() *git.RepoCache {
+	return s.pool.Cache()
+}
+
+// queue the retry of the failed post hook of a run. The run is checked right
+// away, but its hooks run on the pool, once a worker is available, so that
+// retries are bound by the same limit as runs. See Pool.RetryHook.
+func (s *Scheduler) RetryHook(ctx context.Context, fingerprint string) error {
+	r, err := s.pool.hookRetry(ctx, fingerprint)
+	if err != nil {
+		return err
+	}
+	select {
+	case s.retries <- r:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.pool.Done():
+		return fmt.Errorf("trying to retry hook on stopped scheduler: %w", s.pool.ctx.Err())
+	}
+}
+
 // runs until error or the context passed to NewScheduler is canceled. Will
 // always wait for the pool to shutdown gracefully before returning.
 func (s *Scheduler) Run(debounce time.Duration) (err error) {
@@ -98,6 +128,9 @@ func (s *Scheduler) Run(debounce time.Duration) (err error) {
 
 			t.Reset(debounce)
 
+		case r := <-s.retries:
+			s.pool.dispatchHookRetry(r)
+
 		case <-t.C:
 			if err := s.pool.Dispatch(); err != nil {
 				return fmt.Errorf("s.pool.Dispatch(): %w", err)
@@ -110,16 +143,17 @@ func (s *Scheduler) Run(debounce time.Duration) (err error) {
 type ingress struct {
 	Channel string
 	Msg     []byte
+	Source  plugin.Source
 }
 
-func (s *Scheduler) Schedule(ctx context.Context, channel string, data []byte) error {
+func (s *Scheduler) Schedule(ctx context.Context, channel string, data []byte, src plugin.Source) error {
 	if err := ctx.Err(); err != nil {
 		return fmt.Errorf("trying to schedule event on canceled context: %w", err)
 	}
-	s.ingress <- &ingress{Channel: channel, Msg: data}
+	s.ingress <- &ingress{Channel: channel, Msg: data, Source: src}
 	return nil
 }
 
 func (s *Scheduler) schedule(e *ingress) error {
-	return s.pool.Queue(s.pool.ctx, e.Channel, e.Msg)
+	return s.pool.Queue(s.pool.ctx, e.Channel, e.Msg, e.Source)
 }
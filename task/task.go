@@ -3,8 +3,11 @@ package task
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/bluebrown/kobold/krm"
+	"github.com/bluebrown/kobold/plugin"
+	"github.com/bluebrown/kobold/store"
 	"github.com/bluebrown/kobold/store/model"
 )
 
@@ -18,29 +21,70 @@ const (
 )
 
 type DecoderRunner interface {
-	Decode(name string, script []byte, data []byte) ([]string, error)
+	Decode(ctx context.Context, name string, script []byte, data []byte, src plugin.Source, args map[string]any, env plugin.HostEnv) ([]store.Event, error)
 }
 
 type HookRunner interface {
-	Run(group model.TaskGroup, msg string, changes []krm.Change, warnings []string) error
+	Run(ctx context.Context, group model.TaskGroup, run plugin.Run, state plugin.ChainState) (map[string]string, error)
 }
 
-type Handler func(ctx context.Context, hostPath string, g model.TaskGroup, hook HookRunner) ([]string, error)
+// the result of a handler is recorded on the tasks of its group, even if the
+// handler returned an error.
+type Result struct {
+	Warnings []string
+	// the fingerprint of the key, the commit has been signed with, if any.
+	SigningKeyFingerprint string
+	// the sha of the pushed commit and the branch it has been pushed to.
+	CommitSHA string
+	Branch    string
+	// the commit message and changes are passed to the post hook, which runs
+	// after the handler, if changes have been pushed.
+	Message string
+	Changes []krm.Change
+}
+
+type Handler func(ctx context.Context, hostPath string, g model.TaskGroup) (Result, error)
 
 func (t *Handler) String() string {
 	return fmt.Sprintf("%T", *t)
 }
 
+// select the handler by name. Next to the builtin handlers kobold, error and
+// print, any registered handler can be selected.
 func (t *Handler) Set(s string) error {
-	switch s {
-	case "kobold":
-		*t = KoboldHandler
-	case "error":
-		*t = ThrowHandler
-	case "print":
-		*t = PrintHandler
-	default:
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	h, ok := handlers[s]
+	if !ok {
 		return fmt.Errorf("unknown task handler: %s", s)
 	}
+	*t = h
 	return nil
 }
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = map[string]Handler{
+		"kobold": KoboldHandler,
+		"error":  ThrowHandler,
+		"print":  PrintHandler,
+	}
+)
+
+// register a native handler, so that it can be selected by name, i.e. with
+// the handler flag. Like native plugins, its name must start with go. It
+// panics, if the name is invalid, or already registered.
+func RegisterHandler(name string, h Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	if !plugin.IsNative(name) || name == plugin.NativePrefix {
+		panic(fmt.Sprintf("register handler %q: name must start with %q", name, plugin.NativePrefix))
+	}
+	if h == nil {
+		panic(fmt.Sprintf("register handler %q: nil func", name))
+	}
+	if _, ok := handlers[name]; ok {
+		panic(fmt.Sprintf("register handler %q: already registered", name))
+	}
+	handlers[name] = h
+}